@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+)
+
+const usage = `usage: keyctl [-config path] <command> [flags]
+
+commands:
+  list                              show keys and their state
+  generate [-alg ES256] [-in 24h]   create a key that activates after -in
+  promote -kid <kid>                activate a scheduled key now
+  prune                             drop keys whose tokens have all expired
+`
+
+func main() {
+	cfgPath := flag.String("config", "configs/config.yaml", "path to config file")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		slog.Error("cannot load config", "err", err)
+		os.Exit(1)
+	}
+	dir := cfg.JWT.KeysDir
+	if dir == "" {
+		slog.Error("jwt.keys_dir is not configured")
+		os.Exit(1)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	now := time.Now()
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "list":
+		err = list(dir, cfg.JWT.AccessTTL, now)
+	case "generate":
+		fs := flag.NewFlagSet("generate", flag.ExitOnError)
+		alg := fs.String("alg", "ES256", "HS256, RS256, ES256 or EdDSA")
+		in := fs.Duration("in", 0, "delay before the key becomes active")
+		_ = fs.Parse(args)
+		var meta auth_client.KeyMeta
+		meta, err = auth_client.GenerateKey(dir, *alg, now.Add(*in))
+		if err == nil {
+			fmt.Printf("generated %s (%s), active from %s\n", meta.KID, meta.Alg, meta.ActivateAt.Format(time.RFC3339))
+		}
+	case "promote":
+		fs := flag.NewFlagSet("promote", flag.ExitOnError)
+		kid := fs.String("kid", "", "key id to promote")
+		_ = fs.Parse(args)
+		err = auth_client.PromoteKey(dir, *kid, now)
+		if err == nil {
+			fmt.Printf("promoted %s\n", *kid)
+		}
+	case "prune":
+		var removed []string
+		removed, err = auth_client.PruneKeys(dir, cfg.JWT.AccessTTL, now)
+		for _, kid := range removed {
+			fmt.Printf("removed %s\n", kid)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error(flag.Arg(0)+" failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func list(dir string, accessTTL time.Duration, now time.Time) error {
+	keys, err := auth_client.ListKeys(dir, accessTTL, now)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALG\tSTATE\tACTIVATE_AT\tRETIRED_AT")
+	for _, k := range keys {
+		retired := "-"
+		if !k.RetiredAt.IsZero() {
+			retired = k.RetiredAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.KID, k.Alg, k.State, k.ActivateAt.Format(time.RFC3339), retired)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/email"
+)
+
+const usage = `usage: mailer [-config path] [command] [flags]
+
+commands:
+  run        send the emails queued on RabbitMQ (default)
+  preview    render a template to stdout
+      -template <name>   template to render (one of: %s)
+      -lang <tags>       Accept-Language to pick the locale by
+      -data <json>       job payload; sample values fill in missing fields
+      -part <part>       mime (default), subject, text or html
+`
+
+func main() {
+	cfgPath := flag.String("config", "configs/config.yaml", "path to config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		slog.Error("cannot load config", "err", err)
+		os.Exit(1)
+	}
+
+	log := slog.Default()
+
+	templates, err := loadTemplates(cfg.Email)
+	if err != nil {
+		log.Error("email templates", "err", err)
+		os.Exit(1)
+	}
+	flag.Usage = func() { fmt.Fprintf(os.Stderr, usage, strings.Join(templates.Names(), ", ")) }
+	renderer := email.NewRenderer(templates, cfg.Email.AppURL)
+
+	switch flag.Arg(0) {
+	case "", "run":
+		run(cfg, renderer, log)
+	case "preview":
+		if err := preview(cfg, renderer, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func loadTemplates(cfg config.EmailConfig) (*email.Templates, error) {
+	fsys := email.EmbeddedTemplates()
+	if cfg.TemplatesDir != "" {
+		fsys = os.DirFS(cfg.TemplatesDir)
+	}
+	locale := cfg.DefaultLocale
+	if locale == "" {
+		locale = "en"
+	}
+	return email.LoadTemplates(fsys, locale)
+}
+
+func run(cfg *config.Config, renderer *email.Renderer, log *slog.Logger) {
+	mailer, err := email.NewMailer(cfg.Email)
+	if err != nil {
+		log.Error("mail transport", "err", err)
+		os.Exit(1)
+	}
+	worker := email.NewWorker(mailer, renderer, cfg.Mailer.SendTimeout, log)
+
+	consumer, err := broker.NewConsumer(cfg.RabbitMQ.URL, log, "auth.events", cfg.Mailer.Prefetch, broker.RetryPolicy{
+		MaxAttempts: cfg.Mailer.MaxAttempts,
+		BaseBackoff: cfg.Mailer.BaseBackoff,
+		MaxBackoff:  cfg.Mailer.MaxBackoff,
+	})
+	if err != nil {
+		log.Error("rabbitmq init", "err", err)
+		os.Exit(1)
+	}
+	defer consumer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Info("mailer consuming", "queues", cfg.Mailer.Queues)
+	if err := consumer.Consume(ctx, cfg.Mailer.Queues, worker.Handle); err != nil {
+		log.Error("consume", "err", err)
+		os.Exit(1)
+	}
+	log.Info("mailer stopped")
+}
+
+func preview(cfg *config.Config, renderer *email.Renderer, args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	fs.Usage = flag.Usage
+	name := fs.String("template", "", "template name")
+	lang := fs.String("lang", "", "Accept-Language")
+	data := fs.String("data", "", "job payload as JSON")
+	part := fs.String("part", "mime", "mime, subject, text or html")
+	_ = fs.Parse(args)
+	if *name == "" {
+		return fmt.Errorf("preview: -template is required")
+	}
+
+	job := email.Job{
+		UserID:     "00000000-0000-0000-0000-000000000000",
+		Email:      "user@example.com",
+		Code:       "123456",
+		Token:      "sample-token",
+		ExpiresIn:  600,
+		IP:         "203.0.113.7",
+		UserAgent:  "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+		SignedInAt: time.Now().UTC(),
+	}
+	if *data != "" {
+		if err := json.Unmarshal([]byte(*data), &job); err != nil {
+			return fmt.Errorf("preview: -data: %w", err)
+		}
+	}
+	if *lang != "" {
+		job.Language = *lang
+	}
+
+	msg, err := renderer.Preview(*name, job)
+	if err != nil {
+		return err
+	}
+	switch *part {
+	case "mime":
+		raw, err := msg.Compose(cfg.Email.From)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(raw)
+		return err
+	case "subject":
+		fmt.Println(msg.Subject)
+	case "text":
+		fmt.Print(msg.Text)
+	case "html":
+		fmt.Print(msg.HTML)
+	default:
+		return fmt.Errorf("preview: unknown part %q", *part)
+	}
+	return nil
+}
@@ -23,7 +23,8 @@ import (
 	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
 	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
 	"github.com/ParkieV/auth-service/internal/infrastructure/db"
-	"github.com/ParkieV/auth-service/internal/infrastructure/email"
+	"github.com/ParkieV/auth-service/internal/infrastructure/outbox"
+	"github.com/ParkieV/auth-service/internal/infrastructure/ratelimit"
 	"github.com/ParkieV/auth-service/internal/usecase"
 )
 
@@ -52,24 +53,91 @@ func main() {
 		log.Error("rabbitmq init", "err", err)
 		os.Exit(1)
 	}
+	// outbox messages for the mailer must not be lost if it has not run yet
+	if err := mq.DeclareQueues(cfg.Mailer.Queues...); err != nil {
+		log.Error("rabbitmq init", "err", err)
+		os.Exit(1)
+	}
 
-	_ = email.NewSMTPMailer(cfg.Email)
+	roleStore := db.NewRoleStore(pg.DB())
+
+	keysCtx, stopKeys := context.WithCancel(context.Background())
+	defer stopKeys()
+
+	var (
+		kc   auth_client.AuthClient
+		keys auth_client.KeySetProvider
+	)
+	switch cfg.Auth.Backend {
+	case "keycloak":
+		k := auth_client.NewKeycloakClient(cfg.Keycloak, log)
+		kc, keys = k, k
+	case "", "postgres":
+		repo, err := auth_client.NewDBTokenRepository(cfg.Postgres, cfg.JWT, roleStore, log)
+		if err != nil {
+			panic(fmt.Sprintf("Cannot connect to database: %s", err))
+		}
+		go repo.KeyRing().Watch(keysCtx, cfg.JWT.KeysReload)
+		kc, keys = repo, repo
+	default:
+		log.Error("unknown auth backend", "backend", cfg.Auth.Backend)
+		os.Exit(1)
+	}
 
-	kc, err := auth_client.NewDBTokenRepository(cfg.Postgres, cfg.JWT, log)
+	mfaStore, err := db.NewMFAStore(pg.DB(), cfg.MFA)
 	if err != nil {
-		panic(fmt.Sprintf("Cannot connect to database: %s", err))
+		log.Error("mfa store init", "err", err)
+		os.Exit(1)
 	}
 
-	registerUC := usecase.NewRegisterUsecase(pg, mq, kc, cfg.Email.ConfirmationTTL, log)
-	loginUC := usecase.NewLoginUsecase(pg, kc, redisCache, mq, log)
-	refreshUC := usecase.NewRefreshUsecase(kc, mq, redisCache, cfg.JWT.RefreshTTL, log)
-	logoutUC := usecase.NewLogoutUsecase(kc, mq, redisCache, log)
+	webauthnStore := db.NewWebAuthnStore(pg.DB())
+	auditUC := usecase.NewAuditUsecase(db.NewAuditStore(pg.DB()), log)
+
+	registerUC := usecase.NewRegisterUsecase(pg, kc, cfg.Email.ConfirmationTTL, auditUC, log)
+	loginGuard := usecase.NewLoginGuard(redisCache, mq, cfg.Lockout, auditUC, log)
+	loginUC := usecase.NewLoginUsecase(pg, mfaStore, webauthnStore, loginGuard, kc, redisCache, mq, cfg.Email.RequireConfirmation, cfg.MFA.ChallengeTTL, cfg.MFA.MaxAttempts, auditUC, log)
+	refreshUC := usecase.NewRefreshUsecase(kc, mq, redisCache, cfg.JWT.RefreshTTL, auditUC, log)
+	logoutUC := usecase.NewLogoutUsecase(kc, mq, redisCache, auditUC, log)
 	verifyUC := usecase.NewVerifyUsecase(kc, mq, log)
+	confirmUC := usecase.NewConfirmEmailUsecase(pg, auditUC, log)
+	resendUC := usecase.NewResendConfirmationUsecase(pg, redisCache, cfg.Email.ConfirmationTTL, cfg.Email.ResendLimit, cfg.Email.ResendWindow, log)
+	resetUC := usecase.NewPasswordResetUsecase(pg, kc, mq, redisCache, cfg.Email.PasswordResetTTL, auditUC, log)
+	changeUC := usecase.NewChangePasswordUsecase(pg, kc, redisCache, mq, auditUC, log)
+	jwksUC := usecase.NewJWKSUsecase(keys)
+	sessionsUC := usecase.NewSessionsUsecase(kc, redisCache, mq, auditUC, log)
+	oauthUC := usecase.NewOAuthUsecase(kc, redisCache, mq, cfg.OAuth.Clients, auditUC, log)
+	mfaUC := usecase.NewMFAUsecase(pg, mfaStore, mq, cfg.MFA.Issuer, auditUC, log)
+	webauthnUC, err := usecase.NewWebAuthnUsecase(pg, webauthnStore, loginUC, redisCache, mq, cfg.WebAuthn, auditUC, log)
+	if err != nil {
+		log.Error("webauthn init", "err", err)
+		os.Exit(1)
+	}
+	passwordlessUC := usecase.NewPasswordlessUsecase(pg, loginUC, redisCache, mq, cfg.Email.LoginCodeTTL, cfg.Email.LoginCodeAttempts, log)
+	adminUC := usecase.NewAdminUsecase(pg, roleStore, kc, redisCache, mq, cfg.Email.PasswordResetTTL, auditUC, log)
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	go outbox.NewRelay(db.NewOutboxStore(pg.DB()), mq, cfg.Outbox, log).Run(relayCtx)
+
+	limiter, err := ratelimit.New(cfg.RateLimit, cfg.Redis, log)
+	if err != nil {
+		log.Error("rate limiter init", "err", err)
+		os.Exit(1)
+	}
+	limitRules, err := ratelimit.NewRules(cfg.RateLimit)
+	if err != nil {
+		log.Error("rate limit policies", "err", err)
+		os.Exit(1)
+	}
 
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.New()
+	router, err := rest.NewRouter(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Error("trusted proxies", "err", err)
+		os.Exit(1)
+	}
 
-	rest.RegisterHandlers(router, registerUC, loginUC, refreshUC, logoutUC, verifyUC)
+	rest.RegisterHandlers(router, registerUC, loginUC, refreshUC, logoutUC, verifyUC, confirmUC, resendUC, resetUC, changeUC, jwksUC, sessionsUC, oauthUC, mfaUC, webauthnUC, passwordlessUC, adminUC, rest.RateLimit(limiter, limitRules, verifyUC, oauthUC, log))
 
 	httpSrv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Server.RESTPort),
@@ -84,9 +152,10 @@ func main() {
 		}
 	}()
 
-	grpcSrv := grpc.NewServer()
-	authSrv := server.NewAuthServer(registerUC, loginUC, refreshUC, logoutUC, verifyUC)
+	grpcSrv := grpc.NewServer(grpc.ChainUnaryInterceptor(server.ClientInterceptor(), server.RateLimitInterceptor(limiter, limitRules, verifyUC, oauthUC, log)))
+	authSrv := server.NewAuthServer(registerUC, loginUC, refreshUC, logoutUC, verifyUC, confirmUC, resendUC, resetUC, changeUC, sessionsUC, mfaUC, webauthnUC, passwordlessUC)
 	authpb.RegisterAuthServiceServer(grpcSrv, authSrv)
+	authpb.RegisterAdminServiceServer(grpcSrv, server.NewAdminServer(verifyUC, adminUC))
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.GRPCPort))
 	if err != nil {
@@ -111,6 +180,7 @@ func main() {
 
 	_ = httpSrv.Shutdown(ctx)
 	grpcSrv.GracefulStop()
+	stopRelay()
 	_ = mq.Close()
 	_ = pg.DB().Close()
 
@@ -2,15 +2,22 @@ package config
 
 import (
 	"encoding/base64"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+// ServerConfig sets the listen ports. TrustedProxies lists the addresses
+// or CIDRs of reverse proxies whose X-Forwarded-For header names the REST
+// client; with none, the client is the peer of the connection.
 type ServerConfig struct {
-	RESTPort int `mapstructure:"rest_port"`
-	GRPCPort int `mapstructure:"grpc_port"`
+	RESTPort       int      `mapstructure:"rest_port"`
+	GRPCPort       int      `mapstructure:"grpc_port"`
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type PostgresConfig struct {
@@ -31,6 +38,12 @@ type RabbitMQConfig struct {
 	URL string `mapstructure:"url"`
 }
 
+// AuthConfig selects the AuthClient implementation: "postgres" (default)
+// issues tokens locally, "keycloak" delegates to the keycloak section.
+type AuthConfig struct {
+	Backend string `mapstructure:"backend"`
+}
+
 type KeycloakConfig struct {
 	URL      string `mapstructure:"url"`
 	Realm    string `mapstructure:"realm"`
@@ -39,9 +52,15 @@ type KeycloakConfig struct {
 }
 
 type JWTConfig struct {
-	HMACSecret string        `mapstructure:"hmac_secret"`
-	AccessTTL  time.Duration `mapstructure:"access_ttl"`
-	RefreshTTL time.Duration `mapstructure:"refresh_ttl"`
+	HMACSecret     string        `mapstructure:"hmac_secret"`
+	AccessTTL      time.Duration `mapstructure:"access_ttl"`
+	RefreshTTL     time.Duration `mapstructure:"refresh_ttl"`
+	Algorithm      string        `mapstructure:"algorithm"`
+	PrivateKeyFile string        `mapstructure:"private_key_file"`
+	KeyID          string        `mapstructure:"key_id"`
+	KeysDir        string        `mapstructure:"keys_dir"`
+	KeysReload     time.Duration `mapstructure:"keys_reload"`
+	ClientID       string        `mapstructure:"client_id"`
 }
 
 func (j *JWTConfig) HmacKey() []byte {
@@ -53,14 +72,152 @@ func (j *JWTConfig) HmacKey() []byte {
 }
 
 type EmailConfig struct {
-	From            string        `mapstructure:"from"`
-	SMTPHost        string        `mapstructure:"smtp_host"`
-	SMTPPort        int           `mapstructure:"smtp_port"`
-	SMTPUser        string        `mapstructure:"smtp_user"`
-	SMTPPass        string        `mapstructure:"smtp_pass"`
-	UseTLS          bool          `mapstructure:"use_tls"`
-	DialTimeout     time.Duration `mapstructure:"dial_timeout"`
-	ConfirmationTTL time.Duration `mapstructure:"confirmation_ttl"`
+	From                string        `mapstructure:"from"`
+	SMTPHost            string        `mapstructure:"smtp_host"`
+	SMTPPort            int           `mapstructure:"smtp_port"`
+	SMTPUser            string        `mapstructure:"smtp_user"`
+	SMTPPass            string        `mapstructure:"smtp_pass"`
+	UseTLS              bool          `mapstructure:"use_tls"`
+	DialTimeout         time.Duration `mapstructure:"dial_timeout"`
+	ConfirmationTTL     time.Duration `mapstructure:"confirmation_ttl"`
+	RequireConfirmation bool          `mapstructure:"require_confirmation"`
+	ResendLimit         int           `mapstructure:"resend_limit"`
+	ResendWindow        time.Duration `mapstructure:"resend_window"`
+	PasswordResetTTL    time.Duration `mapstructure:"password_reset_ttl"`
+	LoginCodeTTL        time.Duration `mapstructure:"login_code_ttl"`
+	LoginCodeAttempts   int           `mapstructure:"login_code_attempts"`
+	AppURL              string        `mapstructure:"app_url"`
+	TemplatesDir        string        `mapstructure:"templates_dir"`
+	DefaultLocale       string        `mapstructure:"default_locale"`
+	// Transport selects how cmd/mailer delivers: "smtp" (default),
+	// "maildir", "memory", "http" or "failover".
+	Transport string             `mapstructure:"transport"`
+	Maildir   string             `mapstructure:"maildir"`
+	HTTP      MailHTTPConfig     `mapstructure:"http"`
+	Failover  MailFailoverConfig `mapstructure:"failover"`
+	DKIM      DKIMConfig         `mapstructure:"dkim"`
+}
+
+// DKIMConfig signs outgoing mail as Domain with the PEM key in
+// PrivateKeyFile (RSA or Ed25519), published in DNS under
+// Selector._domainkey.Domain. An empty Domain turns signing off.
+type DKIMConfig struct {
+	Domain         string `mapstructure:"domain"`
+	Selector       string `mapstructure:"selector"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+}
+
+// MailHTTPConfig is a provider that accepts emails as JSON POSTed to URL,
+// authenticated with a bearer Token.
+type MailHTTPConfig struct {
+	URL     string        `mapstructure:"url"`
+	Token   string        `mapstructure:"token"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// MailFailoverConfig tries Transports in order. A transport failing
+// FailureThreshold times in a row is skipped for Cooldown.
+type MailFailoverConfig struct {
+	Transports       []string      `mapstructure:"transports"`
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	Cooldown         time.Duration `mapstructure:"cooldown"`
+}
+
+// MailWorkerConfig drives cmd/mailer, which sends the emails queued on
+// Queues. A job that fails is retried after BaseBackoff, doubling per
+// attempt up to MaxBackoff; after MaxAttempts, or on an error retrying
+// cannot fix, it is moved to the queue's ".dead" queue.
+type MailWorkerConfig struct {
+	Queues      []string      `mapstructure:"queues"`
+	Prefetch    int           `mapstructure:"prefetch"`
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	BaseBackoff time.Duration `mapstructure:"base_backoff"`
+	MaxBackoff  time.Duration `mapstructure:"max_backoff"`
+	SendTimeout time.Duration `mapstructure:"send_timeout"`
+}
+
+type MFAConfig struct {
+	Issuer        string        `mapstructure:"issuer"`
+	EncryptionKey string        `mapstructure:"encryption_key"`
+	ChallengeTTL  time.Duration `mapstructure:"challenge_ttl"`
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+}
+
+// LockoutConfig guards password login against guessing. A zero limit
+// turns the corresponding counter off.
+type LockoutConfig struct {
+	MaxAccountFailures int           `mapstructure:"max_account_failures"`
+	MaxIPFailures      int           `mapstructure:"max_ip_failures"`
+	Window             time.Duration `mapstructure:"window"`
+	LockDuration       time.Duration `mapstructure:"lock_duration"`
+	BaseDelay          time.Duration `mapstructure:"base_delay"`
+	MaxDelay           time.Duration `mapstructure:"max_delay"`
+}
+
+// RateLimitPolicy is a token bucket holding Burst requests and refilled
+// with Rate requests every Per. Key selects what a bucket belongs to: "ip",
+// "user" or "client". Routes lists REST routes as "METHOD /path" and gRPC
+// methods by full name; every route of a policy drains the same bucket.
+type RateLimitPolicy struct {
+	Name   string        `mapstructure:"name"`
+	Routes []string      `mapstructure:"routes"`
+	Rate   int           `mapstructure:"rate"`
+	Per    time.Duration `mapstructure:"per"`
+	Burst  int           `mapstructure:"burst"`
+	Key    string        `mapstructure:"key"`
+}
+
+// RateLimitConfig selects the limiter backend, "memory" or "redis"; an
+// empty backend turns rate limiting off. Default applies to every route no
+// policy names.
+type RateLimitConfig struct {
+	Backend  string            `mapstructure:"backend"`
+	Default  RateLimitPolicy   `mapstructure:"default"`
+	Policies []RateLimitPolicy `mapstructure:"policies"`
+}
+
+// OutboxConfig drives the relay that publishes outbox messages. A failed
+// message is retried after BaseBackoff, doubling per attempt up to
+// MaxBackoff; Lease is how long a claimed message stays reserved for one
+// relay before another may take it over. Delivered messages are deleted
+// once they are older than Retention.
+type OutboxConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	BatchSize    int           `mapstructure:"batch_size"`
+	Lease        time.Duration `mapstructure:"lease"`
+	BaseBackoff  time.Duration `mapstructure:"base_backoff"`
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"`
+	Retention    time.Duration `mapstructure:"retention"`
+}
+
+type WebAuthnConfig struct {
+	RPID          string        `mapstructure:"rp_id"`
+	RPDisplayName string        `mapstructure:"rp_display_name"`
+	RPOrigins     []string      `mapstructure:"rp_origins"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+}
+
+type OAuthClient struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+type OAuthConfig struct {
+	Clients []OAuthClient `mapstructure:"clients"`
+}
+
+// validate refuses clients whose secret is missing or still a ${VAR}
+// placeholder, either of which anyone could authenticate with.
+func (o OAuthConfig) validate() error {
+	for _, c := range o.Clients {
+		if c.ID == "" {
+			return fmt.Errorf("oauth client without id")
+		}
+		if c.Secret == "" || strings.Contains(c.Secret, "${") {
+			return fmt.Errorf("oauth client %q: secret is not set", c.ID)
+		}
+	}
+	return nil
 }
 
 type LogstashConfig struct {
@@ -76,15 +233,23 @@ type CryptoParams struct {
 }
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Postgres PostgresConfig `mapstructure:"postgres"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	RabbitMQ RabbitMQConfig `mapstructure:"rabbitmq"`
-	Keycloak KeycloakConfig `mapstructure:"keycloak"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Email    EmailConfig    `mapstructure:"email"`
-	Logstash LogstashConfig `mapstructure:"logstash"`
-	Crypto   CryptoParams   `mapstructure:"crypto"`
+	Server    ServerConfig     `mapstructure:"server"`
+	Postgres  PostgresConfig   `mapstructure:"postgres"`
+	Redis     RedisConfig      `mapstructure:"redis"`
+	RabbitMQ  RabbitMQConfig   `mapstructure:"rabbitmq"`
+	Auth      AuthConfig       `mapstructure:"auth"`
+	Keycloak  KeycloakConfig   `mapstructure:"keycloak"`
+	JWT       JWTConfig        `mapstructure:"jwt"`
+	Email     EmailConfig      `mapstructure:"email"`
+	MFA       MFAConfig        `mapstructure:"mfa"`
+	WebAuthn  WebAuthnConfig   `mapstructure:"webauthn"`
+	Lockout   LockoutConfig    `mapstructure:"lockout"`
+	RateLimit RateLimitConfig  `mapstructure:"rate_limit"`
+	Outbox    OutboxConfig     `mapstructure:"outbox"`
+	Mailer    MailWorkerConfig `mapstructure:"mailer"`
+	OAuth     OAuthConfig      `mapstructure:"oauth"`
+	Logstash  LogstashConfig   `mapstructure:"logstash"`
+	Crypto    CryptoParams     `mapstructure:"crypto"`
 }
 
 func Load(path string) (*Config, error) {
@@ -98,5 +263,19 @@ func Load(path string) (*Config, error) {
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	cfg.expandSecrets()
+	if err := cfg.OAuth.validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
+
+// expandSecrets replaces ${VAR} in the secrets the config file refers to
+// by environment variable rather than spelling out.
+func (c *Config) expandSecrets() {
+	c.Email.SMTPPass = os.ExpandEnv(c.Email.SMTPPass)
+	c.Email.HTTP.Token = os.ExpandEnv(c.Email.HTTP.Token)
+	for i := range c.OAuth.Clients {
+		c.OAuth.Clients[i].Secret = os.ExpandEnv(c.OAuth.Clients[i].Secret)
+	}
+}
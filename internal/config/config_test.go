@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+	return path
+}
+
+func TestLoadExpandsSecrets(t *testing.T) {
+	t.Setenv("TEST_GATEWAY_SECRET", "s3cret")
+	t.Setenv("TEST_SMTP_PASS", "smtp-pass")
+
+	cfg, err := Load(writeConfig(t, `
+email:
+  smtp_pass: "${TEST_SMTP_PASS}"
+oauth:
+  clients:
+    - id: "gateway"
+      secret: "${TEST_GATEWAY_SECRET}"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", cfg.OAuth.Clients[0].Secret)
+	require.Equal(t, "smtp-pass", cfg.Email.SMTPPass)
+}
+
+func TestLoadRejectsUnsetClientSecret(t *testing.T) {
+	for name, secret := range map[string]string{
+		"unset variable": `"${TEST_UNSET_SECRET}"`,
+		"empty":          `""`,
+		"placeholder":    `"${"`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, `
+oauth:
+  clients:
+    - id: "gateway"
+      secret: `+secret+"\n"))
+			require.ErrorContains(t, err, `oauth client "gateway"`)
+		})
+	}
+}
+
+func TestLoadShippedConfig(t *testing.T) {
+	_, err := Load(filepath.Join("..", "..", "configs", "config.yaml"))
+	require.NoError(t, err)
+}
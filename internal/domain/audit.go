@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidAuditQuery = errors.New("invalid audit query")
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditRegister             = "register"
+	AuditEmailConfirm         = "email_confirm"
+	AuditLogin                = "login"
+	AuditRefresh              = "refresh"
+	AuditLogout               = "logout"
+	AuditLogoutAll            = "logout_all"
+	AuditSessionRevoke        = "session_revoke"
+	AuditPasswordChange       = "password_change"
+	AuditPasswordResetRequest = "password_reset_request"
+	AuditPasswordReset        = "password_reset"
+	AuditMFAEnable            = "mfa_enable"
+	AuditMFADisable           = "mfa_disable"
+	AuditPasskeyAdd           = "passkey_add"
+	AuditPasskeyRemove        = "passkey_remove"
+	AuditLockoutUnlock        = "lockout_unlock"
+	AuditTokenRevoke          = "token_revoke"
+
+	AuditAdminDisable        = "admin.disable"
+	AuditAdminEnable         = "admin.enable"
+	AuditAdminConfirm        = "admin.confirm"
+	AuditAdminPasswordReset  = "admin.password_reset"
+	AuditAdminDelete         = "admin.delete"
+	AuditAdminRevokeSessions = "admin.revoke_sessions"
+	AuditAdminRoleCreate     = "admin.role_create"
+	AuditAdminRoleUpdate     = "admin.role_update"
+	AuditAdminRoleDelete     = "admin.role_delete"
+	AuditAdminRoleAssign     = "admin.role_assign"
+	AuditAdminRoleUnassign   = "admin.role_unassign"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent is one entry of the audit log. ActorID is who acted and
+// UserID whose account was acted on; they differ for admin actions and
+// UserID is empty when an attempt names an unknown account, in which case
+// Email holds the address as given.
+type AuditEvent struct {
+	ID         int64
+	OccurredAt time.Time
+	ActorID    string
+	UserID     string
+	Email      string
+	Action     string
+	Outcome    string
+	// Detail says why a failure failed, or anything else worth keeping.
+	Detail    string
+	IP        string
+	UserAgent string
+}
+
+// AuditQuery selects events newest first. Zero fields do not filter.
+type AuditQuery struct {
+	UserID string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+func (q AuditQuery) Validate() error {
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return ErrInvalidAuditQuery
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return ErrInvalidAuditQuery
+	}
+	return nil
+}
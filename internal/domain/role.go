@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrInvalidRoleName    = errors.New("invalid role or permission name")
+)
+
+// RoleAdmin is seeded by the migrations and holds every permission.
+const RoleAdmin = "admin"
+
+// Permissions seeded by the migrations that guard the admin API.
+const (
+	PermUsersRead  = "users:read"
+	PermUsersWrite = "users:write"
+	PermRolesRead  = "roles:read"
+	PermRolesWrite = "roles:write"
+)
+
+// role and permission names end up in token claims and scope strings, so
+// they are kept to a small alphabet without spaces.
+var roleNameRe = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,63}$`)
+
+// ValidRoleName reports whether name may be used for a role or permission.
+func ValidRoleName(name string) bool {
+	return roleNameRe.MatchString(name)
+}
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+	CreatedAt   time.Time
+}
+
+func NewRole(name, description string, permissions []string) (*Role, error) {
+	if !ValidRoleName(name) {
+		return nil, ErrInvalidRoleName
+	}
+	for _, p := range permissions {
+		if !ValidRoleName(p) {
+			return nil, ErrInvalidRoleName
+		}
+	}
+	return &Role{Name: name, Description: description, Permissions: permissions}, nil
+}
+
+// Access is what a user may do: the roles they hold and the union of the
+// permissions those roles grant.
+type Access struct {
+	Roles       []string
+	Permissions []string
+}
+
+func (a Access) HasRole(role string) bool {
+	return slices.Contains(a.Roles, role)
+}
+
+func (a Access) Can(permission string) bool {
+	return slices.Contains(a.Permissions, permission)
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidRoleName(t *testing.T) {
+	for _, name := range []string{"admin", "users:read", "billing.viewer", "team-lead_2"} {
+		require.True(t, ValidRoleName(name), name)
+	}
+	for _, name := range []string{"", "Admin", "has space", "a,b", "1st", ":read"} {
+		require.False(t, ValidRoleName(name), name)
+	}
+}
+
+func TestNewRole(t *testing.T) {
+	r, err := NewRole("support", "Helpdesk", []string{"users:read"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"users:read"}, r.Permissions)
+
+	_, err = NewRole("Support", "", nil)
+	require.ErrorIs(t, err, ErrInvalidRoleName)
+	_, err = NewRole("support", "", []string{"users read"})
+	require.ErrorIs(t, err, ErrInvalidRoleName)
+}
+
+func TestAccess(t *testing.T) {
+	a := Access{Roles: []string{RoleAdmin}, Permissions: []string{"users:read"}}
+	require.True(t, a.HasRole(RoleAdmin))
+	require.False(t, a.HasRole("support"))
+	require.True(t, a.Can("users:read"))
+	require.False(t, a.Can("users:write"))
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// ClientInfo describes the device a login originates from. Language is
+// its Accept-Language, used to localize emails.
+type ClientInfo struct {
+	UserAgent   string
+	IP          string
+	DeviceLabel string
+	Language    string
+}
+
+type Session struct {
+	ID              string
+	UserID          string
+	Client          ClientInfo
+	CreatedAt       time.Time
+	LastRefreshedAt time.Time
+	Current         bool
+}
@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFANotEnrolled    = errors.New("mfa not enrolled")
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrInvalidOTP        = errors.New("invalid one-time code")
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// codes from the neighbouring steps are accepted to absorb clock drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP is an RFC 6238 enrollment: HMAC-SHA1, 6 digits, 30 second steps,
+// the parameters every authenticator app supports. LastStep is the last
+// time step a code was accepted for; codes at or before it are replays.
+type TOTP struct {
+	UserID    string
+	Secret    []byte
+	Confirmed bool
+	LastStep  int64
+}
+
+func NewTOTP(userID string) (*TOTP, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &TOTP{UserID: userID, Secret: secret}, nil
+}
+
+// EncodedSecret is the base32 form users type in when they cannot scan a QR code.
+func (t *TOTP) EncodedSecret() string {
+	return b32.EncodeToString(t.Secret)
+}
+
+// URI is the otpauth:// key URI understood by authenticator apps.
+func (t *TOTP) URI(issuer, account string) string {
+	q := url.Values{}
+	q.Set("secret", t.EncodedSecret())
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Code returns the code for the time step containing at.
+func (t *TOTP) Code(at time.Time) string {
+	return hotp(t.Secret, uint64(totpStep(at)))
+}
+
+// Verify checks code against the steps around now and returns the step it
+// matched. Steps at or before LastStep are rejected.
+func (t *TOTP) Verify(code string, now time.Time) (int64, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, ErrInvalidOTP
+	}
+	cur := totpStep(now)
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if step <= t.LastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(t.Secret, uint64(step))), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrInvalidOTP
+}
+
+func totpStep(at time.Time) int64 {
+	return at.Unix() / int64(totpPeriod/time.Second)
+}
+
+// hotp is RFC 4226 HOTP with dynamic truncation.
+func hotp(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%1_000_000)
+}
+
+// IsTOTPCode tells a six digit TOTP code apart from a recovery code.
+func IsTOTPCode(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRecoveryCodes returns fresh single-use codes formatted as xxxxx-xxxxx
+// together with the hashes that are stored in their place.
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	buf := make([]byte, recoveryCodeLen*5/8)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(b32.EncodeToString(buf))
+		codes = append(codes, raw[:recoveryCodeLen/2]+"-"+raw[recoveryCodeLen/2:])
+		hashes = append(hashes, HashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode ignores case, spaces and dashes so codes can be typed the
+// way they were printed or read aloud.
+func HashRecoveryCode(code string) string {
+	norm := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(sum[:])
+}
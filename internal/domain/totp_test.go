@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 appendix B, SHA1, truncated to six digits.
+func TestTOTPVectors(t *testing.T) {
+	totp := &TOTP{Secret: []byte("12345678901234567890")}
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, want := range vectors {
+		require.Equal(t, want, totp.Code(time.Unix(ts, 0)), "t=%d", ts)
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	totp, err := NewTOTP("u1")
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+
+	step, err := totp.Verify(totp.Code(now.Add(-30*time.Second)), now)
+	require.NoError(t, err, "previous step is within skew")
+
+	totp.LastStep = step
+	_, err = totp.Verify(totp.Code(now.Add(-30*time.Second)), now)
+	require.ErrorIs(t, err, ErrInvalidOTP, "replayed step")
+
+	_, err = totp.Verify(totp.Code(now.Add(-2*time.Minute)), now)
+	require.ErrorIs(t, err, ErrInvalidOTP, "outside skew")
+}
+
+func TestTOTPURI(t *testing.T) {
+	totp := &TOTP{Secret: []byte("12345678901234567890")}
+	uri := totp.URI("Parkie", "a@b.io")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Parkie:a@b.io?"), uri)
+	require.Contains(t, uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	require.Contains(t, uri, "issuer=Parkie")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	require.Len(t, hashes, recoveryCodeCount)
+	require.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+	require.False(t, IsTOTPCode(codes[0]))
+
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	require.Equal(t, hashes[0], HashRecoveryCode(typed))
+}
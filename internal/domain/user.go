@@ -10,6 +10,7 @@ var (
 	ErrInvalidConfirmationCode = errors.New("invalid confirmation code")
 	ErrConfirmationExpired     = errors.New("confirmation code expired")
 	ErrAlreadyConfirmed        = errors.New("user already confirmed")
+	ErrUserNotFound            = errors.New("user not found")
 )
 
 type User struct {
@@ -19,6 +20,8 @@ type User struct {
 	confirmationID string
 	expiresAt      time.Time
 	confirmed      bool
+	createdAt      time.Time
+	disabledAt     time.Time
 }
 
 func (u *User) ID() string             { return u.id }
@@ -26,6 +29,11 @@ func (u *User) Email() Email           { return u.email }
 func (u *User) IsConfirmed() bool      { return u.confirmed }
 func (u *User) ConfirmationID() string { return u.confirmationID }
 func (u *User) ExpiresAt() time.Time   { return u.expiresAt }
+func (u *User) CreatedAt() time.Time   { return u.createdAt }
+
+// DisabledAt is zero for accounts that may sign in.
+func (u *User) DisabledAt() time.Time { return u.disabledAt }
+func (u *User) IsDisabled() bool      { return !u.disabledAt.IsZero() }
 
 func NewUserFromRegistration(
 	id string,
@@ -47,6 +55,7 @@ func NewUserFromRegistration(
 		confirmationID: confirmationID,
 		expiresAt:      time.Now().UTC().Add(ttl),
 		confirmed:      false,
+		createdAt:      time.Now().UTC(),
 	}, nil
 }
 
@@ -57,6 +66,8 @@ func RehydrateUser(
 	confirmationID string,
 	expiresAt time.Time,
 	confirmed bool,
+	createdAt time.Time,
+	disabledAt time.Time,
 ) (*User, error) {
 
 	pwdVO, err := NewPasswordFromHash(hash)
@@ -71,6 +82,8 @@ func RehydrateUser(
 		confirmationID: confirmationID,
 		expiresAt:      expiresAt.UTC(),
 		confirmed:      confirmed,
+		createdAt:      createdAt.UTC(),
+		disabledAt:     disabledAt,
 	}, nil
 }
 
@@ -85,12 +98,14 @@ func (u *User) ApplyRehash(newPwd Password) {
 	u.password = newPwd
 }
 
+// Confirm checks the code before anything else, so that without it every
+// account looks the same as an unknown one.
 func (u *User) Confirm(code string, now time.Time) error {
 	switch {
-	case u.confirmed:
-		return ErrAlreadyConfirmed
 	case code != u.confirmationID:
 		return ErrInvalidConfirmationCode
+	case u.confirmed:
+		return ErrAlreadyConfirmed
 	case now.UTC().After(u.expiresAt):
 		return ErrConfirmationExpired
 	}
@@ -98,6 +113,15 @@ func (u *User) Confirm(code string, now time.Time) error {
 	return nil
 }
 
+func (u *User) RotateConfirmation(code string, ttl time.Duration, now time.Time) error {
+	if u.confirmed {
+		return ErrAlreadyConfirmed
+	}
+	u.confirmationID = code
+	u.expiresAt = now.UTC().Add(ttl)
+	return nil
+}
+
 func (u *User) HashForStorage() string {
 	return u.password.Hash()
 }
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+var (
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	ErrCredentialExists   = errors.New("webauthn credential already registered")
+)
+
+// WebAuthnCredential is a public key registered by an authenticator. Only
+// the public half is ever seen by the server; SignCount and the backup flags
+// are kept so later assertions can be checked against them.
+type WebAuthnCredential struct {
+	ID              []byte
+	UserID          string
+	Name            string
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+	LastUsedAt      time.Time
+}
+
+// EncodedID is the base64url form browsers use for credential ids.
+func (c *WebAuthnCredential) EncodedID() string {
+	return base64.RawURLEncoding.EncodeToString(c.ID)
+}
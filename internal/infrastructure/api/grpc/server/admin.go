@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	authpb "github.com/ParkieV/auth-service/internal/infrastructure/api/grpc"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+type AdminServer struct {
+	authpb.UnimplementedAdminServiceServer
+	verifyUC *usecase.VerifyUsecase
+	adminUC  *usecase.AdminUsecase
+}
+
+func NewAdminServer(verifyUC *usecase.VerifyUsecase, adminUC *usecase.AdminUsecase) *AdminServer {
+	return &AdminServer{verifyUC: verifyUC, adminUC: adminUC}
+}
+
+// authorize checks that the caller holds permission and returns their id.
+func (s *AdminServer) authorize(ctx context.Context, permission string) (string, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return "", status.Errorf(codes.Unauthenticated, "missing bearer token")
+	}
+	res, err := s.verifyUC.Authenticate(ctx, token)
+	if err != nil || !res.Active {
+		return "", status.Errorf(codes.Unauthenticated, usecase.ErrTokenInvalid.Error())
+	}
+	if err := s.adminUC.Authorize(domain.Access{Roles: res.Roles, Permissions: res.Scope}, permission); err != nil {
+		return "", status.Errorf(codes.PermissionDenied, err.Error())
+	}
+	return res.UserID, nil
+}
+
+func (s *AdminServer) ListUsers(
+	ctx context.Context, req *authpb.ListUsersRequest,
+) (*authpb.ListUsersResponse, error) {
+	if _, err := s.authorize(ctx, domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	if req.Limit < 0 || req.Offset < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+
+	page, err := s.adminUC.ListUsers(ctx, req.Query, int(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+	out := make([]*authpb.AdminUser, 0, len(page.Users))
+	for _, u := range page.Users {
+		out = append(out, adminUser(u))
+	}
+	return &authpb.ListUsersResponse{Users: out, Total: int32(page.Total)}, nil
+}
+
+func (s *AdminServer) GetUser(
+	ctx context.Context, req *authpb.AdminUserRequest,
+) (*authpb.AdminUser, error) {
+	if _, err := s.authorize(ctx, domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	details, err := s.adminUC.GetUser(ctx, req.UserId)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	resp := adminUser(details.User)
+	resp.Roles = details.Roles
+	return resp, nil
+}
+
+func (s *AdminServer) DisableUser(
+	ctx context.Context, req *authpb.AdminUserRequest,
+) (*emptypb.Empty, error) {
+	return s.act(ctx, req, s.adminUC.Disable)
+}
+
+func (s *AdminServer) EnableUser(
+	ctx context.Context, req *authpb.AdminUserRequest,
+) (*emptypb.Empty, error) {
+	return s.act(ctx, req, s.adminUC.Enable)
+}
+
+func (s *AdminServer) ConfirmUser(
+	ctx context.Context, req *authpb.AdminUserRequest,
+) (*emptypb.Empty, error) {
+	return s.act(ctx, req, s.adminUC.Confirm)
+}
+
+func (s *AdminServer) ForcePasswordReset(
+	ctx context.Context, req *authpb.AdminUserRequest,
+) (*emptypb.Empty, error) {
+	return s.act(ctx, req, s.adminUC.ForcePasswordReset)
+}
+
+func (s *AdminServer) DeleteUser(
+	ctx context.Context, req *authpb.AdminUserRequest,
+) (*emptypb.Empty, error) {
+	return s.act(ctx, req, s.adminUC.Delete)
+}
+
+func (s *AdminServer) RevokeUserSessions(
+	ctx context.Context, req *authpb.AdminUserRequest,
+) (*emptypb.Empty, error) {
+	return s.act(ctx, req, s.adminUC.RevokeSessions)
+}
+
+func (s *AdminServer) AssignRole(
+	ctx context.Context, req *authpb.UserRoleRequest,
+) (*emptypb.Empty, error) {
+	actorID, err := s.authorize(ctx, domain.PermRolesWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.adminUC.AssignRole(ctx, actorID, req.UserId, req.Role); err != nil {
+		return nil, adminError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminServer) UnassignRole(
+	ctx context.Context, req *authpb.UserRoleRequest,
+) (*emptypb.Empty, error) {
+	actorID, err := s.authorize(ctx, domain.PermRolesWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.adminUC.UnassignRole(ctx, actorID, req.UserId, req.Role); err != nil {
+		return nil, adminError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminServer) ListRoles(
+	ctx context.Context, _ *emptypb.Empty,
+) (*authpb.ListRolesResponse, error) {
+	if _, err := s.authorize(ctx, domain.PermRolesRead); err != nil {
+		return nil, err
+	}
+	roles, err := s.adminUC.ListRoles(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+	out := make([]*authpb.Role, 0, len(roles))
+	for i := range roles {
+		out = append(out, adminRole(&roles[i]))
+	}
+	return &authpb.ListRolesResponse{Roles: out}, nil
+}
+
+func (s *AdminServer) CreateRole(
+	ctx context.Context, req *authpb.CreateRoleRequest,
+) (*authpb.Role, error) {
+	actorID, err := s.authorize(ctx, domain.PermRolesWrite)
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.adminUC.CreateRole(ctx, actorID, req.Name, req.Description, req.Permissions)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return adminRole(role), nil
+}
+
+func (s *AdminServer) SetRolePermissions(
+	ctx context.Context, req *authpb.SetRolePermissionsRequest,
+) (*emptypb.Empty, error) {
+	actorID, err := s.authorize(ctx, domain.PermRolesWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.adminUC.SetRolePermissions(ctx, actorID, req.Name, req.Permissions); err != nil {
+		return nil, adminError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminServer) DeleteRole(
+	ctx context.Context, req *authpb.DeleteRoleRequest,
+) (*emptypb.Empty, error) {
+	actorID, err := s.authorize(ctx, domain.PermRolesWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.adminUC.DeleteRole(ctx, actorID, req.Name); err != nil {
+		return nil, adminError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminServer) ListPermissions(
+	ctx context.Context, _ *emptypb.Empty,
+) (*authpb.ListPermissionsResponse, error) {
+	if _, err := s.authorize(ctx, domain.PermRolesRead); err != nil {
+		return nil, err
+	}
+	perms, err := s.adminUC.ListPermissions(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+	out := make([]*authpb.Permission, 0, len(perms))
+	for _, p := range perms {
+		out = append(out, &authpb.Permission{Name: p.Name, Description: p.Description})
+	}
+	return &authpb.ListPermissionsResponse{Permissions: out}, nil
+}
+
+func (s *AdminServer) ListAuditEvents(
+	ctx context.Context, req *authpb.ListAuditEventsRequest,
+) (*authpb.ListAuditEventsResponse, error) {
+	if _, err := s.authorize(ctx, domain.PermUsersRead); err != nil {
+		return nil, err
+	}
+	q := domain.AuditQuery{UserID: req.UserId, Limit: int(req.Limit), Offset: int(req.Offset)}
+	if req.From != nil {
+		q.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		q.To = req.To.AsTime()
+	}
+
+	events, err := s.adminUC.AuditLog(ctx, q)
+	if errors.Is(err, domain.ErrInvalidAuditQuery) {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	out := make([]*authpb.AuditEvent, 0, len(events))
+	for _, e := range events {
+		out = append(out, &authpb.AuditEvent{
+			Id:         e.ID,
+			OccurredAt: timestamppb.New(e.OccurredAt),
+			ActorId:    e.ActorID,
+			UserId:     e.UserID,
+			Email:      e.Email,
+			Action:     e.Action,
+			Outcome:    e.Outcome,
+			Detail:     e.Detail,
+			Ip:         e.IP,
+			UserAgent:  e.UserAgent,
+		})
+	}
+	return &authpb.ListAuditEventsResponse{Events: out}, nil
+}
+
+// act runs one of the admin actions that take (actorID, userID); they all
+// change the account and need users:write.
+func (s *AdminServer) act(
+	ctx context.Context, req *authpb.AdminUserRequest,
+	action func(ctx context.Context, actorID, userID string) error,
+) (*emptypb.Empty, error) {
+	actorID, err := s.authorize(ctx, domain.PermUsersWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := action(ctx, actorID, req.UserId); err != nil {
+		return nil, adminError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func adminUser(u *domain.User) *authpb.AdminUser {
+	resp := &authpb.AdminUser{
+		Id:        u.ID(),
+		Email:     u.Email().String(),
+		Confirmed: u.IsConfirmed(),
+		Disabled:  u.IsDisabled(),
+		CreatedAt: timestamppb.New(u.CreatedAt()),
+	}
+	if u.IsDisabled() {
+		resp.DisabledAt = timestamppb.New(u.DisabledAt())
+	}
+	return resp
+}
+
+func adminRole(r *domain.Role) *authpb.Role {
+	resp := &authpb.Role{Name: r.Name, Description: r.Description, Permissions: r.Permissions}
+	if !r.CreatedAt.IsZero() {
+		resp.CreatedAt = timestamppb.New(r.CreatedAt)
+	}
+	return resp
+}
+
+func adminError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrRoleNotFound):
+		return status.Errorf(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrAlreadyConfirmed), errors.Is(err, domain.ErrRoleExists):
+		return status.Errorf(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrInvalidRoleName), errors.Is(err, domain.ErrPermissionNotFound):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, usecase.ErrSelfAction), errors.Is(err, usecase.ErrProtectedRole):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "internal error")
+	}
+}
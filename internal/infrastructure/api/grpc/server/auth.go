@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+// authenticate verifies the bearer token from the "authorization" metadata
+// and returns the verification result together with the raw token.
+func (s *AuthServer) authenticate(ctx context.Context) (*usecase.VerifyResult, string, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, "", status.Errorf(codes.Unauthenticated, "missing bearer token")
+	}
+
+	res, err := s.verifyUC.Authenticate(ctx, token)
+	if err != nil || !res.Active {
+		return nil, "", status.Errorf(codes.Unauthenticated, usecase.ErrTokenInvalid.Error())
+	}
+	return res, token, nil
+}
+
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if t, ok := strings.CutPrefix(v, "Bearer "); ok && t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// ClientInterceptor hands the caller's address and user agent to the
+// usecases for the audit log, and its language for the emails they send.
+func ClientInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(usecase.WithClient(ctx, clientInfo(ctx, "")), req)
+	}
+}
+
+func clientInfo(ctx context.Context, deviceLabel string) domain.ClientInfo {
+	info := domain.ClientInfo{DeviceLabel: deviceLabel}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			info.UserAgent = ua[0]
+		}
+		if lang := md.Get("accept-language"); len(lang) > 0 {
+			info.Language = lang[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			info.IP = host
+		} else {
+			info.IP = p.Addr.String()
+		}
+	}
+	return info
+}
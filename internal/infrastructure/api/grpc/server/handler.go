@@ -3,10 +3,14 @@ package server
 import (
 	"context"
 	"errors"
+	"strconv"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/ParkieV/auth-service/internal/domain"
 	authpb "github.com/ParkieV/auth-service/internal/infrastructure/api/grpc"
@@ -15,11 +19,19 @@ import (
 
 type AuthServer struct {
 	authpb.UnimplementedAuthServiceServer
-	registerUC *usecase.RegisterUsecase
-	loginUC    *usecase.LoginUsecase
-	refreshUC  *usecase.RefreshUsecase
-	logoutUC   *usecase.LogoutUsecase
-	verifyUC   *usecase.VerifyUsecase
+	registerUC     *usecase.RegisterUsecase
+	loginUC        *usecase.LoginUsecase
+	refreshUC      *usecase.RefreshUsecase
+	logoutUC       *usecase.LogoutUsecase
+	verifyUC       *usecase.VerifyUsecase
+	confirmUC      *usecase.ConfirmEmailUsecase
+	resendUC       *usecase.ResendConfirmationUsecase
+	resetUC        *usecase.PasswordResetUsecase
+	changeUC       *usecase.ChangePasswordUsecase
+	sessionsUC     *usecase.SessionsUsecase
+	mfaUC          *usecase.MFAUsecase
+	webauthnUC     *usecase.WebAuthnUsecase
+	passwordlessUC *usecase.PasswordlessUsecase
 }
 
 func NewAuthServer(
@@ -28,13 +40,29 @@ func NewAuthServer(
 	refreshUC *usecase.RefreshUsecase,
 	logoutUC *usecase.LogoutUsecase,
 	verifyUC *usecase.VerifyUsecase,
+	confirmUC *usecase.ConfirmEmailUsecase,
+	resendUC *usecase.ResendConfirmationUsecase,
+	resetUC *usecase.PasswordResetUsecase,
+	changeUC *usecase.ChangePasswordUsecase,
+	sessionsUC *usecase.SessionsUsecase,
+	mfaUC *usecase.MFAUsecase,
+	webauthnUC *usecase.WebAuthnUsecase,
+	passwordlessUC *usecase.PasswordlessUsecase,
 ) *AuthServer {
 	return &AuthServer{
-		registerUC: registerUC,
-		loginUC:    loginUC,
-		refreshUC:  refreshUC,
-		logoutUC:   logoutUC,
-		verifyUC:   verifyUC,
+		registerUC:     registerUC,
+		loginUC:        loginUC,
+		refreshUC:      refreshUC,
+		logoutUC:       logoutUC,
+		verifyUC:       verifyUC,
+		confirmUC:      confirmUC,
+		resendUC:       resendUC,
+		resetUC:        resetUC,
+		changeUC:       changeUC,
+		sessionsUC:     sessionsUC,
+		mfaUC:          mfaUC,
+		webauthnUC:     webauthnUC,
+		passwordlessUC: passwordlessUC,
 	}
 }
 
@@ -59,12 +87,21 @@ func (s *AuthServer) Login(
 	ctx context.Context,
 	req *authpb.LoginRequest,
 ) (*authpb.LoginResponse, error) {
-	at, rt, err := s.loginUC.Login(ctx, req.Email, req.Password)
+	at, rt, err := s.loginUC.Login(ctx, req.Email, req.Password, clientInfo(ctx, req.DeviceLabel))
+	var challenge *usecase.MFAChallenge
+	var locked *usecase.LockedError
 	switch {
 	case err == nil:
 		return &authpb.LoginResponse{Jwt: at, RefreshToken: rt}, nil
+	case errors.As(err, &challenge):
+		return &authpb.LoginResponse{MfaRequired: true, MfaToken: challenge.Token, MfaMethods: challenge.Methods}, nil
+	case errors.As(err, &locked):
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(locked.RetryAfterSeconds())))
+		return nil, status.Errorf(codes.ResourceExhausted, err.Error())
 	case errors.Is(err, usecase.ErrNotConfirmed):
 		return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, usecase.ErrAccountDisabled):
+		return nil, status.Errorf(codes.PermissionDenied, err.Error())
 	case errors.Is(err, usecase.ErrUserNotFound),
 		errors.Is(err, usecase.ErrInvalidCredentials):
 		return nil, status.Errorf(codes.Unauthenticated, err.Error())
@@ -92,7 +129,7 @@ func (s *AuthServer) Logout(
 	ctx context.Context,
 	req *authpb.LogoutRequest,
 ) (*emptypb.Empty, error) {
-	if err := s.logoutUC.Logout(ctx, req.RefreshToken); err != nil {
+	if err := s.logoutUC.Logout(ctx, req.UserId, req.RefreshToken); err != nil {
 		return nil, status.Errorf(codes.Internal, "internal error")
 	}
 	return &emptypb.Empty{}, nil
@@ -105,10 +142,168 @@ func (s *AuthServer) Verify(
 	res, err := s.verifyUC.Verify(ctx, req.Token)
 	switch {
 	case err == nil && res.Active:
-		return &authpb.VerifyResponse{UserId: res.UserID, Active: true}, nil
+		return &authpb.VerifyResponse{UserId: res.UserID, Active: true, Scope: res.Scope, Roles: res.Roles}, nil
 	case errors.Is(err, usecase.ErrTokenInvalid):
 		return nil, status.Errorf(codes.Unauthenticated, err.Error())
 	default:
 		return nil, status.Errorf(codes.Internal, "internal error")
 	}
 }
+
+func (s *AuthServer) ConfirmEmail(
+	ctx context.Context,
+	req *authpb.ConfirmEmailRequest,
+) (*emptypb.Empty, error) {
+	err := s.confirmUC.Confirm(ctx, req.Email, req.Code)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrInvalidEmail),
+		errors.Is(err, domain.ErrInvalidConfirmationCode):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrConfirmationExpired):
+		return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, domain.ErrAlreadyConfirmed):
+		return nil, status.Errorf(codes.AlreadyExists, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) ResendConfirmation(
+	ctx context.Context,
+	req *authpb.ResendConfirmationRequest,
+) (*emptypb.Empty, error) {
+	err := s.resendUC.Resend(ctx, req.Email)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrInvalidEmail):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, usecase.ErrTooManyRequests):
+		return nil, status.Errorf(codes.ResourceExhausted, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) RequestPasswordReset(
+	ctx context.Context,
+	req *authpb.RequestPasswordResetRequest,
+) (*emptypb.Empty, error) {
+	err := s.resetUC.RequestReset(ctx, req.Email)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrInvalidEmail):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) ResetPassword(
+	ctx context.Context,
+	req *authpb.ResetPasswordRequest,
+) (*emptypb.Empty, error) {
+	err := s.resetUC.ResetPassword(ctx, req.Token, req.NewPassword)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrInvalidPassword),
+		errors.Is(err, usecase.ErrInvalidResetToken):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) ChangePassword(
+	ctx context.Context,
+	req *authpb.ChangePasswordRequest,
+) (*emptypb.Empty, error) {
+	res, token, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.changeUC.ChangePassword(ctx, res.UserID, token, req.CurrentPassword, req.NewPassword, req.RevokeOtherSessions)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrInvalidPassword):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, usecase.ErrInvalidCredentials):
+		return nil, status.Errorf(codes.PermissionDenied, err.Error())
+	case errors.Is(err, usecase.ErrUserNotFound):
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) ListSessions(
+	ctx context.Context,
+	_ *emptypb.Empty,
+) (*authpb.ListSessionsResponse, error) {
+	res, token, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessionsUC.List(ctx, res.UserID, token)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+
+	out := &authpb.ListSessionsResponse{}
+	for _, sess := range sessions {
+		pb := &authpb.Session{
+			Id:          sess.ID,
+			UserAgent:   sess.Client.UserAgent,
+			Ip:          sess.Client.IP,
+			DeviceLabel: sess.Client.DeviceLabel,
+			CreatedAt:   timestamppb.New(sess.CreatedAt),
+			Current:     sess.Current,
+		}
+		if !sess.LastRefreshedAt.IsZero() {
+			pb.LastRefreshedAt = timestamppb.New(sess.LastRefreshedAt)
+		}
+		out.Sessions = append(out.Sessions, pb)
+	}
+	return out, nil
+}
+
+func (s *AuthServer) RevokeSession(
+	ctx context.Context,
+	req *authpb.RevokeSessionRequest,
+) (*emptypb.Empty, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sessionsUC.Revoke(ctx, res.UserID, req.SessionId)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrSessionNotFound):
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) LogoutAll(
+	ctx context.Context,
+	_ *emptypb.Empty,
+) (*emptypb.Empty, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.logoutUC.LogoutAll(ctx, res.UserID); err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+	return &emptypb.Empty{}, nil
+}
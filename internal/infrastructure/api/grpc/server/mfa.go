@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	authpb "github.com/ParkieV/auth-service/internal/infrastructure/api/grpc"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func (s *AuthServer) VerifyMFA(
+	ctx context.Context,
+	req *authpb.VerifyMFARequest,
+) (*authpb.LoginResponse, error) {
+	at, rt, err := s.loginUC.VerifyMFA(ctx, req.MfaToken, req.Code, clientInfo(ctx, req.DeviceLabel))
+	switch {
+	case err == nil:
+		return &authpb.LoginResponse{Jwt: at, RefreshToken: rt}, nil
+	case errors.Is(err, usecase.ErrInvalidMFAToken),
+		errors.Is(err, domain.ErrInvalidOTP):
+		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) EnrollTOTP(
+	ctx context.Context,
+	_ *emptypb.Empty,
+) (*authpb.EnrollTOTPResponse, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enr, err := s.mfaUC.EnrollTOTP(ctx, res.UserID)
+	switch {
+	case err == nil:
+		return &authpb.EnrollTOTPResponse{Secret: enr.Secret, OtpauthUri: enr.URI, QrCode: enr.QRCode}, nil
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		return nil, status.Errorf(codes.AlreadyExists, err.Error())
+	case errors.Is(err, usecase.ErrUserNotFound):
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) ConfirmTOTP(
+	ctx context.Context,
+	req *authpb.TOTPCodeRequest,
+) (*authpb.ConfirmTOTPResponse, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recovery, err := s.mfaUC.ConfirmTOTP(ctx, res.UserID, req.Code)
+	switch {
+	case err == nil:
+		return &authpb.ConfirmTOTPResponse{RecoveryCodes: recovery}, nil
+	case errors.Is(err, domain.ErrInvalidOTP):
+		return nil, status.Errorf(codes.PermissionDenied, err.Error())
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		return nil, status.Errorf(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) DisableTOTP(
+	ctx context.Context,
+	req *authpb.TOTPCodeRequest,
+) (*emptypb.Empty, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mfaUC.DisableTOTP(ctx, res.UserID, req.Code)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrInvalidOTP):
+		return nil, status.Errorf(codes.PermissionDenied, err.Error())
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	authpb "github.com/ParkieV/auth-service/internal/infrastructure/api/grpc"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func (s *AuthServer) RequestEmailLogin(
+	ctx context.Context,
+	req *authpb.RequestEmailLoginRequest,
+) (*emptypb.Empty, error) {
+	err := s.passwordlessUC.RequestLogin(ctx, req.Email)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrInvalidEmail):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) LoginWithLink(
+	ctx context.Context,
+	req *authpb.LoginWithLinkRequest,
+) (*authpb.LoginResponse, error) {
+	at, rt, err := s.passwordlessUC.LoginWithLink(ctx, req.Token, clientInfo(ctx, req.DeviceLabel))
+	return passwordlessResult(at, rt, err)
+}
+
+func (s *AuthServer) LoginWithCode(
+	ctx context.Context,
+	req *authpb.LoginWithCodeRequest,
+) (*authpb.LoginResponse, error) {
+	at, rt, err := s.passwordlessUC.LoginWithCode(ctx, req.Email, req.Code, clientInfo(ctx, req.DeviceLabel))
+	return passwordlessResult(at, rt, err)
+}
+
+func passwordlessResult(at, rt string, err error) (*authpb.LoginResponse, error) {
+	var challenge *usecase.MFAChallenge
+	switch {
+	case err == nil:
+		return &authpb.LoginResponse{Jwt: at, RefreshToken: rt}, nil
+	case errors.As(err, &challenge):
+		return &authpb.LoginResponse{MfaRequired: true, MfaToken: challenge.Token, MfaMethods: challenge.Methods}, nil
+	case errors.Is(err, domain.ErrInvalidEmail):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, usecase.ErrInvalidLoginCode):
+		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	case errors.Is(err, usecase.ErrAccountDisabled):
+		return nil, status.Errorf(codes.PermissionDenied, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
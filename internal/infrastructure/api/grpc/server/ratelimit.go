@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ParkieV/auth-service/internal/infrastructure/ratelimit"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+// RateLimitInterceptor charges each call to the bucket of its method's
+// policy and fails it with ResourceExhausted and a "retry-after" header
+// once the bucket is empty. A nil limiter lets everything through.
+//
+// User policies key on the subject of the bearer token and client policies
+// on the client authenticated by the "client-id" and "client-secret"
+// metadata; anything else is counted against the caller's IP.
+func RateLimitInterceptor(l ratelimit.Limiter, rules *ratelimit.Rules, verifyUC *usecase.VerifyUsecase, oauthUC *usecase.OAuthUsecase, log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if l == nil {
+			return handler(ctx, req)
+		}
+		p, ok := rules.For(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		kind, subject := rateLimitSubject(ctx, verifyUC, oauthUC, p.Key)
+		d, err := l.Allow(ctx, ratelimit.BucketKey(p, kind, subject), p)
+		if err != nil {
+			// fail open: an unavailable limiter must not take the API down
+			log.Error("rate limit check failed", "policy", p.Name, "err", err)
+			return handler(ctx, req)
+		}
+		if !d.Allowed {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(d.RetryAfterSeconds())))
+			return nil, status.Errorf(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rateLimitSubject picks who the call is counted against. Calls without a
+// valid token or a client id fall back to their IP.
+func rateLimitSubject(ctx context.Context, verifyUC *usecase.VerifyUsecase, oauthUC *usecase.OAuthUsecase, key string) (string, string) {
+	switch key {
+	case ratelimit.KeyUser:
+		if token := bearerToken(ctx); token != "" {
+			if res, err := verifyUC.Authenticate(ctx, token); err == nil {
+				return ratelimit.KeyUser, res.UserID
+			}
+		}
+	case ratelimit.KeyClient:
+		md, _ := metadata.FromIncomingContext(ctx)
+		ids, secrets := md.Get("client-id"), md.Get("client-secret")
+		if len(ids) > 0 && len(secrets) > 0 && oauthUC.IsClient(ids[0], secrets[0]) {
+			return ratelimit.KeyClient, ids[0]
+		}
+	}
+	return ratelimit.KeyIP, clientInfo(ctx, "").IP
+}
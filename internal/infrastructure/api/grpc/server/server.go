@@ -14,6 +14,16 @@ func RegisterGRPC(
 	refreshUC *usecase.RefreshUsecase,
 	logoutUC *usecase.LogoutUsecase,
 	verifyUC *usecase.VerifyUsecase,
+	confirmUC *usecase.ConfirmEmailUsecase,
+	resendUC *usecase.ResendConfirmationUsecase,
+	resetUC *usecase.PasswordResetUsecase,
+	changeUC *usecase.ChangePasswordUsecase,
+	sessionsUC *usecase.SessionsUsecase,
+	mfaUC *usecase.MFAUsecase,
+	webauthnUC *usecase.WebAuthnUsecase,
+	passwordlessUC *usecase.PasswordlessUsecase,
+	adminUC *usecase.AdminUsecase,
 ) {
-	authpb.RegisterAuthServiceServer(s, NewAuthServer(registerUC, loginUC, refreshUC, logoutUC, verifyUC))
+	authpb.RegisterAuthServiceServer(s, NewAuthServer(registerUC, loginUC, refreshUC, logoutUC, verifyUC, confirmUC, resendUC, resetUC, changeUC, sessionsUC, mfaUC, webauthnUC, passwordlessUC))
+	authpb.RegisterAdminServiceServer(s, NewAdminServer(verifyUC, adminUC))
 }
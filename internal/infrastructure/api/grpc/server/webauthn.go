@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	authpb "github.com/ParkieV/auth-service/internal/infrastructure/api/grpc"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func (s *AuthServer) BeginWebAuthnLogin(
+	ctx context.Context,
+	_ *emptypb.Empty,
+) (*authpb.WebAuthnOptionsResponse, error) {
+	session, options, err := s.webauthnUC.BeginLogin(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+	return &authpb.WebAuthnOptionsResponse{Session: session, Options: string(options)}, nil
+}
+
+func (s *AuthServer) FinishWebAuthnLogin(
+	ctx context.Context,
+	req *authpb.FinishWebAuthnLoginRequest,
+) (*authpb.LoginResponse, error) {
+	at, rt, err := s.webauthnUC.FinishLogin(ctx, req.Session, []byte(req.Credential), clientInfo(ctx, req.DeviceLabel))
+	switch {
+	case err == nil:
+		return &authpb.LoginResponse{Jwt: at, RefreshToken: rt}, nil
+	case errors.Is(err, usecase.ErrInvalidWebAuthnSession),
+		errors.Is(err, usecase.ErrWebAuthnFailed):
+		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	case errors.Is(err, usecase.ErrNotConfirmed):
+		return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, usecase.ErrAccountDisabled):
+		return nil, status.Errorf(codes.PermissionDenied, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) BeginWebAuthnMFA(
+	ctx context.Context,
+	req *authpb.BeginWebAuthnMFARequest,
+) (*authpb.WebAuthnOptionsResponse, error) {
+	options, err := s.webauthnUC.BeginMFA(ctx, req.MfaToken)
+	switch {
+	case err == nil:
+		return &authpb.WebAuthnOptionsResponse{Options: string(options)}, nil
+	case errors.Is(err, usecase.ErrInvalidMFAToken):
+		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) VerifyWebAuthnMFA(
+	ctx context.Context,
+	req *authpb.VerifyWebAuthnMFARequest,
+) (*authpb.LoginResponse, error) {
+	at, rt, err := s.webauthnUC.VerifyMFA(ctx, req.MfaToken, []byte(req.Credential), clientInfo(ctx, req.DeviceLabel))
+	switch {
+	case err == nil:
+		return &authpb.LoginResponse{Jwt: at, RefreshToken: rt}, nil
+	case errors.Is(err, usecase.ErrInvalidMFAToken),
+		errors.Is(err, usecase.ErrInvalidWebAuthnSession),
+		errors.Is(err, usecase.ErrWebAuthnFailed):
+		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) BeginWebAuthnRegistration(
+	ctx context.Context,
+	_ *emptypb.Empty,
+) (*authpb.WebAuthnOptionsResponse, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := s.webauthnUC.BeginRegistration(ctx, res.UserID)
+	switch {
+	case err == nil:
+		return &authpb.WebAuthnOptionsResponse{Options: string(options)}, nil
+	case errors.Is(err, usecase.ErrUserNotFound):
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) FinishWebAuthnRegistration(
+	ctx context.Context,
+	req *authpb.FinishWebAuthnRegistrationRequest,
+) (*authpb.WebAuthnCredential, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := s.webauthnUC.FinishRegistration(ctx, res.UserID, req.Name, []byte(req.Credential))
+	switch {
+	case err == nil:
+		return webauthnCredentialToPB(cred), nil
+	case errors.Is(err, usecase.ErrInvalidWebAuthnSession),
+		errors.Is(err, usecase.ErrWebAuthnFailed):
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrCredentialExists):
+		return nil, status.Errorf(codes.AlreadyExists, err.Error())
+	case errors.Is(err, usecase.ErrUserNotFound):
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func (s *AuthServer) ListWebAuthnCredentials(
+	ctx context.Context,
+	_ *emptypb.Empty,
+) (*authpb.ListWebAuthnCredentialsResponse, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.webauthnUC.ListCredentials(ctx, res.UserID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+	out := &authpb.ListWebAuthnCredentialsResponse{}
+	for i := range creds {
+		out.Credentials = append(out.Credentials, webauthnCredentialToPB(&creds[i]))
+	}
+	return out, nil
+}
+
+func (s *AuthServer) DeleteWebAuthnCredential(
+	ctx context.Context,
+	req *authpb.DeleteWebAuthnCredentialRequest,
+) (*emptypb.Empty, error) {
+	res, _, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.webauthnUC.DeleteCredential(ctx, res.UserID, req.Id)
+	switch {
+	case err == nil:
+		return &emptypb.Empty{}, nil
+	case errors.Is(err, domain.ErrCredentialNotFound):
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func webauthnCredentialToPB(c *domain.WebAuthnCredential) *authpb.WebAuthnCredential {
+	out := &authpb.WebAuthnCredential{
+		Id:         c.EncodedID(),
+		Name:       c.Name,
+		Transports: c.Transports,
+		CreatedAt:  timestamppb.New(c.CreatedAt),
+	}
+	if !c.LastUsedAt.IsZero() {
+		out.LastUsedAt = timestamppb.New(c.LastUsedAt)
+	}
+	return out
+}
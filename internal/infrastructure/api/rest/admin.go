@@ -0,0 +1,287 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+type listUsersRequest struct {
+	Query  string `form:"q"`
+	Limit  int    `form:"limit"  binding:"min=0,max=200"`
+	Offset int    `form:"offset" binding:"min=0"`
+}
+
+type adminUserResponse struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Confirmed  bool       `json:"confirmed"`
+	Disabled   bool       `json:"disabled"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	Roles      []string   `json:"roles,omitempty"`
+}
+
+func newAdminUserResponse(u *domain.User) adminUserResponse {
+	resp := adminUserResponse{
+		ID:        u.ID(),
+		Email:     u.Email().String(),
+		Confirmed: u.IsConfirmed(),
+		Disabled:  u.IsDisabled(),
+		CreatedAt: u.CreatedAt(),
+	}
+	if u.IsDisabled() {
+		disabledAt := u.DisabledAt()
+		resp.DisabledAt = &disabledAt
+	}
+	return resp
+}
+
+func (h *Handler) adminListUsers(c *gin.Context) {
+	var req listUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.adminUC.ListUsers(c.Request.Context(), req.Query, req.Limit, req.Offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	out := make([]adminUserResponse, 0, len(page.Users))
+	for _, u := range page.Users {
+		out = append(out, newAdminUserResponse(u))
+	}
+	c.JSON(http.StatusOK, gin.H{"users": out, "total": page.Total})
+}
+
+func (h *Handler) adminGetUser(c *gin.Context) {
+	details, err := h.adminUC.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	resp := newAdminUserResponse(details.User)
+	resp.Roles = details.Roles
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) adminDisableUser(c *gin.Context) {
+	adminResult(c, h.adminUC.Disable(c.Request.Context(), c.GetString(ctxUserID), c.Param("id")))
+}
+
+func (h *Handler) adminEnableUser(c *gin.Context) {
+	adminResult(c, h.adminUC.Enable(c.Request.Context(), c.GetString(ctxUserID), c.Param("id")))
+}
+
+func (h *Handler) adminConfirmUser(c *gin.Context) {
+	adminResult(c, h.adminUC.Confirm(c.Request.Context(), c.GetString(ctxUserID), c.Param("id")))
+}
+
+func (h *Handler) adminResetPassword(c *gin.Context) {
+	adminResult(c, h.adminUC.ForcePasswordReset(c.Request.Context(), c.GetString(ctxUserID), c.Param("id")))
+}
+
+func (h *Handler) adminDeleteUser(c *gin.Context) {
+	adminResult(c, h.adminUC.Delete(c.Request.Context(), c.GetString(ctxUserID), c.Param("id")))
+}
+
+func (h *Handler) adminRevokeSessions(c *gin.Context) {
+	adminResult(c, h.adminUC.RevokeSessions(c.Request.Context(), c.GetString(ctxUserID), c.Param("id")))
+}
+
+type roleResponse struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Permissions []string   `json:"permissions"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+func newRoleResponse(r *domain.Role) roleResponse {
+	perms := r.Permissions
+	if perms == nil {
+		perms = []string{}
+	}
+	resp := roleResponse{Name: r.Name, Description: r.Description, Permissions: perms}
+	if !r.CreatedAt.IsZero() {
+		createdAt := r.CreatedAt
+		resp.CreatedAt = &createdAt
+	}
+	return resp
+}
+
+type createRoleRequest struct {
+	Name        string   `json:"name"        binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type setRolePermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type assignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (h *Handler) adminListRoles(c *gin.Context) {
+	roles, err := h.adminUC.ListRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	out := make([]roleResponse, 0, len(roles))
+	for i := range roles {
+		out = append(out, newRoleResponse(&roles[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": out})
+}
+
+func (h *Handler) adminListPermissions(c *gin.Context) {
+	perms, err := h.adminUC.ListPermissions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	type permissionResponse struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+	}
+	out := make([]permissionResponse, 0, len(perms))
+	for _, p := range perms {
+		out = append(out, permissionResponse{Name: p.Name, Description: p.Description})
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": out})
+}
+
+func (h *Handler) adminCreateRole(c *gin.Context) {
+	var req createRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := h.adminUC.CreateRole(c.Request.Context(), c.GetString(ctxUserID), req.Name, req.Description, req.Permissions)
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, newRoleResponse(role))
+}
+
+func (h *Handler) adminSetRolePermissions(c *gin.Context) {
+	var req setRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminResult(c, h.adminUC.SetRolePermissions(c.Request.Context(), c.GetString(ctxUserID), c.Param("name"), req.Permissions))
+}
+
+func (h *Handler) adminDeleteRole(c *gin.Context) {
+	adminResult(c, h.adminUC.DeleteRole(c.Request.Context(), c.GetString(ctxUserID), c.Param("name")))
+}
+
+func (h *Handler) adminAssignRole(c *gin.Context) {
+	var req assignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminResult(c, h.adminUC.AssignRole(c.Request.Context(), c.GetString(ctxUserID), c.Param("id"), req.Role))
+}
+
+func (h *Handler) adminUnassignRole(c *gin.Context) {
+	adminResult(c, h.adminUC.UnassignRole(c.Request.Context(), c.GetString(ctxUserID), c.Param("id"), c.Param("role")))
+}
+
+type auditLogRequest struct {
+	UserID string    `form:"user_id"`
+	From   time.Time `form:"from"   time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to"     time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `form:"limit"  binding:"min=0,max=1000"`
+	Offset int       `form:"offset" binding:"min=0"`
+}
+
+type auditEventResponse struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	ActorID    string    `json:"actor_id,omitempty"`
+	UserID     string    `json:"user_id,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Action     string    `json:"action"`
+	Outcome    string    `json:"outcome"`
+	Detail     string    `json:"detail,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+func (h *Handler) adminAuditLog(c *gin.Context) {
+	var req auditLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := h.adminUC.AuditLog(c.Request.Context(), domain.AuditQuery{
+		UserID: req.UserID,
+		From:   req.From,
+		To:     req.To,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if errors.Is(err, domain.ErrInvalidAuditQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	out := make([]auditEventResponse, 0, len(events))
+	for _, e := range events {
+		out = append(out, auditEventResponse{
+			ID:         e.ID,
+			OccurredAt: e.OccurredAt,
+			ActorID:    e.ActorID,
+			UserID:     e.UserID,
+			Email:      e.Email,
+			Action:     e.Action,
+			Outcome:    e.Outcome,
+			Detail:     e.Detail,
+			IP:         e.IP,
+			UserAgent:  e.UserAgent,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"events": out})
+}
+
+func adminResult(c *gin.Context, err error) {
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func adminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrAlreadyConfirmed), errors.Is(err, domain.ErrRoleExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrInvalidRoleName), errors.Is(err, domain.ErrPermissionNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrSelfAction), errors.Is(err, usecase.ErrProtectedRole):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
@@ -4,17 +4,30 @@ import (
 	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ParkieV/auth-service/internal/domain"
 	"github.com/ParkieV/auth-service/internal/usecase"
 )
 
 type Handler struct {
-	registerUC *usecase.RegisterUsecase
-	loginUC    *usecase.LoginUsecase
-	refreshUC  *usecase.RefreshUsecase
-	logoutUC   *usecase.LogoutUsecase
-	verifyUC   *usecase.VerifyUsecase
+	registerUC     *usecase.RegisterUsecase
+	loginUC        *usecase.LoginUsecase
+	refreshUC      *usecase.RefreshUsecase
+	logoutUC       *usecase.LogoutUsecase
+	verifyUC       *usecase.VerifyUsecase
+	confirmUC      *usecase.ConfirmEmailUsecase
+	resendUC       *usecase.ResendConfirmationUsecase
+	resetUC        *usecase.PasswordResetUsecase
+	changeUC       *usecase.ChangePasswordUsecase
+	jwksUC         *usecase.JWKSUsecase
+	sessionsUC     *usecase.SessionsUsecase
+	oauthUC        *usecase.OAuthUsecase
+	mfaUC          *usecase.MFAUsecase
+	webauthnUC     *usecase.WebAuthnUsecase
+	passwordlessUC *usecase.PasswordlessUsecase
+	adminUC        *usecase.AdminUsecase
 }
 
 func RegisterHandlers(
@@ -24,16 +37,91 @@ func RegisterHandlers(
 	refreshUC *usecase.RefreshUsecase,
 	logoutUC *usecase.LogoutUsecase,
 	verifyUC *usecase.VerifyUsecase,
+	confirmUC *usecase.ConfirmEmailUsecase,
+	resendUC *usecase.ResendConfirmationUsecase,
+	resetUC *usecase.PasswordResetUsecase,
+	changeUC *usecase.ChangePasswordUsecase,
+	jwksUC *usecase.JWKSUsecase,
+	sessionsUC *usecase.SessionsUsecase,
+	oauthUC *usecase.OAuthUsecase,
+	mfaUC *usecase.MFAUsecase,
+	webauthnUC *usecase.WebAuthnUsecase,
+	passwordlessUC *usecase.PasswordlessUsecase,
+	adminUC *usecase.AdminUsecase,
+	rateLimit gin.HandlerFunc,
 ) {
-	h := &Handler{registerUC, loginUC, refreshUC, logoutUC, verifyUC}
+	h := &Handler{registerUC, loginUC, refreshUC, logoutUC, verifyUC, confirmUC, resendUC, resetUC, changeUC, jwksUC, sessionsUC, oauthUC, mfaUC, webauthnUC, passwordlessUC, adminUC}
 
-	api := r.Group("/api")
+	r.Use(withClient)
+
+	r.GET("/.well-known/jwks.json", rateLimit, h.jwks)
+
+	oauth := r.Group("/oauth", rateLimit)
+	{
+		oauth.POST("/introspect", h.introspect)
+		oauth.POST("/revoke", h.revoke)
+	}
+
+	api := r.Group("/api", rateLimit)
 	{
 		api.POST("/register", h.register)
 		api.POST("/login", h.login)
+		api.POST("/login/mfa", h.verifyMFA)
+		api.POST("/login/mfa/webauthn/begin", h.beginWebAuthnMFA)
+		api.POST("/login/mfa/webauthn", h.verifyWebAuthnMFA)
+		api.POST("/login/webauthn/begin", h.beginWebAuthnLogin)
+		api.POST("/login/webauthn", h.finishWebAuthnLogin)
+		api.POST("/login/email", h.requestEmailLogin)
+		api.POST("/login/email/link", h.loginWithLink)
+		api.POST("/login/email/code", h.loginWithCode)
 		api.POST("/refresh", h.refresh)
 		api.POST("/logout", h.logout)
 		api.POST("/verify", h.verify)
+		api.POST("/confirm", h.confirm)
+		api.POST("/confirm/resend", h.resendConfirmation)
+		api.POST("/password/forgot", h.forgotPassword)
+		api.POST("/password/reset", h.resetPassword)
+	}
+
+	// limited before authentication so floods of bad tokens are throttled
+	authed := r.Group("/api", rateLimit, h.requireAuth)
+	{
+		authed.POST("/password/change", h.changePassword)
+		authed.GET("/sessions", h.listSessions)
+		authed.DELETE("/sessions/:id", h.revokeSession)
+		authed.POST("/logout/all", h.logoutAll)
+		authed.POST("/mfa/totp", h.enrollTOTP)
+		authed.POST("/mfa/totp/confirm", h.confirmTOTP)
+		authed.POST("/mfa/totp/disable", h.disableTOTP)
+		authed.POST("/webauthn/register/begin", h.beginWebAuthnRegistration)
+		authed.POST("/webauthn/register", h.finishWebAuthnRegistration)
+		authed.GET("/webauthn/credentials", h.listWebAuthnCredentials)
+		authed.DELETE("/webauthn/credentials/:id", h.deleteWebAuthnCredential)
+	}
+
+	admin := r.Group("/admin", rateLimit, h.requireAuth)
+	{
+		usersRead := h.requirePermission(domain.PermUsersRead)
+		usersWrite := h.requirePermission(domain.PermUsersWrite)
+		rolesRead := h.requirePermission(domain.PermRolesRead)
+		rolesWrite := h.requirePermission(domain.PermRolesWrite)
+
+		admin.GET("/users", usersRead, h.adminListUsers)
+		admin.GET("/users/:id", usersRead, h.adminGetUser)
+		admin.DELETE("/users/:id", usersWrite, h.adminDeleteUser)
+		admin.POST("/users/:id/disable", usersWrite, h.adminDisableUser)
+		admin.POST("/users/:id/enable", usersWrite, h.adminEnableUser)
+		admin.POST("/users/:id/confirm", usersWrite, h.adminConfirmUser)
+		admin.POST("/users/:id/password/reset", usersWrite, h.adminResetPassword)
+		admin.DELETE("/users/:id/sessions", usersWrite, h.adminRevokeSessions)
+		admin.POST("/users/:id/roles", rolesWrite, h.adminAssignRole)
+		admin.DELETE("/users/:id/roles/:role", rolesWrite, h.adminUnassignRole)
+		admin.GET("/roles", rolesRead, h.adminListRoles)
+		admin.POST("/roles", rolesWrite, h.adminCreateRole)
+		admin.PUT("/roles/:name/permissions", rolesWrite, h.adminSetRolePermissions)
+		admin.DELETE("/roles/:name", rolesWrite, h.adminDeleteRole)
+		admin.GET("/permissions", rolesRead, h.adminListPermissions)
+		admin.GET("/audit", usersRead, h.adminAuditLog)
 	}
 }
 
@@ -66,12 +154,16 @@ func (h *Handler) register(c *gin.Context) {
 }
 
 type loginRequest struct {
-	Email    string `json:"email"    binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Email       string `json:"email"        binding:"required,email"`
+	Password    string `json:"password"     binding:"required,min=8"`
+	DeviceLabel string `json:"device_label" binding:"max=100"`
 }
 type loginResponse struct {
-	JWT          string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	JWT          string   `json:"access_token,omitempty"`
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	MFARequired  bool     `json:"mfa_required,omitempty"`
+	MFAToken     string   `json:"mfa_token,omitempty"`
+	MFAMethods   []string `json:"mfa_methods,omitempty"`
 }
 
 func (h *Handler) login(c *gin.Context) {
@@ -81,11 +173,19 @@ func (h *Handler) login(c *gin.Context) {
 		return
 	}
 
-	at, rt, err := h.loginUC.Login(c.Request.Context(), req.Email, req.Password)
+	at, rt, err := h.loginUC.Login(c.Request.Context(), req.Email, req.Password, clientInfo(c, req.DeviceLabel))
+	var challenge *usecase.MFAChallenge
+	var locked *usecase.LockedError
 	switch {
 	case err == nil:
 		c.JSON(http.StatusOK, loginResponse{JWT: at, RefreshToken: rt})
-	case errors.Is(err, usecase.ErrNotConfirmed):
+	case errors.As(err, &challenge):
+		c.JSON(http.StatusOK, loginResponse{MFARequired: true, MFAToken: challenge.Token, MFAMethods: challenge.Methods})
+	case errors.As(err, &locked):
+		c.Header("Retry-After", strconv.Itoa(locked.RetryAfterSeconds()))
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrNotConfirmed),
+		errors.Is(err, usecase.ErrAccountDisabled):
 		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 	case errors.Is(err, usecase.ErrUserNotFound),
 		errors.Is(err, usecase.ErrInvalidCredentials):
@@ -139,11 +239,22 @@ func (h *Handler) logout(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func (h *Handler) logoutAll(c *gin.Context) {
+	if err := h.logoutUC.LogoutAll(c.Request.Context(), c.GetString(ctxUserID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 type verifyRequest struct {
 	Token string `json:"access_token" binding:"required"`
 }
 type verifyResponse struct {
-	UserID string `json:"user_id"`
+	UserID string   `json:"user_id"`
+	Active bool     `json:"active"`
+	Scope  []string `json:"scope"`
+	Roles  []string `json:"roles"`
 }
 
 func (h *Handler) verify(c *gin.Context) {
@@ -156,10 +267,190 @@ func (h *Handler) verify(c *gin.Context) {
 	res, err := h.verifyUC.Verify(c.Request.Context(), req.Token)
 	switch {
 	case err == nil && res.Active:
-		c.JSON(http.StatusOK, verifyResponse{UserID: res.UserID})
+		c.JSON(http.StatusOK, verifyResponse{UserID: res.UserID, Active: res.Active, Scope: res.Scope, Roles: res.Roles})
 	case errors.Is(err, usecase.ErrTokenInvalid):
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
 	}
 }
+
+type confirmRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code"  binding:"required"`
+}
+
+func (h *Handler) confirm(c *gin.Context) {
+	var req confirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.confirmUC.Confirm(c.Request.Context(), req.Email, req.Code)
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case errors.Is(err, domain.ErrInvalidEmail),
+		errors.Is(err, domain.ErrInvalidConfirmationCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrConfirmationExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrAlreadyConfirmed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type resendConfirmationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (h *Handler) resendConfirmation(c *gin.Context) {
+	var req resendConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.resendUC.Resend(c.Request.Context(), req.Email)
+	switch {
+	case err == nil:
+		c.Status(http.StatusAccepted)
+	case errors.Is(err, domain.ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrTooManyRequests):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (h *Handler) forgotPassword(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.resetUC.RequestReset(c.Request.Context(), req.Email)
+	switch {
+	case err == nil:
+		c.Status(http.StatusAccepted)
+	case errors.Is(err, domain.ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"    binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+func (h *Handler) resetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.resetUC.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case errors.Is(err, domain.ErrInvalidPassword),
+		errors.Is(err, usecase.ErrInvalidResetToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type changePasswordRequest struct {
+	CurrentPassword     string `json:"current_password"      binding:"required"`
+	NewPassword         string `json:"new_password"          binding:"required,min=8"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+}
+
+func (h *Handler) changePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.changeUC.ChangePassword(c.Request.Context(),
+		c.GetString(ctxUserID), c.GetString(ctxAccessToken),
+		req.CurrentPassword, req.NewPassword, req.RevokeOtherSessions)
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case errors.Is(err, domain.ErrInvalidPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidCredentials):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+func (h *Handler) jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwksUC.KeySet())
+}
+
+type sessionResponse struct {
+	ID              string     `json:"id"`
+	UserAgent       string     `json:"user_agent"`
+	IP              string     `json:"ip"`
+	DeviceLabel     string     `json:"device_label"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+	Current         bool       `json:"current"`
+}
+
+func (h *Handler) listSessions(c *gin.Context) {
+	sessions, err := h.sessionsUC.List(c.Request.Context(), c.GetString(ctxUserID), c.GetString(ctxAccessToken))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	out := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp := sessionResponse{
+			ID:          s.ID,
+			UserAgent:   s.Client.UserAgent,
+			IP:          s.Client.IP,
+			DeviceLabel: s.Client.DeviceLabel,
+			CreatedAt:   s.CreatedAt,
+			Current:     s.Current,
+		}
+		if !s.LastRefreshedAt.IsZero() {
+			resp.LastRefreshedAt = &s.LastRefreshedAt
+		}
+		out = append(out, resp)
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+func (h *Handler) revokeSession(c *gin.Context) {
+	err := h.sessionsUC.Revoke(c.Request.Context(), c.GetString(ctxUserID), c.Param("id"))
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case errors.Is(err, domain.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+type verifyMFARequest struct {
+	MFAToken    string `json:"mfa_token"    binding:"required"`
+	Code        string `json:"code"         binding:"required"`
+	DeviceLabel string `json:"device_label" binding:"max=100"`
+}
+
+func (h *Handler) verifyMFA(c *gin.Context) {
+	var req verifyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	at, rt, err := h.loginUC.VerifyMFA(c.Request.Context(), req.MFAToken, req.Code, clientInfo(c, req.DeviceLabel))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, loginResponse{JWT: at, RefreshToken: rt})
+	case errors.Is(err, usecase.ErrInvalidMFAToken),
+		errors.Is(err, domain.ErrInvalidOTP):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type enrollTOTPResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"`
+}
+
+func (h *Handler) enrollTOTP(c *gin.Context) {
+	res, err := h.mfaUC.EnrollTOTP(c.Request.Context(), c.GetString(ctxUserID))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, enrollTOTPResponse{Secret: res.Secret, OtpauthURI: res.URI, QRCode: res.QRCode})
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+type confirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *Handler) confirmTOTP(c *gin.Context) {
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaUC.ConfirmTOTP(c.Request.Context(), c.GetString(ctxUserID), req.Code)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, confirmTOTPResponse{RecoveryCodes: codes})
+	case errors.Is(err, domain.ErrInvalidOTP):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+func (h *Handler) disableTOTP(c *gin.Context) {
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.mfaUC.DisableTOTP(c.Request.Context(), c.GetString(ctxUserID), req.Code)
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case errors.Is(err, domain.ErrInvalidOTP):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
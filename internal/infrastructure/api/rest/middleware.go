@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+const (
+	ctxUserID      = "user_id"
+	ctxAccessToken = "access_token"
+	ctxRoles       = "roles"
+	ctxPermissions = "permissions"
+)
+
+// NewRouter returns an engine that believes X-Forwarded-For only from
+// trustedProxies; any other client could pick its own address and dodge
+// the per-IP rate limits and lockouts.
+func NewRouter(trustedProxies []string) (*gin.Engine, error) {
+	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// withClient hands the caller's address and user agent to the usecases
+// for the audit log, and its language for the emails they send.
+func withClient(c *gin.Context) {
+	c.Request = c.Request.WithContext(usecase.WithClient(c.Request.Context(), clientInfo(c, "")))
+	c.Next()
+}
+
+// clientInfo describes the caller. Its IP keys the login lockout, so it
+// comes from c.ClientIP, which believes X-Forwarded-For only from the
+// proxies NewRouter trusts.
+func clientInfo(c *gin.Context, deviceLabel string) domain.ClientInfo {
+	return domain.ClientInfo{
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		Language:    c.GetHeader("Accept-Language"),
+		DeviceLabel: deviceLabel,
+	}
+}
+
+func (h *Handler) requireAuth(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+		return
+	}
+
+	res, err := h.verifyUC.Authenticate(c.Request.Context(), token)
+	if err != nil || !res.Active {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token invalid or expired"})
+		return
+	}
+
+	c.Set(ctxUserID, res.UserID)
+	c.Set(ctxAccessToken, token)
+	c.Set(ctxRoles, res.Roles)
+	c.Set(ctxPermissions, res.Scope)
+	c.Next()
+}
+
+// requirePermission runs after requireAuth and checks that the roles and
+// scope of the access token grant permission.
+func (h *Handler) requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		access := domain.Access{Roles: c.GetStringSlice(ctxRoles), Permissions: c.GetStringSlice(ctxPermissions)}
+		if err := h.adminUC.Authorize(access, permission); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
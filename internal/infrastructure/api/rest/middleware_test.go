@@ -0,0 +1,31 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+func TestClientInfo_IgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r, err := NewRouter(nil)
+	require.NoError(t, err)
+	var got domain.ClientInfo
+	r.POST("/login", func(c *gin.Context) { got = clientInfo(c, "laptop") })
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("User-Agent", "curl/8.0")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the lockout counts failures per IP; a spoofed header must not move them
+	require.Equal(t, "192.0.2.1", got.IP)
+	require.Equal(t, "curl/8.0", got.UserAgent)
+	require.Equal(t, "laptop", got.DeviceLabel)
+}
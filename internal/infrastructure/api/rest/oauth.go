@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+// OAuth endpoints take form-encoded bodies and answer with RFC 6749 style
+// errors so off-the-shelf gateway plugins and client libraries work as is.
+
+type introspectRequest struct {
+	Token         string `form:"token"           binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+type introspectResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	JTI       string   `json:"jti,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+func (h *Handler) introspect(c *gin.Context) {
+	var req introspectRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	clientID, clientSecret := clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	info, err := h.oauthUC.Introspect(c.Request.Context(), clientID, clientSecret, req.Token, req.TokenTypeHint)
+	switch {
+	case err == nil && !info.Active:
+		c.JSON(http.StatusOK, introspectResponse{Active: false})
+	case err == nil:
+		c.JSON(http.StatusOK, introspectResponse{
+			Active:    true,
+			Scope:     strings.Join(info.Scope, " "),
+			ClientID:  info.ClientID,
+			TokenType: info.TokenType,
+			Exp:       info.ExpiresAt.Unix(),
+			Iat:       info.IssuedAt.Unix(),
+			Sub:       info.Subject,
+			JTI:       info.JTI,
+			Roles:     info.Roles,
+		})
+	case errors.Is(err, usecase.ErrInvalidClient):
+		invalidClient(c)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+	}
+}
+
+// clientCredentials prefers HTTP Basic (client_secret_basic) and falls back
+// to credentials in the form body (client_secret_post).
+func clientCredentials(c *gin.Context, formID, formSecret string) (string, string) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		return id, secret
+	}
+	return formID, formSecret
+}
+
+func invalidClient(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+}
+
+type revokeRequest struct {
+	Token         string `form:"token"           binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+func (h *Handler) revoke(c *gin.Context) {
+	var req revokeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	clientID, clientSecret := clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	err := h.oauthUC.Revoke(c.Request.Context(), clientID, clientSecret, req.Token, req.TokenTypeHint)
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, usecase.ErrInvalidClient):
+		invalidClient(c)
+	default:
+		// RFC 7009 lets the client retry later on 503
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "temporarily_unavailable"})
+	}
+}
@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+type requestEmailLoginRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (h *Handler) requestEmailLogin(c *gin.Context) {
+	var req requestEmailLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.passwordlessUC.RequestLogin(c.Request.Context(), req.Email)
+	switch {
+	case err == nil:
+		c.Status(http.StatusAccepted)
+	case errors.Is(err, domain.ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type loginWithLinkRequest struct {
+	Token       string `json:"token"        binding:"required"`
+	DeviceLabel string `json:"device_label" binding:"max=100"`
+}
+
+func (h *Handler) loginWithLink(c *gin.Context) {
+	var req loginWithLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	at, rt, err := h.passwordlessUC.LoginWithLink(c.Request.Context(), req.Token, clientInfo(c, req.DeviceLabel))
+	h.passwordlessResult(c, at, rt, err)
+}
+
+type loginWithCodeRequest struct {
+	Email       string `json:"email"        binding:"required,email"`
+	Code        string `json:"code"         binding:"required"`
+	DeviceLabel string `json:"device_label" binding:"max=100"`
+}
+
+func (h *Handler) loginWithCode(c *gin.Context) {
+	var req loginWithCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	at, rt, err := h.passwordlessUC.LoginWithCode(c.Request.Context(), req.Email, req.Code, clientInfo(c, req.DeviceLabel))
+	h.passwordlessResult(c, at, rt, err)
+}
+
+func (h *Handler) passwordlessResult(c *gin.Context, at, rt string, err error) {
+	var challenge *usecase.MFAChallenge
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, loginResponse{JWT: at, RefreshToken: rt})
+	case errors.As(err, &challenge):
+		c.JSON(http.StatusOK, loginResponse{MFARequired: true, MFAToken: challenge.Token, MFAMethods: challenge.Methods})
+	case errors.Is(err, domain.ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidLoginCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/ratelimit"
+)
+
+func newLimitedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rules, err := ratelimit.NewRules(config.RateLimitConfig{
+		Default: config.RateLimitPolicy{Rate: 1, Per: time.Minute, Burst: 1, Key: ratelimit.KeyIP},
+	})
+	require.NoError(t, err)
+	r, err := NewRouter(trustedProxies)
+	require.NoError(t, err)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r.Use(RateLimit(ratelimit.NewMemoryLimiter(), rules, nil, nil, log))
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return r
+}
+
+func get(r *gin.Engine, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimit_IgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	r := newLimitedRouter(t, nil)
+
+	require.Equal(t, http.StatusNoContent, get(r, "198.51.100.1"))
+	// a made-up address must not open a fresh bucket
+	require.Equal(t, http.StatusTooManyRequests, get(r, "198.51.100.2"))
+}
+
+func TestRateLimit_HonoursForwardedForFromTrustedProxy(t *testing.T) {
+	r := newLimitedRouter(t, []string{"192.0.2.1"})
+
+	require.Equal(t, http.StatusNoContent, get(r, "198.51.100.1"))
+	require.Equal(t, http.StatusNoContent, get(r, "198.51.100.2"))
+	require.Equal(t, http.StatusTooManyRequests, get(r, "198.51.100.1"))
+}
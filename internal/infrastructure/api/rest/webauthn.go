@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+// Ceremony options are passed through untouched: they are exactly what the
+// browser hands to navigator.credentials.create / get, and credential is
+// the PublicKeyCredential it returns, serialized with toJSON().
+
+type webauthnOptionsResponse struct {
+	Session string          `json:"session,omitempty"`
+	Options json.RawMessage `json:"options"`
+}
+
+type finishWebAuthnLoginRequest struct {
+	Session     string          `json:"session"      binding:"required"`
+	Credential  json.RawMessage `json:"credential"   binding:"required"`
+	DeviceLabel string          `json:"device_label" binding:"max=100"`
+}
+
+func (h *Handler) beginWebAuthnLogin(c *gin.Context) {
+	session, options, err := h.webauthnUC.BeginLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, webauthnOptionsResponse{Session: session, Options: options})
+}
+
+func (h *Handler) finishWebAuthnLogin(c *gin.Context) {
+	var req finishWebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	at, rt, err := h.webauthnUC.FinishLogin(c.Request.Context(), req.Session, req.Credential, clientInfo(c, req.DeviceLabel))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, loginResponse{JWT: at, RefreshToken: rt})
+	case errors.Is(err, usecase.ErrInvalidWebAuthnSession),
+		errors.Is(err, usecase.ErrWebAuthnFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrNotConfirmed),
+		errors.Is(err, usecase.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type beginWebAuthnMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+func (h *Handler) beginWebAuthnMFA(c *gin.Context) {
+	var req beginWebAuthnMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, err := h.webauthnUC.BeginMFA(c.Request.Context(), req.MFAToken)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, webauthnOptionsResponse{Options: options})
+	case errors.Is(err, usecase.ErrInvalidMFAToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type verifyWebAuthnMFARequest struct {
+	MFAToken    string          `json:"mfa_token"    binding:"required"`
+	Credential  json.RawMessage `json:"credential"   binding:"required"`
+	DeviceLabel string          `json:"device_label" binding:"max=100"`
+}
+
+func (h *Handler) verifyWebAuthnMFA(c *gin.Context) {
+	var req verifyWebAuthnMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	at, rt, err := h.webauthnUC.VerifyMFA(c.Request.Context(), req.MFAToken, req.Credential, clientInfo(c, req.DeviceLabel))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, loginResponse{JWT: at, RefreshToken: rt})
+	case errors.Is(err, usecase.ErrInvalidMFAToken),
+		errors.Is(err, usecase.ErrInvalidWebAuthnSession),
+		errors.Is(err, usecase.ErrWebAuthnFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+func (h *Handler) beginWebAuthnRegistration(c *gin.Context) {
+	options, err := h.webauthnUC.BeginRegistration(c.Request.Context(), c.GetString(ctxUserID))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, webauthnOptionsResponse{Options: options})
+	case errors.Is(err, usecase.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+type finishWebAuthnRegistrationRequest struct {
+	Name       string          `json:"name"       binding:"max=100"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+type webauthnCredentialResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newWebAuthnCredentialResponse(cred *domain.WebAuthnCredential) webauthnCredentialResponse {
+	resp := webauthnCredentialResponse{
+		ID:         cred.EncodedID(),
+		Name:       cred.Name,
+		Transports: cred.Transports,
+		CreatedAt:  cred.CreatedAt,
+	}
+	if !cred.LastUsedAt.IsZero() {
+		resp.LastUsedAt = &cred.LastUsedAt
+	}
+	return resp
+}
+
+func (h *Handler) finishWebAuthnRegistration(c *gin.Context) {
+	var req finishWebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cred, err := h.webauthnUC.FinishRegistration(c.Request.Context(), c.GetString(ctxUserID), req.Name, req.Credential)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusCreated, newWebAuthnCredentialResponse(cred))
+	case errors.Is(err, usecase.ErrInvalidWebAuthnSession),
+		errors.Is(err, usecase.ErrWebAuthnFailed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrCredentialExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+func (h *Handler) listWebAuthnCredentials(c *gin.Context) {
+	creds, err := h.webauthnUC.ListCredentials(c.Request.Context(), c.GetString(ctxUserID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	out := make([]webauthnCredentialResponse, 0, len(creds))
+	for i := range creds {
+		out = append(out, newWebAuthnCredentialResponse(&creds[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (h *Handler) deleteWebAuthnCredential(c *gin.Context) {
+	err := h.webauthnUC.DeleteCredential(c.Request.Context(), c.GetString(ctxUserID), c.Param("id"))
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case errors.Is(err, domain.ErrCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
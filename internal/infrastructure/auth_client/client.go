@@ -6,29 +6,86 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
 	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/go-jose/go-jose/v4"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+// Rotation describes the outcome of RotateRefresh. On ErrRefreshTokenReused
+// only UserID and FamilyID are set so the caller can revoke the family.
+// RefreshToken is set by backends that mint their own refresh tokens instead
+// of storing the one they were given.
+type Rotation struct {
+	UserID       string
+	FamilyID     string
+	AccessToken  string
+	RefreshToken string
+}
+
+// Token type hints as defined by RFC 7009 and RFC 7662.
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// TokenInfo is the introspection view of a token. Only Active is meaningful
+// when the token is unknown, expired or revoked.
+type TokenInfo struct {
+	Active    bool
+	TokenType string
+	Subject   string
+	ClientID  string
+	Scope     []string
+	Roles     []string
+	JTI       string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
 type AuthClient interface {
-	GenerateTokens(ctx context.Context, userID string) (string, string, error)
-	IssueAccessToken(ctx context.Context, userID string) (string, error)
-	VerifyAccess(ctx context.Context, accessToken string) (bool, string, error)
+	GenerateTokens(ctx context.Context, userID string, client domain.ClientInfo) (string, string, error)
+	Introspect(ctx context.Context, token, hint string) (TokenInfo, error)
 	Logout(ctx context.Context, refreshToken string) error
+	RevokeAll(ctx context.Context, userID string) error
+	RevokeOthers(ctx context.Context, userID, keepAccessToken string) ([]string, error)
+	RotateRefresh(ctx context.Context, oldRefresh, newRefresh string) (Rotation, error)
+	RevokeFamily(ctx context.Context, familyID string) ([]string, error)
+	RevokeToken(ctx context.Context, token, hint string) (string, []string, error)
+	ListSessions(ctx context.Context, userID, currentAccessToken string) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) ([]string, error)
 }
 
 type TokenRepository struct {
 	db         *sql.DB
-	hmacKey    []byte
+	roles      db.RoleRepository
+	keys       *KeyRing
 	ttl        time.Duration
 	refreshTTL time.Duration
+	clientID   string
 	log        *slog.Logger
 }
 
-func NewDBTokenRepository(pgCfg config.PostgresConfig, jwtCfg config.JWTConfig, log *slog.Logger) (*TokenRepository, error) { // db *sql.DB, hmacKey []byte, ttl, refreshTTL time.Duration, log *slog.Logger) *TokenRepository {
+type accessClaims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty string   `json:"azp,omitempty"`
+	Scope           string   `json:"scope,omitempty"`
+	Roles           []string `json:"roles,omitempty"`
+}
+
+// NewDBTokenRepository stores tokens in Postgres; roles supplies the roles
+// and permissions that go into access tokens.
+func NewDBTokenRepository(pgCfg config.PostgresConfig, jwtCfg config.JWTConfig, roles db.RoleRepository, log *slog.Logger) (*TokenRepository, error) {
 	dsn := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		pgCfg.Host, pgCfg.Port, pgCfg.User, pgCfg.Password, pgCfg.DBName, pgCfg.SSLMode,
@@ -41,59 +98,130 @@ func NewDBTokenRepository(pgCfg config.PostgresConfig, jwtCfg config.JWTConfig,
 		log.Error("Cannot connect to database", "error", err)
 		return nil, err
 	}
+	keys, err := newKeyRing(jwtCfg, log)
+	if err != nil {
+		log.Error("Cannot load signing keys", "error", err)
+		return nil, err
+	}
 	return &TokenRepository{
 		db:         db,
-		hmacKey:    jwtCfg.HmacKey(),
+		roles:      roles,
+		keys:       keys,
 		ttl:        jwtCfg.AccessTTL,
 		refreshTTL: jwtCfg.RefreshTTL,
+		clientID:   jwtCfg.ClientID,
 		log:        log,
 	}, nil
 }
 
-func (c *TokenRepository) GenerateTokens(ctx context.Context, userID string) (string, string, error) {
-	access, err := c.signJWT(userID)
+func (c *TokenRepository) GenerateTokens(ctx context.Context, userID string, client domain.ClientInfo) (string, string, error) {
+	access, err := c.issueJWT(ctx, userID)
 	if err != nil {
 		return "", "", err
 	}
 	refresh := uuid.NewString()
+	id := uuid.New()
 
-	const q = `
-        INSERT INTO tokens (id, user_id, access_token, refresh_token, expires_at)
-        VALUES ($1,$2,$3,$4,$5)`
-	_, err = c.db.ExecContext(ctx, q,
-		uuid.New(), userID, access, refresh, time.Now().Add(c.refreshTTL))
+	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
 		return "", "", err
 	}
+	defer tx.Rollback()
+
+	const qs = `
+        INSERT INTO sessions (id, user_id, user_agent, ip, device_label)
+        VALUES ($1,$2,$3,$4,$5)`
+	if _, err := tx.ExecContext(ctx, qs,
+		id, userID, client.UserAgent, client.IP, client.DeviceLabel); err != nil {
+		return "", "", err
+	}
+
+	const q = `
+        INSERT INTO tokens (id, family_id, user_id, access_token, refresh_token, expires_at)
+        VALUES ($1,$1,$2,$3,$4,$5)`
+	if _, err := tx.ExecContext(ctx, q,
+		id, userID, access, refresh, time.Now().Add(c.refreshTTL)); err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
 	return access, refresh, nil
 }
 
-func (c *TokenRepository) IssueAccessToken(ctx context.Context, userID string) (string, error) {
-	access, err := c.signJWT(userID)
-	if err != nil {
-		return "", err
+// Introspect reports unknown, expired and revoked tokens as inactive rather
+// than failing. hint only decides which kind of token is looked up first.
+func (c *TokenRepository) Introspect(ctx context.Context, token, hint string) (TokenInfo, error) {
+	lookups := []func(context.Context, string) (TokenInfo, error){c.introspectAccess, c.introspectRefresh}
+	if hint == TokenTypeRefresh {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+	for _, lookup := range lookups {
+		info, err := lookup(ctx, token)
+		if err != nil || info.Active {
+			return info, err
+		}
 	}
-	const q = `UPDATE tokens SET access_token = $1, expires_at = $2
-               WHERE user_id = $3 AND revoked_at IS NULL`
-	_, _ = c.db.ExecContext(ctx, q, access, time.Now().Add(c.refreshTTL), userID)
-	return access, nil
+	return TokenInfo{}, nil
 }
 
-func (c *TokenRepository) VerifyAccess(ctx context.Context, access string) (bool, string, error) {
+func (c *TokenRepository) introspectAccess(ctx context.Context, access string) (TokenInfo, error) {
 	claims, err := c.parseJWT(access)
 	if err != nil {
-		return false, "", err
+		return TokenInfo{}, nil
 	}
 	var revokedAt sql.NullTime
 	err = c.db.QueryRowContext(ctx,
 		`SELECT revoked_at FROM tokens WHERE access_token = $1`, access).Scan(&revokedAt)
-	if err != nil {
-		return false, "", err
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return TokenInfo{}, nil
+	case err != nil:
+		return TokenInfo{}, err
+	case revokedAt.Valid:
+		return TokenInfo{}, nil
+	}
+
+	info := TokenInfo{
+		Active:    true,
+		TokenType: TokenTypeAccess,
+		Subject:   claims.Subject,
+		ClientID:  claims.AuthorizedParty,
+		Scope:     strings.Fields(claims.Scope),
+		Roles:     claims.Roles,
+		JTI:       claims.ID,
 	}
-	if revokedAt.Valid {
-		return false, "", nil
+	if claims.IssuedAt != nil {
+		info.IssuedAt = claims.IssuedAt.Time
 	}
-	return true, claims.Subject, nil
+	if claims.ExpiresAt != nil {
+		info.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return info, nil
+}
+
+func (c *TokenRepository) introspectRefresh(ctx context.Context, refresh string) (TokenInfo, error) {
+	var (
+		info                  TokenInfo
+		revokedAt, consumedAt sql.NullTime
+	)
+	const q = `
+        SELECT id, user_id, created_at, expires_at, revoked_at, consumed_at
+        FROM tokens WHERE refresh_token = $1`
+	err := c.db.QueryRowContext(ctx, q, refresh).Scan(
+		&info.JTI, &info.Subject, &info.IssuedAt, &info.ExpiresAt, &revokedAt, &consumedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return TokenInfo{}, nil
+	case err != nil:
+		return TokenInfo{}, err
+	case revokedAt.Valid, consumedAt.Valid, !info.ExpiresAt.After(time.Now()):
+		return TokenInfo{}, nil
+	}
+	info.Active = true
+	info.TokenType = TokenTypeRefresh
+	info.ClientID = c.clientID
+	return info, nil
 }
 
 func (c *TokenRepository) Logout(ctx context.Context, refresh string) error {
@@ -102,22 +230,281 @@ func (c *TokenRepository) Logout(ctx context.Context, refresh string) error {
 	return err
 }
 
-func (c *TokenRepository) signJWT(userID string) (string, error) {
+func (c *TokenRepository) RevokeAll(ctx context.Context, userID string) error {
+	if _, err := c.db.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+	_, err := c.db.ExecContext(ctx,
+		`UPDATE tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
+
+// RevokeOthers ends every session of userID except the one keepAccess
+// belongs to, and returns the refresh tokens it revoked.
+func (c *TokenRepository) RevokeOthers(ctx context.Context, userID, keepAccess string) ([]string, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var keep uuid.NullUUID
+	err = tx.QueryRowContext(ctx,
+		`SELECT family_id FROM tokens WHERE access_token = $1 AND user_id = $2 LIMIT 1`,
+		keepAccess, userID).Scan(&keep)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = now()
+		  WHERE user_id = $1 AND id IS DISTINCT FROM $2 AND revoked_at IS NULL`, userID, keep); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`UPDATE tokens SET revoked_at = now()
+		  WHERE user_id = $1 AND family_id IS DISTINCT FROM $2 AND revoked_at IS NULL
+		  RETURNING refresh_token`, userID, keep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refresh []string
+	for rows.Next() {
+		var rt string
+		if err := rows.Scan(&rt); err != nil {
+			return nil, err
+		}
+		refresh = append(refresh, rt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return refresh, tx.Commit()
+}
+
+func (c *TokenRepository) RotateRefresh(ctx context.Context, oldRefresh, newRefresh string) (Rotation, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Rotation{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, familyID, userID  string
+		expiresAt             time.Time
+		consumedAt, revokedAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, family_id, user_id, expires_at, consumed_at, revoked_at
+		   FROM tokens WHERE refresh_token = $1 FOR UPDATE`, oldRefresh).
+		Scan(&id, &familyID, &userID, &expiresAt, &consumedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Rotation{}, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return Rotation{}, err
+	}
+	if consumedAt.Valid {
+		return Rotation{UserID: userID, FamilyID: familyID}, ErrRefreshTokenReused
+	}
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return Rotation{}, ErrRefreshTokenNotFound
+	}
+
+	access, err := c.issueJWT(ctx, userID)
+	if err != nil {
+		return Rotation{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE tokens SET consumed_at = now() WHERE id = $1`, id); err != nil {
+		return Rotation{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO tokens (id, family_id, parent_id, user_id, access_token, refresh_token, expires_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		uuid.New(), familyID, id, userID, access, newRefresh, time.Now().Add(c.refreshTTL)); err != nil {
+		return Rotation{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE sessions SET last_refreshed_at = now() WHERE id = $1`, familyID); err != nil {
+		return Rotation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Rotation{}, err
+	}
+	return Rotation{UserID: userID, FamilyID: familyID, AccessToken: access}, nil
+}
+
+func (c *TokenRepository) RevokeFamily(ctx context.Context, familyID string) ([]string, error) {
+	if _, err := c.db.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1`, familyID); err != nil {
+		return nil, err
+	}
+	rows, err := c.db.QueryContext(ctx,
+		`UPDATE tokens SET revoked_at = COALESCE(revoked_at, now())
+		  WHERE family_id = $1
+		  RETURNING refresh_token`, familyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refresh []string
+	for rows.Next() {
+		var rt string
+		if err := rows.Scan(&rt); err != nil {
+			return nil, err
+		}
+		refresh = append(refresh, rt)
+	}
+	return refresh, rows.Err()
+}
+
+// RevokeToken ends the session an access or refresh token belongs to and
+// returns its owner and the session's refresh tokens. An unknown token is
+// not an error: it yields an empty user ID.
+func (c *TokenRepository) RevokeToken(ctx context.Context, token, hint string) (string, []string, error) {
+	queries := []string{
+		`SELECT user_id, family_id FROM tokens WHERE access_token = $1 LIMIT 1`,
+		`SELECT user_id, family_id FROM tokens WHERE refresh_token = $1`,
+	}
+	if hint == TokenTypeRefresh {
+		queries[0], queries[1] = queries[1], queries[0]
+	}
+	for _, q := range queries {
+		var userID, familyID string
+		err := c.db.QueryRowContext(ctx, q, token).Scan(&userID, &familyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		refresh, err := c.RevokeFamily(ctx, familyID)
+		return userID, refresh, err
+	}
+	return "", nil, nil
+}
+
+func (c *TokenRepository) ListSessions(ctx context.Context, userID, currentAccess string) ([]domain.Session, error) {
+	const q = `
+	SELECT s.id, s.user_agent, s.ip, s.device_label, s.created_at, s.last_refreshed_at,
+	       COALESCE(s.id = (SELECT family_id FROM tokens WHERE access_token = $2 LIMIT 1), FALSE)
+	  FROM sessions s
+	 WHERE s.user_id = $1
+	   AND s.revoked_at IS NULL
+	   AND EXISTS (SELECT 1 FROM tokens t
+	                WHERE t.family_id = s.id
+	                  AND t.revoked_at IS NULL
+	                  AND t.consumed_at IS NULL
+	                  AND t.expires_at > now())
+	 ORDER BY COALESCE(s.last_refreshed_at, s.created_at) DESC`
+	rows, err := c.db.QueryContext(ctx, q, userID, currentAccess)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		var (
+			s         = domain.Session{UserID: userID}
+			refreshed sql.NullTime
+		)
+		if err := rows.Scan(&s.ID, &s.Client.UserAgent, &s.Client.IP, &s.Client.DeviceLabel,
+			&s.CreatedAt, &refreshed, &s.Current); err != nil {
+			return nil, err
+		}
+		s.LastRefreshedAt = refreshed.Time
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (c *TokenRepository) RevokeSession(ctx context.Context, userID, sessionID string) ([]string, error) {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return nil, domain.ErrSessionNotFound
+	}
+	var owner string
+	err := c.db.QueryRowContext(ctx,
+		`SELECT user_id FROM sessions WHERE id = $1 AND revoked_at IS NULL`, sessionID).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && owner != userID) {
+		return nil, domain.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.RevokeFamily(ctx, sessionID)
+}
+
+func (c *TokenRepository) KeyRing() *KeyRing { return c.keys }
+
+// issueJWT signs an access token carrying the user's current roles, with
+// the permissions they grant as the scope.
+func (c *TokenRepository) issueJWT(ctx context.Context, userID string) (string, error) {
+	access, err := c.roles.UserAccess(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return c.signJWT(userID, access)
+}
+
+func (c *TokenRepository) signJWT(userID string, access domain.Access) (string, error) {
 	now := time.Now()
-	claims := jwt.RegisteredClaims{
-		Subject:   userID,
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(c.ttl)),
+	key, err := c.keys.signer(now)
+	if err != nil {
+		return "", err
+	}
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(c.ttl)),
+		},
+		AuthorizedParty: c.clientID,
+		Scope:           strings.Join(access.Permissions, " "),
+		Roles:           access.Roles,
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.kid != "" {
+		token.Header["kid"] = key.kid
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(c.hmacKey)
+	return token.SignedString(key.private)
 }
 
-func (c *TokenRepository) parseJWT(token string) (*jwt.RegisteredClaims, error) {
-	t, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{},
-		func(_ *jwt.Token) (any, error) { return c.hmacKey, nil })
+func (c *TokenRepository) parseJWT(token string) (*accessClaims, error) {
+	t, err := jwt.ParseWithClaims(token, &accessClaims{},
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			key, err := c.keys.verifier(kid, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			if t.Method.Alg() != key.method.Alg() {
+				return nil, ErrKeyAlgMismatch
+			}
+			return key.verificationKey(), nil
+		},
+		jwt.WithValidMethods(c.keys.algorithms()))
 	if err != nil || !t.Valid {
 		return nil, errors.New("invalid token")
 	}
-	return t.Claims.(*jwt.RegisteredClaims), nil
+	return t.Claims.(*accessClaims), nil
+}
+
+func (c *TokenRepository) JWKS() jose.JSONWebKeySet {
+	var set jose.JSONWebKeySet
+	for _, k := range c.keys.published(time.Now()) {
+		if jwk, ok := k.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
 }
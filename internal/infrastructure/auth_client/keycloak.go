@@ -0,0 +1,375 @@
+package auth_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var (
+	ErrNotSupported = errors.New("not supported by keycloak backend")
+)
+
+const tokenExchangeGrant = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// KeycloakClient implements AuthClient on top of a Keycloak realm. Tokens are
+// minted by impersonating the user through token exchange, so the configured
+// client needs the token-exchange permission, and its service account needs
+// the realm-management manage-users role for the session calls. Users must
+// exist in Keycloak under the same ID as in the users table.
+//
+// Keycloak keeps no refresh token families of its own; reuse detection is
+// left to the realm's "Revoke Refresh Token" setting.
+type KeycloakClient struct {
+	http     *http.Client
+	realmURL string
+	adminURL string
+	clientID string
+	secret   string
+	log      *slog.Logger
+
+	mu         sync.Mutex
+	adminToken string
+	adminExp   time.Time
+}
+
+func NewKeycloakClient(cfg config.KeycloakConfig, log *slog.Logger) *KeycloakClient {
+	base := strings.TrimRight(cfg.URL, "/")
+	realm := url.PathEscape(cfg.Realm)
+	return &KeycloakClient{
+		http:     &http.Client{Timeout: 10 * time.Second},
+		realmURL: base + "/realms/" + realm,
+		adminURL: base + "/admin/realms/" + realm,
+		clientID: cfg.ClientID,
+		secret:   cfg.Secret,
+		log:      log,
+	}
+}
+
+type keycloakError struct {
+	Status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *keycloakError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("keycloak: status %d", e.Status)
+	}
+	return fmt.Sprintf("keycloak: %s: %s", e.Code, e.Description)
+}
+
+type keycloakTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type keycloakIntrospection struct {
+	Active    bool   `json:"active"`
+	Type      string `json:"typ"`
+	Subject   string `json:"sub"`
+	ClientID  string `json:"client_id"`
+	AZP       string `json:"azp"`
+	Scope     string `json:"scope"`
+	JTI       string `json:"jti"`
+	Exp       int64  `json:"exp"`
+	Iat       int64  `json:"iat"`
+	SID       string `json:"sid"`
+	SessionID string `json:"session_state"`
+	// realm roles, the Keycloak counterpart of the roles claim
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+}
+
+type keycloakSession struct {
+	ID         string `json:"id"`
+	IPAddress  string `json:"ipAddress"`
+	Start      int64  `json:"start"`
+	LastAccess int64  `json:"lastAccess"`
+}
+
+func (k *KeycloakClient) GenerateTokens(ctx context.Context, userID string, _ domain.ClientInfo) (string, string, error) {
+	t, err := k.impersonate(ctx, userID, "urn:ietf:params:oauth:token-type:refresh_token")
+	if err != nil {
+		return "", "", err
+	}
+	return t.AccessToken, t.RefreshToken, nil
+}
+
+func (k *KeycloakClient) impersonate(ctx context.Context, userID, tokenType string) (keycloakTokens, error) {
+	var t keycloakTokens
+	err := k.postForm(ctx, k.realmURL+"/protocol/openid-connect/token", url.Values{
+		"grant_type":           {tokenExchangeGrant},
+		"requested_subject":    {userID},
+		"requested_token_type": {tokenType},
+	}, &t)
+	return t, err
+}
+
+func (k *KeycloakClient) Introspect(ctx context.Context, token, hint string) (TokenInfo, error) {
+	in, err := k.introspect(ctx, token, hint)
+	if err != nil || !in.Active {
+		return TokenInfo{}, err
+	}
+	info := TokenInfo{
+		Active:    true,
+		TokenType: TokenTypeAccess,
+		Subject:   in.Subject,
+		ClientID:  in.ClientID,
+		Scope:     strings.Fields(in.Scope),
+		Roles:     in.RealmAccess.Roles,
+		JTI:       in.JTI,
+		IssuedAt:  time.Unix(in.Iat, 0),
+		ExpiresAt: time.Unix(in.Exp, 0),
+	}
+	if info.ClientID == "" {
+		info.ClientID = in.AZP
+	}
+	// Keycloak reports "Refresh" and "Offline" for refresh tokens
+	if in.Type != "" && !strings.EqualFold(in.Type, "Bearer") {
+		info.TokenType = TokenTypeRefresh
+	}
+	return info, nil
+}
+
+func (k *KeycloakClient) introspect(ctx context.Context, token, hint string) (keycloakIntrospection, error) {
+	var in keycloakIntrospection
+	form := url.Values{"token": {token}}
+	if hint != "" {
+		form.Set("token_type_hint", hint)
+	}
+	err := k.postForm(ctx, k.realmURL+"/protocol/openid-connect/token/introspect", form, &in)
+	return in, err
+}
+
+func (k *KeycloakClient) Logout(ctx context.Context, refresh string) error {
+	return k.postForm(ctx, k.realmURL+"/protocol/openid-connect/logout",
+		url.Values{"refresh_token": {refresh}}, nil)
+}
+
+func (k *KeycloakClient) RotateRefresh(ctx context.Context, oldRefresh, _ string) (Rotation, error) {
+	in, err := k.introspect(ctx, oldRefresh, TokenTypeRefresh)
+	if err != nil {
+		return Rotation{}, err
+	}
+	if !in.Active {
+		return Rotation{}, ErrRefreshTokenNotFound
+	}
+
+	var t keycloakTokens
+	err = k.postForm(ctx, k.realmURL+"/protocol/openid-connect/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {oldRefresh},
+	}, &t)
+	var kerr *keycloakError
+	if errors.As(err, &kerr) && kerr.Code == "invalid_grant" {
+		return Rotation{}, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return Rotation{}, err
+	}
+	return Rotation{
+		UserID:       in.Subject,
+		FamilyID:     sessionID(in),
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+	}, nil
+}
+
+func (k *KeycloakClient) RevokeFamily(context.Context, string) ([]string, error) {
+	return nil, ErrNotSupported
+}
+
+func (k *KeycloakClient) RevokeToken(ctx context.Context, token, hint string) (string, []string, error) {
+	in, err := k.introspect(ctx, token, hint)
+	if err != nil || !in.Active {
+		return "", nil, err
+	}
+	form := url.Values{"token": {token}}
+	if hint != "" {
+		form.Set("token_type_hint", hint)
+	}
+	if err := k.postForm(ctx, k.realmURL+"/protocol/openid-connect/revoke", form, nil); err != nil {
+		return "", nil, err
+	}
+	var refresh []string
+	if !strings.EqualFold(in.Type, "Bearer") {
+		refresh = append(refresh, token)
+	}
+	return in.Subject, refresh, nil
+}
+
+func (k *KeycloakClient) RevokeAll(ctx context.Context, userID string) error {
+	return k.admin(ctx, http.MethodPost, "/users/"+url.PathEscape(userID)+"/logout", nil)
+}
+
+func (k *KeycloakClient) RevokeOthers(ctx context.Context, userID, keepAccess string) ([]string, error) {
+	sessions, current, err := k.sessions(ctx, userID, keepAccess)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if s.ID == current {
+			continue
+		}
+		if err := k.admin(ctx, http.MethodDelete, "/sessions/"+url.PathEscape(s.ID), nil); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (k *KeycloakClient) ListSessions(ctx context.Context, userID, currentAccess string) ([]domain.Session, error) {
+	sessions, current, err := k.sessions(ctx, userID, currentAccess)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]domain.Session, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, domain.Session{
+			ID:              s.ID,
+			UserID:          userID,
+			Client:          domain.ClientInfo{IP: s.IPAddress},
+			CreatedAt:       time.UnixMilli(s.Start),
+			LastRefreshedAt: time.UnixMilli(s.LastAccess),
+			Current:         s.ID == current,
+		})
+	}
+	return out, nil
+}
+
+func (k *KeycloakClient) RevokeSession(ctx context.Context, userID, sessionID string) ([]string, error) {
+	sessions, _, err := k.sessions(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if s.ID == sessionID {
+			return nil, k.admin(ctx, http.MethodDelete, "/sessions/"+url.PathEscape(s.ID), nil)
+		}
+	}
+	return nil, domain.ErrSessionNotFound
+}
+
+// sessions lists the user's sessions and, when accessToken is set, the ID of
+// the session it belongs to.
+func (k *KeycloakClient) sessions(ctx context.Context, userID, accessToken string) ([]keycloakSession, string, error) {
+	var current string
+	if accessToken != "" {
+		in, err := k.introspect(ctx, accessToken, TokenTypeAccess)
+		if err != nil {
+			return nil, "", err
+		}
+		current = sessionID(in)
+	}
+	var sessions []keycloakSession
+	if err := k.admin(ctx, http.MethodGet, "/users/"+url.PathEscape(userID)+"/sessions", &sessions); err != nil {
+		return nil, "", err
+	}
+	return sessions, current, nil
+}
+
+// JWKS proxies the realm's published keys so /.well-known/jwks.json keeps
+// working when tokens are signed by Keycloak.
+func (k *KeycloakClient) JWKS() jose.JSONWebKeySet {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var set jose.JSONWebKeySet
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.realmURL+"/protocol/openid-connect/certs", nil)
+	if err == nil {
+		err = k.do(req, &set)
+	}
+	if err != nil {
+		k.log.Error("fetch keycloak certs failed", "err", err)
+		return jose.JSONWebKeySet{}
+	}
+	return set
+}
+
+func sessionID(in keycloakIntrospection) string {
+	if in.SID != "" {
+		return in.SID
+	}
+	return in.SessionID
+}
+
+// postForm calls an OpenID Connect endpoint authenticated as the configured
+// confidential client.
+func (k *KeycloakClient) postForm(ctx context.Context, endpoint string, form url.Values, out any) error {
+	form.Set("client_id", k.clientID)
+	form.Set("client_secret", k.secret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return k.do(req, out)
+}
+
+// admin calls the admin REST API with a service account token.
+func (k *KeycloakClient) admin(ctx context.Context, method, path string, out any) error {
+	token, err := k.serviceToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.adminURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return k.do(req, out)
+}
+
+func (k *KeycloakClient) serviceToken(ctx context.Context) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.adminToken != "" && time.Now().Before(k.adminExp) {
+		return k.adminToken, nil
+	}
+
+	var t keycloakTokens
+	err := k.postForm(ctx, k.realmURL+"/protocol/openid-connect/token",
+		url.Values{"grant_type": {"client_credentials"}}, &t)
+	if err != nil {
+		return "", err
+	}
+	k.adminToken = t.AccessToken
+	// renew a little early so a token never expires mid-request
+	k.adminExp = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - 10*time.Second)
+	return k.adminToken, nil
+}
+
+func (k *KeycloakClient) do(req *http.Request, out any) error {
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		kerr := &keycloakError{Status: resp.StatusCode}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = json.Unmarshal(body, kerr)
+		return kerr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
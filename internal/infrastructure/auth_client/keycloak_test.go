@@ -0,0 +1,239 @@
+package auth_client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var _ AuthClient = (*KeycloakClient)(nil)
+
+// fakeKeycloak stands in for the subset of the Keycloak API the adapter uses.
+type fakeKeycloak struct {
+	mu            sync.Mutex
+	serviceTokens int
+	calls         []string
+}
+
+func (f *fakeKeycloak) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeKeycloak) handler() http.Handler {
+	at1 := keycloakIntrospection{Active: true, Type: "Bearer", Subject: "u1", AZP: "backend", Scope: "openid profile", JTI: "j1", Exp: 2000, Iat: 1000, SID: "s1"}
+	at1.RealmAccess.Roles = []string{"admin"}
+	tokens := map[string]keycloakIntrospection{
+		"at-1": at1,
+		"rt-1": {Active: true, Type: "Refresh", Subject: "u1", AZP: "backend", JTI: "j2", Exp: 3000, Iat: 1000, SID: "s1"},
+	}
+	oidc := "/realms/test/protocol/openid-connect"
+	writeJSON := func(w http.ResponseWriter, status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+oidc+"/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("client_id") != "backend" || r.PostFormValue("client_secret") != "secret" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized_client"})
+			return
+		}
+		switch r.PostFormValue("grant_type") {
+		case tokenExchangeGrant:
+			if r.PostFormValue("requested_subject") != "u1" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+				return
+			}
+			writeJSON(w, http.StatusOK, keycloakTokens{AccessToken: "at-1", RefreshToken: "rt-1", ExpiresIn: 300})
+		case "client_credentials":
+			f.mu.Lock()
+			f.serviceTokens++
+			f.mu.Unlock()
+			writeJSON(w, http.StatusOK, keycloakTokens{AccessToken: "svc", ExpiresIn: 300})
+		case "refresh_token":
+			if r.PostFormValue("refresh_token") != "rt-1" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "Invalid refresh token"})
+				return
+			}
+			writeJSON(w, http.StatusOK, keycloakTokens{AccessToken: "at-2", RefreshToken: "rt-2", ExpiresIn: 300})
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		}
+	})
+	mux.HandleFunc("POST "+oidc+"/token/introspect", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, tokens[r.PostFormValue("token")])
+	})
+	mux.HandleFunc("POST "+oidc+"/logout", func(w http.ResponseWriter, r *http.Request) {
+		f.record("logout " + r.PostFormValue("refresh_token"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST "+oidc+"/revoke", func(w http.ResponseWriter, r *http.Request) {
+		f.record("revoke " + r.PostFormValue("token"))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	admin := http.NewServeMux()
+	admin.HandleFunc("GET /admin/realms/test/users/u1/sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []keycloakSession{
+			{ID: "s1", IPAddress: "10.0.0.1", Start: 1_000_000, LastAccess: 2_000_000},
+			{ID: "s2", IPAddress: "10.0.0.2", Start: 1_500_000, LastAccess: 1_500_000},
+		})
+	})
+	admin.HandleFunc("DELETE /admin/realms/test/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.record("delete session " + r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	admin.HandleFunc("POST /admin/realms/test/users/{id}/logout", func(w http.ResponseWriter, r *http.Request) {
+		f.record("logout user " + r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Handle("/admin/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer svc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		admin.ServeHTTP(w, r)
+	}))
+	return mux
+}
+
+func newFakeKeycloak(t *testing.T) (*KeycloakClient, *fakeKeycloak) {
+	t.Helper()
+	fake := &fakeKeycloak{}
+	srv := httptest.NewServer(fake.handler())
+	t.Cleanup(srv.Close)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	kc := NewKeycloakClient(config.KeycloakConfig{
+		URL:      srv.URL + "/",
+		Realm:    "test",
+		ClientID: "backend",
+		Secret:   "secret",
+	}, log)
+	return kc, fake
+}
+
+func TestKeycloakGenerateAndIntrospect(t *testing.T) {
+	kc, _ := newFakeKeycloak(t)
+	ctx := context.Background()
+
+	access, refresh, err := kc.GenerateTokens(ctx, "u1", domain.ClientInfo{})
+	require.NoError(t, err)
+	require.Equal(t, "at-1", access)
+	require.Equal(t, "rt-1", refresh)
+
+	info, err := kc.Introspect(ctx, "at-1", "")
+	require.NoError(t, err)
+	require.Equal(t, TokenInfo{
+		Active:    true,
+		TokenType: TokenTypeAccess,
+		Subject:   "u1",
+		ClientID:  "backend",
+		Scope:     []string{"openid", "profile"},
+		Roles:     []string{"admin"},
+		JTI:       "j1",
+		IssuedAt:  time.Unix(1000, 0),
+		ExpiresAt: time.Unix(2000, 0),
+	}, info)
+
+	info, err = kc.Introspect(ctx, "rt-1", TokenTypeRefresh)
+	require.NoError(t, err)
+	require.Equal(t, TokenTypeRefresh, info.TokenType)
+
+	info, err = kc.Introspect(ctx, "unknown", "")
+	require.NoError(t, err)
+	require.False(t, info.Active)
+}
+
+func TestKeycloakRotateRefresh(t *testing.T) {
+	kc, _ := newFakeKeycloak(t)
+	ctx := context.Background()
+
+	rot, err := kc.RotateRefresh(ctx, "rt-1", "ignored")
+	require.NoError(t, err)
+	require.Equal(t, Rotation{UserID: "u1", FamilyID: "s1", AccessToken: "at-2", RefreshToken: "rt-2"}, rot)
+
+	_, err = kc.RotateRefresh(ctx, "unknown", "ignored")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+}
+
+func TestKeycloakLogoutAndRevoke(t *testing.T) {
+	kc, fake := newFakeKeycloak(t)
+	ctx := context.Background()
+
+	require.NoError(t, kc.Logout(ctx, "rt-1"))
+
+	userID, refresh, err := kc.RevokeToken(ctx, "rt-1", TokenTypeRefresh)
+	require.NoError(t, err)
+	require.Equal(t, "u1", userID)
+	require.Equal(t, []string{"rt-1"}, refresh)
+
+	userID, refresh, err = kc.RevokeToken(ctx, "at-1", "")
+	require.NoError(t, err)
+	require.Equal(t, "u1", userID)
+	require.Empty(t, refresh)
+
+	// unknown tokens are not sent to the revoke endpoint at all
+	userID, _, err = kc.RevokeToken(ctx, "unknown", "")
+	require.NoError(t, err)
+	require.Empty(t, userID)
+
+	require.NoError(t, kc.RevokeAll(ctx, "u1"))
+
+	require.Equal(t, []string{"logout rt-1", "revoke rt-1", "revoke at-1", "logout user u1"}, fake.calls)
+}
+
+func TestKeycloakSessions(t *testing.T) {
+	kc, fake := newFakeKeycloak(t)
+	ctx := context.Background()
+
+	sessions, err := kc.ListSessions(ctx, "u1", "at-1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.True(t, sessions[0].Current)
+	require.False(t, sessions[1].Current)
+	require.Equal(t, "10.0.0.2", sessions[1].Client.IP)
+	require.Equal(t, time.UnixMilli(1_000_000), sessions[0].CreatedAt)
+
+	_, err = kc.RevokeOthers(ctx, "u1", "at-1")
+	require.NoError(t, err)
+
+	_, err = kc.RevokeSession(ctx, "u1", "s1")
+	require.NoError(t, err)
+	_, err = kc.RevokeSession(ctx, "u1", "someone-elses")
+	require.ErrorIs(t, err, domain.ErrSessionNotFound)
+
+	require.Equal(t, []string{"delete session s2", "delete session s1"}, fake.calls)
+	require.Equal(t, 1, fake.serviceTokens, "service account token is reused until it expires")
+}
+
+func TestKeycloakErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.Copy(w, strings.NewReader(`{"error":"unauthorized_client","error_description":"Invalid client secret"}`))
+	}))
+	defer srv.Close()
+
+	kc := NewKeycloakClient(config.KeycloakConfig{URL: srv.URL, Realm: "test"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	_, _, err := kc.GenerateTokens(context.Background(), "u1", domain.ClientInfo{})
+
+	var kerr *keycloakError
+	require.ErrorAs(t, err, &kerr)
+	require.Equal(t, http.StatusUnauthorized, kerr.Status)
+	require.Equal(t, "unauthorized_client", kerr.Code)
+}
@@ -0,0 +1,392 @@
+package auth_client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const manifestFile = "keys.json"
+
+var (
+	ErrKeyNotFound  = errors.New("signing key not found")
+	ErrNoActiveKey  = errors.New("no active signing key")
+	ErrKeyNotNext   = errors.New("signing key is not scheduled")
+	ErrEmptyKeyRing = errors.New("key ring has no keys")
+)
+
+type KeyState string
+
+const (
+	KeyNext    KeyState = "next"
+	KeyActive  KeyState = "active"
+	KeyRetired KeyState = "retired"
+	KeyExpired KeyState = "expired"
+)
+
+// KeyMeta is one entry of the keys.json manifest. The state of a key is not
+// stored: it follows from the activation schedule, so every replica reading
+// the same manifest agrees on which key signs without coordination.
+type KeyMeta struct {
+	KID        string    `json:"kid"`
+	Alg        string    `json:"alg"`
+	File       string    `json:"file"`
+	CreatedAt  time.Time `json:"created_at"`
+	ActivateAt time.Time `json:"activate_at"`
+}
+
+type KeyStatus struct {
+	KeyMeta
+	State     KeyState
+	RetiredAt time.Time
+}
+
+type manifest struct {
+	Keys []KeyMeta `json:"keys"`
+}
+
+type ringKey struct {
+	meta KeyMeta
+	key  *signingKey
+}
+
+type KeyRing struct {
+	mu        sync.RWMutex
+	dir       string
+	accessTTL time.Duration
+	keys      []ringKey
+	log       *slog.Logger
+}
+
+func NewStaticKeyRing(k *signingKey) *KeyRing {
+	return &KeyRing{keys: []ringKey{{meta: KeyMeta{KID: k.kid, Alg: k.method.Alg()}, key: k}}}
+}
+
+func LoadKeyRing(dir string, accessTTL time.Duration, log *slog.Logger) (*KeyRing, error) {
+	r := &KeyRing{dir: dir, accessTTL: accessTTL, log: log}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *KeyRing) Reload() error {
+	if r.dir == "" {
+		return nil
+	}
+	m, err := readManifest(r.dir)
+	if err != nil {
+		return err
+	}
+	if len(m.Keys) == 0 {
+		return ErrEmptyKeyRing
+	}
+	keys := make([]ringKey, 0, len(m.Keys))
+	for _, meta := range m.Keys {
+		k, err := readKeyFile(meta.Alg, meta.KID, filepath.Join(r.dir, meta.File))
+		if err != nil {
+			return fmt.Errorf("key %s: %w", meta.KID, err)
+		}
+		keys = append(keys, ringKey{meta: meta, key: k})
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch re-reads the manifest every interval so keys generated or promoted by
+// keyctl are picked up without a restart.
+func (r *KeyRing) Watch(ctx context.Context, interval time.Duration) {
+	if r.dir == "" || interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Reload(); err != nil {
+				r.log.Error("key ring reload failed", "err", err)
+			}
+		}
+	}
+}
+
+func (r *KeyRing) signer(now time.Time) (*signingKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, st := range statuses(r.keys, r.accessTTL, now) {
+		if st.State == KeyActive {
+			return st.key, nil
+		}
+	}
+	return nil, ErrNoActiveKey
+}
+
+func (r *KeyRing) verifier(kid string, now time.Time) (*signingKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if kid == "" && len(r.keys) == 1 {
+		return r.keys[0].key, nil
+	}
+	for _, st := range statuses(r.keys, r.accessTTL, now) {
+		if st.KID == kid && st.State != KeyExpired {
+			return st.key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (r *KeyRing) algorithms() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := map[string]bool{}
+	var algs []string
+	for _, k := range r.keys {
+		if alg := k.key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+func (r *KeyRing) published(now time.Time) []*signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*signingKey
+	for _, st := range statuses(r.keys, r.accessTTL, now) {
+		if st.State != KeyExpired {
+			out = append(out, st.key)
+		}
+	}
+	return out
+}
+
+type keyStatus struct {
+	KeyStatus
+	key *signingKey
+}
+
+// statuses derives key states from the schedule: the latest key whose
+// activate_at has passed is active, later ones are next, earlier ones are
+// retired at their successor's activation and expire once every token they
+// could have signed has expired.
+func statuses(keys []ringKey, accessTTL time.Duration, now time.Time) []keyStatus {
+	sorted := make([]ringKey, len(keys))
+	copy(sorted, keys)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].meta.ActivateAt.Before(sorted[j].meta.ActivateAt)
+	})
+
+	active := -1
+	for i, k := range sorted {
+		if !k.meta.ActivateAt.After(now) {
+			active = i
+		}
+	}
+
+	out := make([]keyStatus, len(sorted))
+	for i, k := range sorted {
+		st := keyStatus{KeyStatus: KeyStatus{KeyMeta: k.meta}, key: k.key}
+		switch {
+		case i == active:
+			st.State = KeyActive
+		case i > active:
+			st.State = KeyNext
+		default:
+			st.RetiredAt = sorted[i+1].meta.ActivateAt
+			st.State = KeyRetired
+			if !st.RetiredAt.Add(accessTTL).After(now) {
+				st.State = KeyExpired
+			}
+		}
+		out[i] = st
+	}
+	return out
+}
+
+func ListKeys(dir string, accessTTL time.Duration, now time.Time) ([]KeyStatus, error) {
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]ringKey, len(m.Keys))
+	for i, meta := range m.Keys {
+		keys[i] = ringKey{meta: meta}
+	}
+	var out []KeyStatus
+	for _, st := range statuses(keys, accessTTL, now) {
+		out = append(out, st.KeyStatus)
+	}
+	return out, nil
+}
+
+// GenerateKey creates a new key in dir that becomes active at activateAt.
+func GenerateKey(dir, alg string, activateAt time.Time) (KeyMeta, error) {
+	m, err := readManifest(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return KeyMeta{}, err
+	}
+
+	kid := uuid.NewString()
+	raw, err := newKeyMaterial(alg)
+	if err != nil {
+		return KeyMeta{}, err
+	}
+	meta := KeyMeta{
+		KID:        kid,
+		Alg:        alg,
+		File:       kid + ".pem",
+		CreatedAt:  time.Now().UTC(),
+		ActivateAt: activateAt.UTC(),
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return KeyMeta{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, meta.File), raw, 0o600); err != nil {
+		return KeyMeta{}, err
+	}
+	m.Keys = append(m.Keys, meta)
+	return meta, writeManifest(dir, m)
+}
+
+// PromoteKey activates a scheduled key immediately, retiring the current one.
+func PromoteKey(dir, kid string, now time.Time) error {
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	for i := range m.Keys {
+		if m.Keys[i].KID != kid {
+			continue
+		}
+		if !m.Keys[i].ActivateAt.After(now) {
+			return ErrKeyNotNext
+		}
+		m.Keys[i].ActivateAt = now.UTC()
+		return writeManifest(dir, m)
+	}
+	return ErrKeyNotFound
+}
+
+// PruneKeys removes expired keys from the manifest and deletes their files.
+func PruneKeys(dir string, accessTTL time.Duration, now time.Time) ([]string, error) {
+	list, err := ListKeys(dir, accessTTL, now)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		keep    manifest
+		removed []string
+	)
+	for _, st := range list {
+		if st.State == KeyExpired {
+			removed = append(removed, st.KID)
+			continue
+		}
+		keep.Keys = append(keep.Keys, st.KeyMeta)
+	}
+	if err := writeManifest(dir, keep); err != nil {
+		return nil, err
+	}
+	for _, st := range list {
+		if st.State == KeyExpired {
+			_ = os.Remove(filepath.Join(dir, st.File))
+		}
+	}
+	return removed, nil
+}
+
+func readManifest(dir string) (manifest, error) {
+	var m manifest
+	raw, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return m, fmt.Errorf("parse %s: %w", manifestFile, err)
+	}
+	return m, nil
+}
+
+func writeManifest(dir string, m manifest) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestFile))
+}
+
+func readKeyFile(alg, kid, path string) (*signingKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(alg, "HS256") {
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+		if err != nil {
+			return nil, fmt.Errorf("hmac key must be base64-encoded: %w", err)
+		}
+		return &signingKey{kid: kid, method: jwt.SigningMethodHS256, private: secret}, nil
+	}
+	return parseSigningKey(alg, kid, raw)
+}
+
+func newKeyMaterial(alg string) ([]byte, error) {
+	var (
+		priv any
+		err  error
+	)
+	switch strings.ToUpper(alg) {
+	case "HS256":
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return []byte(base64.StdEncoding.EncodeToString(secret) + "\n"), nil
+	case "RS256":
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EDDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,74 @@
+package auth_client
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	dir := t.TempDir()
+	ttl := 15 * time.Minute
+	start := time.Now()
+
+	first, err := GenerateKey(dir, "ES256", start.Add(-time.Hour))
+	require.NoError(t, err)
+	second, err := GenerateKey(dir, "EdDSA", start.Add(time.Hour))
+	require.NoError(t, err)
+
+	ring, err := LoadKeyRing(dir, ttl, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	repo := &TokenRepository{keys: ring, ttl: ttl}
+
+	// first is active, second is only pre-published
+	old, err := repo.signJWT("user-1", domain.Access{})
+	require.NoError(t, err)
+	require.Equal(t, first.KID, kidOf(t, old))
+	require.Len(t, repo.JWKS().Keys, 2)
+
+	// promotion switches the signer without invalidating live tokens
+	require.NoError(t, PromoteKey(dir, second.KID, time.Now()))
+	require.NoError(t, ring.Reload())
+
+	fresh, err := repo.signJWT("user-1", domain.Access{})
+	require.NoError(t, err)
+	require.Equal(t, second.KID, kidOf(t, fresh))
+	_, err = repo.parseJWT(old)
+	require.NoError(t, err)
+
+	keys, err := ListKeys(dir, ttl, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, KeyRetired, keys[0].State)
+	require.Equal(t, KeyActive, keys[1].State)
+
+	// once the retired key can no longer back a live token it is dropped
+	later := time.Now().Add(ttl + time.Minute)
+	_, err = ring.verifier(first.KID, later)
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	require.Len(t, ring.published(later), 1)
+
+	removed, err := PruneKeys(dir, ttl, later)
+	require.NoError(t, err)
+	require.Equal(t, []string{first.KID}, removed)
+}
+
+func TestPromoteRejectsActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	k, err := GenerateKey(dir, "HS256", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.ErrorIs(t, PromoteKey(dir, k.KID, time.Now()), ErrKeyNotNext)
+	require.ErrorIs(t, PromoteKey(dir, "missing", time.Now()), ErrKeyNotFound)
+}
+
+func kidOf(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	require.NoError(t, err)
+	return parsed.Header["kid"].(string)
+}
@@ -0,0 +1,145 @@
+package auth_client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyAlgMismatch       = errors.New("private key does not match signing algorithm")
+)
+
+type KeySetProvider interface {
+	JWKS() jose.JSONWebKeySet
+}
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private any
+	public  any
+}
+
+func (k *signingKey) symmetric() bool {
+	_, ok := k.method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+func (k *signingKey) verificationKey() any {
+	if k.symmetric() {
+		return k.private
+	}
+	return k.public
+}
+
+func (k *signingKey) jwk() (jose.JSONWebKey, bool) {
+	if k.symmetric() {
+		return jose.JSONWebKey{}, false
+	}
+	return jose.JSONWebKey{
+		Key:       k.public,
+		KeyID:     k.kid,
+		Algorithm: k.method.Alg(),
+		Use:       "sig",
+	}, true
+}
+
+func newKeyRing(cfg config.JWTConfig, log *slog.Logger) (*KeyRing, error) {
+	if cfg.KeysDir != "" {
+		return LoadKeyRing(cfg.KeysDir, cfg.AccessTTL, log)
+	}
+	k, err := loadSigningKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeyRing(k), nil
+}
+
+func loadSigningKey(cfg config.JWTConfig) (*signingKey, error) {
+	alg := strings.ToUpper(cfg.Algorithm)
+	if alg == "" || alg == "HS256" {
+		secret, err := base64.StdEncoding.DecodeString(cfg.HMACSecret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hmac_secret: must be base64-encoded: %w", err)
+		}
+		return &signingKey{kid: cfg.KeyID, method: jwt.SigningMethodHS256, private: secret}, nil
+	}
+
+	raw, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+	return parseSigningKey(alg, cfg.KeyID, raw)
+}
+
+func parseSigningKey(alg, kid string, pemBytes []byte) (*signingKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("private key: no PEM block found")
+	}
+	priv, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+
+	alg = strings.ToUpper(alg)
+	k := &signingKey{kid: kid, private: priv}
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		if alg != "RS256" {
+			return nil, ErrKeyAlgMismatch
+		}
+		k.method, k.public = jwt.SigningMethodRS256, &key.PublicKey
+	case *ecdsa.PrivateKey:
+		if alg != "ES256" || key.Curve != elliptic.P256() {
+			return nil, ErrKeyAlgMismatch
+		}
+		k.method, k.public = jwt.SigningMethodES256, &key.PublicKey
+	case ed25519.PrivateKey:
+		if alg != "EDDSA" {
+			return nil, ErrKeyAlgMismatch
+		}
+		k.method, k.public = jwt.SigningMethodEdDSA, key.Public()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, priv)
+	}
+
+	if k.kid == "" {
+		thumb, err := (&jose.JSONWebKey{Key: k.public}).Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("key thumbprint: %w", err)
+		}
+		k.kid = base64.RawURLEncoding.EncodeToString(thumb)
+	}
+	return k, nil
+}
+
+func parsePrivateKey(block *pem.Block) (any, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("private key: unsupported PEM type %q", block.Type)
+	}
+}
@@ -0,0 +1,154 @@
+package auth_client
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+func pkcs8PEM(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestAsymmetricSignAndJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	cases := map[string]any{
+		"RS256": rsaKey,
+		"ES256": ecKey,
+		"EdDSA": edKey,
+	}
+	for alg, priv := range cases {
+		t.Run(alg, func(t *testing.T) {
+			key, err := parseSigningKey(alg, "", pkcs8PEM(t, priv))
+			require.NoError(t, err)
+			require.NotEmpty(t, key.kid)
+
+			repo := &TokenRepository{keys: NewStaticKeyRing(key), ttl: time.Minute}
+			token, err := repo.signJWT("user-1", domain.Access{})
+			require.NoError(t, err)
+
+			claims, err := repo.parseJWT(token)
+			require.NoError(t, err)
+			require.Equal(t, "user-1", claims.Subject)
+
+			// a resource server only needs the published JWKS
+			raw, err := json.Marshal(repo.JWKS())
+			require.NoError(t, err)
+			var set jose.JSONWebKeySet
+			require.NoError(t, json.Unmarshal(raw, &set))
+			require.Len(t, set.Keys, 1)
+			require.True(t, set.Keys[0].IsPublic())
+
+			parsed, err := jwt.Parse(token, func(tok *jwt.Token) (any, error) {
+				keys := set.Key(tok.Header["kid"].(string))
+				require.Len(t, keys, 1)
+				return keys[0].Key, nil
+			})
+			require.NoError(t, err)
+			require.True(t, parsed.Valid)
+		})
+	}
+}
+
+func TestHMACKeyIsNotPublished(t *testing.T) {
+	key, err := loadSigningKey(config.JWTConfig{HMACSecret: "c2VjcmV0LXNlY3JldC1zZWNyZXQ="})
+	require.NoError(t, err)
+
+	repo := &TokenRepository{keys: NewStaticKeyRing(key), ttl: time.Minute}
+	token, err := repo.signJWT("user-1", domain.Access{})
+	require.NoError(t, err)
+	_, err = repo.parseJWT(token)
+	require.NoError(t, err)
+	require.Empty(t, repo.JWKS().Keys)
+}
+
+func TestAccessClaimsCarryRoles(t *testing.T) {
+	key, err := loadSigningKey(config.JWTConfig{HMACSecret: "c2VjcmV0LXNlY3JldC1zZWNyZXQ="})
+	require.NoError(t, err)
+	repo := &TokenRepository{keys: NewStaticKeyRing(key), ttl: time.Minute}
+
+	token, err := repo.signJWT("user-1", domain.Access{
+		Roles:       []string{"admin", "support"},
+		Permissions: []string{"users:read", "users:write"},
+	})
+	require.NoError(t, err)
+	claims, err := repo.parseJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin", "support"}, claims.Roles)
+	require.Equal(t, "users:read users:write", claims.Scope)
+
+	// users without roles get neither claim
+	token, err = repo.signJWT("user-2", domain.Access{})
+	require.NoError(t, err)
+	claims, err = repo.parseJWT(token)
+	require.NoError(t, err)
+	require.Nil(t, claims.Roles)
+	require.Empty(t, claims.Scope)
+}
+
+func TestParseRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := parseSigningKey("RS256", "k1", pkcs8PEM(t, rsaKey))
+	require.NoError(t, err)
+	repo := &TokenRepository{keys: NewStaticKeyRing(key), ttl: time.Minute}
+
+	// HS256 token keyed with the public key bytes must not verify
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "admin"}).SignedString(pubDER)
+	require.NoError(t, err)
+
+	_, err = repo.parseJWT(forged)
+	require.Error(t, err)
+}
+
+func TestKeyAlgorithmMismatch(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = parseSigningKey("RS256", "", pkcs8PEM(t, ecKey))
+	require.ErrorIs(t, err, ErrKeyAlgMismatch)
+}
+
+func TestSignJWTIntrospectionClaims(t *testing.T) {
+	key := &signingKey{method: jwt.SigningMethodHS256, private: []byte("secret")}
+	repo := &TokenRepository{keys: NewStaticKeyRing(key), ttl: time.Minute, clientID: "web"}
+
+	first, err := repo.signJWT("user-1", domain.Access{})
+	require.NoError(t, err)
+	second, err := repo.signJWT("user-1", domain.Access{})
+	require.NoError(t, err)
+
+	a, err := repo.parseJWT(first)
+	require.NoError(t, err)
+	b, err := repo.parseJWT(second)
+	require.NoError(t, err)
+
+	require.Equal(t, "web", a.AuthorizedParty)
+	require.NotEmpty(t, a.ID)
+	require.NotEqual(t, a.ID, b.ID, "every access token gets its own jti")
+	require.NotNil(t, a.IssuedAt)
+}
@@ -0,0 +1,268 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const attemptHeader = "x-attempt"
+
+// Handler processes one message body taken from queue. attempt counts
+// deliveries of the message, starting at 1.
+type Handler func(ctx context.Context, queue string, body []byte, attempt int) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error that retrying cannot fix; the message is
+// dead-lettered at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// RetryPolicy decides what happens to a message whose handler failed.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Next reports whether a message that failed its attempt-th delivery with
+// err should be retried, and after how long.
+func (p RetryPolicy) Next(attempt int, err error) (retry bool, delay time.Duration) {
+	if IsPermanent(err) || (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) {
+		return false, 0
+	}
+	delay = p.BaseBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 {
+		delay = min(delay, p.MaxBackoff)
+	}
+	return true, delay
+}
+
+// RabbitMQConsumer feeds queued messages to a Handler. Every queue Q gets
+// two companions: Q.retry holds failed messages until their backoff
+// expires and then dead-letters them back into Q, and Q.dead keeps the
+// messages that will not be retried. A message is acked only once it was
+// handled or moved to one of them.
+//
+// Backoffs are per-message TTLs, which RabbitMQ only expires at the head
+// of Q.retry, so a short backoff may wait behind a longer one.
+type RabbitMQConsumer struct {
+	conn         *amqp.Connection
+	channel      *amqp.Channel
+	exchangeName string
+	retry        RetryPolicy
+	log          *slog.Logger
+
+	// publishes to the retry and dead queues share the channel
+	mu sync.Mutex
+}
+
+func NewConsumer(url string, log *slog.Logger, exchangeName string, prefetch int, retry RetryPolicy) (*RabbitMQConsumer, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq dial: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("rabbitmq channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, fmt.Errorf("rabbitmq confirm: %w", err)
+	}
+	if prefetch > 0 {
+		if err := ch.Qos(prefetch, 0, false); err != nil {
+			ch.Close()
+			conn.Close()
+			return nil, fmt.Errorf("rabbitmq qos: %w", err)
+		}
+	}
+	if err := ch.ExchangeDeclare(
+		exchangeName,
+		"topic",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	); err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, err
+	}
+	return &RabbitMQConsumer{conn: conn, channel: ch, exchangeName: exchangeName, retry: retry, log: log}, nil
+}
+
+// declare sets up queue with its retry and dead queues. queue is bound to
+// the exchange under its own name and also receives messages published to
+// it through the default exchange.
+func (c *RabbitMQConsumer) declare(queue string) error {
+	if _, err := c.channel.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("queue declare %s: %w", queue, err)
+	}
+	if err := c.channel.QueueBind(queue, queue, c.exchangeName, false, nil); err != nil {
+		return fmt.Errorf("queue bind %s: %w", queue, err)
+	}
+	if _, err := c.channel.QueueDeclare(queue+".retry", true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": queue,
+	}); err != nil {
+		return fmt.Errorf("queue declare %s.retry: %w", queue, err)
+	}
+	if _, err := c.channel.QueueDeclare(queue+".dead", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("queue declare %s.dead: %w", queue, err)
+	}
+	return nil
+}
+
+// Consume handles messages from queues until ctx is cancelled or the
+// connection drops; in the latter case it returns an error and the caller
+// is expected to exit and be restarted.
+func (c *RabbitMQConsumer) Consume(ctx context.Context, queues []string, h Handler) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(queues))
+	for _, q := range queues {
+		if err := c.declare(q); err != nil {
+			return err
+		}
+		deliveries, err := c.channel.Consume(q, "", false, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("consume %s: %w", q, err)
+		}
+		wg.Add(1)
+		go func(queue string) {
+			defer wg.Done()
+			errs <- c.loop(ctx, queue, deliveries, h)
+		}(q)
+	}
+
+	var err error
+	for range queues {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			// one queue failing stops the others
+			_ = c.channel.Close()
+		}
+	}
+	wg.Wait()
+	return err
+}
+
+func (c *RabbitMQConsumer) loop(ctx context.Context, queue string, deliveries <-chan amqp.Delivery, h Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("rabbitmq: deliveries of %s closed", queue)
+			}
+			c.handle(ctx, queue, d, h)
+		}
+	}
+}
+
+func (c *RabbitMQConsumer) handle(ctx context.Context, queue string, d amqp.Delivery, h Handler) {
+	attempt := deliveryAttempt(d)
+	err := h(ctx, queue, d.Body, attempt)
+	if err == nil {
+		if err := d.Ack(false); err != nil {
+			c.log.Error("ack failed", "queue", queue, "err", err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// shutting down: hand the message back untouched
+		_ = d.Nack(false, true)
+		return
+	}
+
+	target, pub := queue+".dead", amqp.Publishing{
+		Headers:      amqp.Table{attemptHeader: int32(attempt), "x-error": err.Error()},
+		ContentType:  d.ContentType,
+		Body:         d.Body,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now().UTC(),
+	}
+	if retry, delay := c.retry.Next(attempt, err); retry {
+		target = queue + ".retry"
+		pub.Headers[attemptHeader] = int32(attempt + 1)
+		pub.Expiration = strconv.FormatInt(max(delay.Milliseconds(), 1), 10)
+		c.log.Warn("message failed, retrying", "queue", queue, "attempt", attempt, "delay", delay, "err", err)
+	} else {
+		c.log.Error("message dead-lettered", "queue", queue, "attempt", attempt, "err", err)
+	}
+
+	if err := c.publish(ctx, target, pub); err != nil {
+		c.log.Error("move failed message", "queue", target, "err", err)
+		// redelivered as the same attempt
+		_ = d.Nack(false, true)
+		return
+	}
+	if err := d.Ack(false); err != nil {
+		c.log.Error("ack failed", "queue", queue, "err", err)
+	}
+}
+
+func (c *RabbitMQConsumer) publish(ctx context.Context, queue string, pub amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	confirm, err := c.channel.PublishWithDeferredConfirmWithContext(ctx, "", queue, false, false, pub)
+	if err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	ok, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("rabbitmq nack")
+	}
+	return nil
+}
+
+func (c *RabbitMQConsumer) Close() error {
+	_ = c.channel.Close()
+	return c.conn.Close()
+}
+
+func deliveryAttempt(d amqp.Delivery) int {
+	switch v := d.Headers[attemptHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 1
+}
@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_BacksOffThenGivesUp(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	failure := errors.New("smtp timeout")
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		retry, delay := p.Next(attempt, failure)
+		require.True(t, retry, "attempt %d", attempt)
+		require.Equal(t, want, delay, "attempt %d", attempt)
+	}
+	retry, _ := p.Next(5, failure)
+	require.False(t, retry)
+}
+
+func TestRetryPolicy_PermanentIsNotRetried(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseBackoff: time.Second}
+	err := fmt.Errorf("render: %w", Permanent(errors.New("bad payload")))
+
+	require.True(t, IsPermanent(err))
+	retry, _ := p.Next(1, err)
+	require.False(t, retry)
+	require.Nil(t, Permanent(nil))
+}
+
+func TestRetryPolicy_UnlimitedAttempts(t *testing.T) {
+	p := RetryPolicy{BaseBackoff: time.Second, MaxBackoff: time.Minute}
+
+	retry, delay := p.Next(1000, errors.New("down"))
+	require.True(t, retry)
+	require.Equal(t, time.Minute, delay)
+}
@@ -2,8 +2,11 @@ package broker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -15,11 +18,20 @@ type MessageBroker interface {
 	Close() error
 }
 
+// ErrUnroutable is returned when a queue message reached no queue.
+var ErrUnroutable = errors.New("message unroutable")
+
 type RabbitMQPublisher struct {
 	conn         *amqp.Connection
 	channel      *amqp.Channel
 	exchangeName string
 	log          *slog.Logger
+
+	// mu serialises publishes; returns are matched to them by MessageId
+	// and must be drained, or the connection stalls.
+	mu      sync.Mutex
+	seq     uint64
+	returns chan amqp.Return
 }
 
 func NewPublisher(url string, log *slog.Logger, exchangeName, queueName string) (*RabbitMQPublisher, error) {
@@ -75,41 +87,37 @@ func NewPublisher(url string, log *slog.Logger, exchangeName, queueName string)
 		conn.Close()
 		return nil, err
 	}
-	return &RabbitMQPublisher{conn: conn, channel: ch, log: log}, nil
+	return &RabbitMQPublisher{
+		conn:    conn,
+		channel: ch,
+		log:     log,
+		returns: ch.NotifyReturn(make(chan amqp.Return, 64)),
+	}, nil
 }
 
-func (r *RabbitMQPublisher) PublishToQueue(ctx context.Context, queue string, body []byte) error {
-	pub := amqp.Publishing{
-		ContentType:  "application/json",
-		Body:         body,
-		DeliveryMode: amqp.Persistent,
-		Timestamp:    time.Now().UTC(),
-	}
-
-	if err := r.channel.PublishWithContext(
-		ctx,
-		r.exchangeName,
-		queue,
-		false,
-		false,
-		pub,
-	); err != nil {
-		return fmt.Errorf("publish: %w", err)
-	}
-
-	select {
-	case confirm := <-r.channel.NotifyPublish(make(chan amqp.Confirmation, 1)):
-		if !confirm.Ack {
-			return fmt.Errorf("rabbitmq nack")
+// DeclareQueues declares the queues PublishToQueue sends to, so messages
+// published before their consumer first starts are kept rather than
+// dropped. The consumer declares the same queues with identical settings.
+func (r *RabbitMQPublisher) DeclareQueues(queues ...string) error {
+	for _, q := range queues {
+		if _, err := r.channel.QueueDeclare(q, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("queue declare %s: %w", q, err)
 		}
-	case <-ctx.Done():
-		return ctx.Err()
 	}
-
 	return nil
 }
 
+// PublishToQueue is mandatory: a message no queue takes fails with
+// ErrUnroutable instead of being dropped by the broker.
+func (r *RabbitMQPublisher) PublishToQueue(ctx context.Context, queue string, body []byte) error {
+	return r.publish(ctx, queue, true, body)
+}
+
 func (r *RabbitMQPublisher) PublishToTopic(ctx context.Context, topic string, body []byte) error {
+	return r.publish(ctx, topic, false, body)
+}
+
+func (r *RabbitMQPublisher) publish(ctx context.Context, key string, mandatory bool, body []byte) error {
 	pub := amqp.Publishing{
 		ContentType:  "application/json",
 		Body:         body,
@@ -117,27 +125,42 @@ func (r *RabbitMQPublisher) PublishToTopic(ctx context.Context, topic string, bo
 		Timestamp:    time.Now().UTC(),
 	}
 
-	if err := r.channel.PublishWithContext(
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	pub.MessageId = strconv.FormatUint(r.seq, 10)
+
+	confirm, err := r.channel.PublishWithDeferredConfirmWithContext(
 		ctx,
 		r.exchangeName,
-		topic,
-		false,
+		key,
+		mandatory,
 		false,
 		pub,
-	); err != nil {
+	)
+	if err != nil {
 		return fmt.Errorf("publish: %w", err)
 	}
+	ack, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !ack {
+		return fmt.Errorf("rabbitmq nack")
+	}
 
-	select {
-	case confirm := <-r.channel.NotifyPublish(make(chan amqp.Confirmation, 1)):
-		if !confirm.Ack {
-			return fmt.Errorf("rabbitmq nack")
+	// the broker sends a return before the ack of the same message; older
+	// returns belong to publishes that gave up waiting
+	for {
+		select {
+		case ret := <-r.returns:
+			if ret.MessageId == pub.MessageId {
+				return fmt.Errorf("%w: %s: %s", ErrUnroutable, ret.RoutingKey, ret.ReplyText)
+			}
+		default:
+			return nil
 		}
-	case <-ctx.Done():
-		return ctx.Err()
 	}
-
-	return nil
 }
 
 func (r *RabbitMQPublisher) Close() error {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math/rand/v2"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -18,6 +20,17 @@ type Cache interface {
 	Set(ctx context.Context, key, value string, ttl time.Duration) error
 	SwapRefresh(ctx context.Context, userID, oldRT, newRT string, ttl time.Duration) (bool, error)
 	Delete(ctx context.Context, key string) error
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	IncrWindow(ctx context.Context, key string, window time.Duration) (int64, error)
+	GetDel(ctx context.Context, key string) (string, error)
+	SetRefresh(ctx context.Context, userID, refresh string, ttl time.Duration) error
+	DeleteUserRefresh(ctx context.Context, userID string) (int, error)
+}
+
+// userRefreshKey indexes every refresh token issued to a user so that all of
+// them can be purged at once.
+func userRefreshKey(userID string) string {
+	return "user_rt:" + userID
 }
 
 type RedisCache struct {
@@ -45,10 +58,58 @@ func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
 	return val, err
 }
 
+func (r *RedisCache) GetDel(ctx context.Context, key string) (string, error) {
+	val, err := r.client.GetDel(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrKeyNotFound
+	}
+	return val, err
+}
+
 func (r *RedisCache) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
 
+func (r *RedisCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	script := redis.NewScript(`
+		local n = redis.call("INCR", KEYS[1])
+		if n == 1 then
+			redis.call("PEXPIRE", KEYS[1], ARGV[1])
+		end
+		return n
+	`)
+
+	n, err := script.Run(ctx, r.client, []string{key}, ttl.Milliseconds()).Int64()
+	if err != nil {
+		r.log.Error("lua Incr failed", "err", err)
+		return 0, err
+	}
+	return n, nil
+}
+
+// IncrWindow records one event and returns how many were recorded under key
+// during the trailing window. Unlike Incr the window slides, so a burst
+// cannot be split across two fixed buckets.
+func (r *RedisCache) IncrWindow(ctx context.Context, key string, window time.Duration) (int64, error) {
+	script := redis.NewScript(`
+		local now = tonumber(ARGV[1])
+		local window = tonumber(ARGV[2])
+		redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+		redis.call("ZADD", KEYS[1], now, ARGV[3])
+		redis.call("PEXPIRE", KEYS[1], window)
+		return redis.call("ZCARD", KEYS[1])
+	`)
+
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+	n, err := script.Run(ctx, r.client, []string{key}, now.UnixMilli(), window.Milliseconds(), member).Int64()
+	if err != nil {
+		r.log.Error("lua IncrWindow failed", "err", err)
+		return 0, err
+	}
+	return n, nil
+}
+
 func (r *RedisCache) SwapRefresh(
 	ctx context.Context,
 	userID string,
@@ -63,10 +124,14 @@ func (r *RedisCache) SwapRefresh(
 		end
 		redis.call("SET", KEYS[2], ARGV[1], "EX", ARGV[2])
 		redis.call("DEL", KEYS[1])
+		redis.call("SREM", KEYS[3], KEYS[1])
+		redis.call("SADD", KEYS[3], KEYS[2])
+		redis.call("EXPIRE", KEYS[3], ARGV[2])
 		return 1
 	`)
 
-	res, err := script.Run(ctx, r.client, []string{oldRT, newRT}, userID, int(ttl.Seconds())).Result()
+	keys := []string{oldRT, newRT, userRefreshKey(userID)}
+	res, err := script.Run(ctx, r.client, keys, userID, int(ttl.Seconds())).Result()
 	if err != nil {
 		r.log.Error("lua SwapRefresh failed", "err", err)
 		return false, err
@@ -80,3 +145,32 @@ func (r *RedisCache) SwapRefresh(
 
 	return true, nil
 }
+
+func (r *RedisCache) SetRefresh(ctx context.Context, userID, refresh string, ttl time.Duration) error {
+	idx := userRefreshKey(userID)
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, refresh, userID, ttl)
+	pipe.SAdd(ctx, idx, refresh)
+	pipe.Expire(ctx, idx, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisCache) DeleteUserRefresh(ctx context.Context, userID string) (int, error) {
+	script := redis.NewScript(`
+		local members = redis.call("SMEMBERS", KEYS[1])
+		local n = 0
+		for _, rt in ipairs(members) do
+			n = n + redis.call("DEL", rt)
+		end
+		redis.call("DEL", KEYS[1])
+		return n
+	`)
+
+	n, err := script.Run(ctx, r.client, []string{userRefreshKey(userID)}).Int()
+	if err != nil {
+		r.log.Error("lua DeleteUserRefresh failed", "err", err)
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+type AuditRepository interface {
+	AppendAudit(ctx context.Context, e domain.AuditEvent) error
+	ListAudit(ctx context.Context, q domain.AuditQuery) ([]domain.AuditEvent, error)
+}
+
+type AuditStore struct {
+	db *sql.DB
+}
+
+func NewAuditStore(db *sql.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+func (s *AuditStore) AppendAudit(ctx context.Context, e domain.AuditEvent) error {
+	const q = `
+	INSERT INTO audit_log
+	  (actor_id, user_id, email, action, outcome, detail, ip, user_agent)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := s.db.ExecContext(ctx, q,
+		nullString(e.ActorID), nullString(e.UserID), nullString(e.Email),
+		e.Action, e.Outcome, e.Detail, e.IP, e.UserAgent)
+	return err
+}
+
+func (s *AuditStore) ListAudit(ctx context.Context, q domain.AuditQuery) ([]domain.AuditEvent, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if q.UserID != "" {
+		add("user_id = ?", q.UserID)
+	}
+	if !q.From.IsZero() {
+		add("occurred_at >= ?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		add("occurred_at < ?", q.To.UTC())
+	}
+
+	query := `
+	SELECT id, occurred_at, COALESCE(actor_id, ''), COALESCE(user_id, ''), COALESCE(email, ''),
+	       action, outcome, detail, ip, user_agent
+	  FROM audit_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	args = append(args, q.Limit, q.Offset)
+	query += ` ORDER BY occurred_at DESC, id DESC LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []domain.AuditEvent
+	for rows.Next() {
+		var (
+			e  domain.AuditEvent
+			at time.Time
+		)
+		if err := rows.Scan(&e.ID, &at, &e.ActorID, &e.UserID, &e.Email,
+			&e.Action, &e.Outcome, &e.Detail, &e.IP, &e.UserAgent); err != nil {
+			return nil, err
+		}
+		e.OccurredAt = at.UTC()
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
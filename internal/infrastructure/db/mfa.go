@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+type MFARepository interface {
+	FindTOTP(ctx context.Context, userID string) (*domain.TOTP, error)
+	SavePendingTOTP(ctx context.Context, t *domain.TOTP) error
+	ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error
+	AdvanceTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error)
+	DeleteTOTP(ctx context.Context, userID string) error
+}
+
+// MFAStore keeps TOTP secrets encrypted with AES-256-GCM; the user ID is
+// bound as additional data so a ciphertext copied to another row does not
+// decrypt.
+type MFAStore struct {
+	db   *sql.DB
+	aead cipher.AEAD
+}
+
+func NewMFAStore(db *sql.DB, cfg config.MFAConfig) (*MFAStore, error) {
+	key, err := base64.StdEncoding.DecodeString(cfg.EncryptionKey)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid mfa encryption_key: must be 32 base64-encoded bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAStore{db: db, aead: aead}, nil
+}
+
+func (s *MFAStore) FindTOTP(ctx context.Context, userID string) (*domain.TOTP, error) {
+	const q = `
+	SELECT secret, confirmed_at IS NOT NULL, last_step
+	  FROM user_totp
+	 WHERE user_id = $1
+	`
+	var (
+		sealed []byte
+		t      = &domain.TOTP{UserID: userID}
+	)
+	err := s.db.QueryRowContext(ctx, q, userID).Scan(&sealed, &t.Confirmed, &t.LastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Secret, err = s.open(sealed, userID); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SavePendingTOTP replaces an unconfirmed enrollment; a confirmed one is left
+// untouched and reported as domain.ErrMFAAlreadyEnabled.
+func (s *MFAStore) SavePendingTOTP(ctx context.Context, t *domain.TOTP) error {
+	sealed, err := s.seal(t.Secret, t.UserID)
+	if err != nil {
+		return err
+	}
+	const q = `
+	INSERT INTO user_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	   SET secret = EXCLUDED.secret, last_step = 0, created_at = now()
+	 WHERE user_totp.confirmed_at IS NULL
+	`
+	res, err := s.db.ExecContext(ctx, q, t.UserID, sealed)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (s *MFAStore) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE user_totp SET confirmed_at = now(), last_step = $2
+		  WHERE user_id = $1 AND confirmed_at IS NULL`, userID, step)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AdvanceTOTPStep records step as used. It reports false when the step, or
+// a later one, was already used, so concurrent logins cannot share a code.
+func (s *MFAStore) AdvanceTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE mfa_recovery_codes SET used_at = now()
+		  WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *MFAStore) DeleteTOTP(ctx context.Context, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MFAStore) seal(plain []byte, userID string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plain, []byte(userID)), nil
+}
+
+func (s *MFAStore) open(sealed []byte, userID string) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("totp secret: ciphertext too short")
+	}
+	plain, err := s.aead.Open(nil, sealed[:n], sealed[n:], []byte(userID))
+	if err != nil {
+		return nil, fmt.Errorf("totp secret: %w", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	OutboxQueue = "queue"
+	OutboxTopic = "topic"
+)
+
+// OutboxMessage is a broker message stored alongside the state change it
+// announces. Kind selects PublishToQueue or PublishToTopic; messages with
+// the same AggregateID are published in the order they were written.
+type OutboxMessage struct {
+	ID          int64
+	AggregateID string
+	Kind        string
+	Destination string
+	Payload     []byte
+	Attempts    int
+}
+
+func QueueMessage(aggregateID, queue string, payload []byte) OutboxMessage {
+	return OutboxMessage{AggregateID: aggregateID, Kind: OutboxQueue, Destination: queue, Payload: payload}
+}
+
+func TopicMessage(aggregateID, topic string, payload []byte) OutboxMessage {
+	return OutboxMessage{AggregateID: aggregateID, Kind: OutboxTopic, Destination: topic, Payload: payload}
+}
+
+type OutboxRepository interface {
+	// ClaimOutbox leases up to limit due messages for lease and counts an
+	// attempt against each. Only the oldest undelivered message of an
+	// aggregate is ever handed out, so a message is not claimed before its
+	// predecessors are delivered.
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkDelivered(ctx context.Context, id int64) error
+	// MarkFailed releases the lease and schedules the next attempt.
+	MarkFailed(ctx context.Context, id int64, retryAt time.Time, reason string) error
+	// PurgeDelivered deletes up to limit messages delivered before before
+	// and reports how many it deleted.
+	PurgeDelivered(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+func NewOutboxStore(db *sql.DB) *OutboxStore {
+	return &OutboxStore{db: db}
+}
+
+func (s *OutboxStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	const q = `
+	UPDATE outbox
+	   SET locked_until = now() + make_interval(secs => $2),
+	       attempts = attempts + 1
+	 WHERE id IN (
+	       SELECT h.id
+	         FROM outbox h
+	        WHERE h.delivered_at IS NULL
+	          AND h.next_attempt_at <= now()
+	          AND (h.locked_until IS NULL OR h.locked_until < now())
+	          AND NOT EXISTS (
+	              SELECT 1
+	                FROM outbox e
+	               WHERE e.aggregate_id = h.aggregate_id
+	                 AND e.delivered_at IS NULL
+	                 AND e.id < h.id)
+	        ORDER BY h.id
+	        LIMIT $1
+	          FOR UPDATE SKIP LOCKED)
+	RETURNING id, aggregate_id, kind, destination, payload, attempts
+	`
+	rows, err := s.db.QueryContext(ctx, q, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.AggregateID, &m.Kind, &m.Destination, &m.Payload, &m.Attempts); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+func (s *OutboxStore) MarkDelivered(ctx context.Context, id int64) error {
+	const q = `UPDATE outbox SET delivered_at = now(), locked_until = NULL, last_error = '' WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, q, id)
+	return err
+}
+
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+	const q = `UPDATE outbox SET next_attempt_at = $1, locked_until = NULL, last_error = $2 WHERE id = $3`
+	_, err := s.db.ExecContext(ctx, q, retryAt.UTC(), reason, id)
+	return err
+}
+
+func (s *OutboxStore) PurgeDelivered(ctx context.Context, before time.Time, limit int) (int, error) {
+	const q = `
+	DELETE FROM outbox
+	 WHERE id IN (
+	       SELECT id
+	         FROM outbox
+	        WHERE delivered_at < $1
+	        ORDER BY delivered_at
+	        LIMIT $2)
+	`
+	res, err := s.db.ExecContext(ctx, q, before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// appendOutbox writes msgs inside tx, in order, so that they commit or
+// roll back together with the change they describe.
+func appendOutbox(ctx context.Context, tx *sql.Tx, msgs []OutboxMessage) error {
+	const q = `
+	INSERT INTO outbox
+	  (aggregate_id, kind, destination, payload)
+	VALUES ($1, $2, $3, $4)
+	`
+	for _, m := range msgs {
+		if _, err := tx.ExecContext(ctx, q, m.AggregateID, m.Kind, m.Destination, m.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
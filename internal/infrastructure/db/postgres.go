@@ -21,12 +21,28 @@ var (
 
 type UserRepository interface {
 	FindByEmail(ctx context.Context, email domain.Email) (*domain.User, error)
+	FindByID(ctx context.Context, id string) (*domain.User, error)
 }
 
 type UserMutRepository interface {
 	UserRepository
-	Save(ctx context.Context, u *domain.User) error
+	// Save, MarkConfirmed and UpdateConfirmation append events to the
+	// outbox in the same transaction as the change itself.
+	Save(ctx context.Context, u *domain.User, events ...OutboxMessage) error
 	UpdatePasswordHash(ctx context.Context, userID, newHash string) error
+	MarkConfirmed(ctx context.Context, userID string, events ...OutboxMessage) error
+	UpdateConfirmation(ctx context.Context, userID, confirmationID string, expiresAt time.Time, events ...OutboxMessage) error
+}
+
+// UserAdminRepository adds the operations only administrators perform.
+// Unknown ids are reported as domain.ErrUserNotFound.
+type UserAdminRepository interface {
+	UserMutRepository
+	// ListUsers pages through users oldest first; query, when set, matches
+	// a substring of the email or an exact id. total counts all matches.
+	ListUsers(ctx context.Context, query string, limit, offset int) (users []*domain.User, total int, err error)
+	SetDisabled(ctx context.Context, userID string, disabled bool) error
+	Delete(ctx context.Context, userID string) error
 }
 
 type Postgres struct {
@@ -52,41 +68,136 @@ func NewPostgres(cfg config.PostgresConfig, log *slog.Logger) (*Postgres, error)
 
 func (p *Postgres) DB() *sql.DB { return p.db }
 
-func (p *Postgres) Save(ctx context.Context, u *domain.User) error {
+func (p *Postgres) Save(ctx context.Context, u *domain.User, events ...OutboxMessage) error {
 	const q = `
 	INSERT INTO users
 	  (id,  email,  password_hash, confirmation_id, expires_at, confirmed)
 	VALUES ($1, $2, $3, $4, $5, $6)
 	`
-	_, err := p.db.ExecContext(
-		ctx, q,
-		u.ID(),
-		u.Email().String(),
-		u.HashForStorage(),
-		u.ConfirmationID(),
-		u.ExpiresAt().UTC(),
-		u.IsConfirmed(),
-	)
+	err := p.inTx(ctx, events, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx, q,
+			u.ID(),
+			u.Email().String(),
+			u.HashForStorage(),
+			u.ConfirmationID(),
+			u.ExpiresAt().UTC(),
+			u.IsConfirmed(),
+		)
+		return err
+	})
 	if err != nil && isDuplicateKey(err) {
 		return ErrDuplicateKey
 	}
 	return err
 }
 
+// inTx runs fn and then appends events to the outbox, committing both or
+// neither.
+func (p *Postgres) inTx(ctx context.Context, events []OutboxMessage, fn func(tx *sql.Tx) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := appendOutbox(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const userColumns = `id, email, password_hash, confirmation_id, expires_at, confirmed, created_at, disabled_at`
+
 func (p *Postgres) FindByEmail(ctx context.Context, email domain.Email) (*domain.User, error) {
 	const q = `
-	SELECT id, email, password_hash, confirmation_id, expires_at, confirmed
+	SELECT ` + userColumns + `
 	  FROM users
 	 WHERE email = $1
 	`
-	row := p.db.QueryRowContext(ctx, q, email.String())
+	return p.scanUser(p.db.QueryRowContext(ctx, q, email.String()))
+}
+
+func (p *Postgres) FindByID(ctx context.Context, id string) (*domain.User, error) {
+	const q = `
+	SELECT ` + userColumns + `
+	  FROM users
+	 WHERE id = $1
+	`
+	return p.scanUser(p.db.QueryRowContext(ctx, q, id))
+}
+
+func (p *Postgres) ListUsers(ctx context.Context, query string, limit, offset int) ([]*domain.User, int, error) {
+	const where = `
+	 WHERE $1 = '' OR id = $1 OR email ILIKE '%' || replace(replace(replace($1, '\', '\\'), '%', '\%'), '_', '\_') || '%'
+	`
+	var total int
+	if err := p.db.QueryRowContext(ctx, `SELECT count(*) FROM users`+where, query).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT `+userColumns+` FROM users`+where+` ORDER BY created_at, id LIMIT $2 OFFSET $3`,
+		query, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		u, err := p.scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+func (p *Postgres) SetDisabled(ctx context.Context, userID string, disabled bool) error {
+	const q = `
+	UPDATE users
+	   SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END
+	 WHERE id = $1
+	`
+	res, err := p.db.ExecContext(ctx, q, userID, disabled)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// Delete removes the user; credentials, roles and second factors go with
+// it through ON DELETE CASCADE.
+func (p *Postgres) Delete(ctx context.Context, userID string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
 
+func (p *Postgres) scanUser(row rowScanner) (*domain.User, error) {
 	var (
 		id, emailStr, hash, code string
-		expires                  time.Time
+		expires, created         time.Time
+		disabled                 sql.NullTime
 		confirmed                bool
 	)
-	if err := row.Scan(&id, &emailStr, &hash, &code, &expires, &confirmed); err != nil {
+	if err := row.Scan(&id, &emailStr, &hash, &code, &expires, &confirmed, &created, &disabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
 		return nil, err
 	}
 	em, err := domain.NewEmail(emailStr)
@@ -94,7 +205,7 @@ func (p *Postgres) FindByEmail(ctx context.Context, email domain.Email) (*domain
 
 		return nil, err
 	}
-	user, err := domain.RehydrateUser(id, em, hash, code, expires, confirmed)
+	user, err := domain.RehydrateUser(id, em, hash, code, expires, confirmed, created, disabled.Time)
 	if err != nil {
 		p.log.Error("Error to get domain model", "error", err)
 		return nil, err
@@ -108,6 +219,22 @@ func (p *Postgres) UpdatePasswordHash(ctx context.Context, userID, newHash strin
 	return err
 }
 
+func (p *Postgres) MarkConfirmed(ctx context.Context, userID string, events ...OutboxMessage) error {
+	const q = `UPDATE users SET confirmed = TRUE WHERE id = $1`
+	return p.inTx(ctx, events, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, q, userID)
+		return err
+	})
+}
+
+func (p *Postgres) UpdateConfirmation(ctx context.Context, userID, confirmationID string, expiresAt time.Time, events ...OutboxMessage) error {
+	const q = `UPDATE users SET confirmation_id = $1, expires_at = $2 WHERE id = $3`
+	return p.inTx(ctx, events, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, q, confirmationID, expiresAt.UTC(), userID)
+		return err
+	})
+}
+
 func isDuplicateKey(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
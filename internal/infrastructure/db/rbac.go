@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+type RoleRepository interface {
+	ListRoles(ctx context.Context) ([]domain.Role, error)
+	FindRole(ctx context.Context, name string) (*domain.Role, error)
+	CreateRole(ctx context.Context, r *domain.Role) error
+	// SetRolePermissions replaces the permissions granted by a role.
+	SetRolePermissions(ctx context.Context, role string, permissions []string) error
+	DeleteRole(ctx context.Context, name string) error
+	ListPermissions(ctx context.Context) ([]domain.Permission, error)
+	AssignRole(ctx context.Context, userID, role string) error
+	UnassignRole(ctx context.Context, userID, role string) error
+	UserAccess(ctx context.Context, userID string) (domain.Access, error)
+}
+
+type RoleStore struct {
+	db *sql.DB
+}
+
+func NewRoleStore(db *sql.DB) *RoleStore {
+	return &RoleStore{db: db}
+}
+
+// roleSelect aggregates the permissions into one comma-separated column;
+// valid names never contain a comma.
+const roleSelect = `
+	SELECT r.name, r.description, r.created_at,
+	       COALESCE(string_agg(rp.permission, ',' ORDER BY rp.permission), '')
+	  FROM roles r
+	  LEFT JOIN role_permissions rp ON rp.role = r.name
+`
+
+func (s *RoleStore) ListRoles(ctx context.Context) ([]domain.Role, error) {
+	rows, err := s.db.QueryContext(ctx, roleSelect+` GROUP BY r.name ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []domain.Role
+	for rows.Next() {
+		r, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *r)
+	}
+	return roles, rows.Err()
+}
+
+func (s *RoleStore) FindRole(ctx context.Context, name string) (*domain.Role, error) {
+	r, err := scanRole(s.db.QueryRowContext(ctx, roleSelect+` WHERE r.name = $1 GROUP BY r.name`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrRoleNotFound
+	}
+	return r, err
+}
+
+func (s *RoleStore) CreateRole(ctx context.Context, r *domain.Role) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO roles (name, description) VALUES ($1, $2)`, r.Name, r.Description); err != nil {
+		if isDuplicateKey(err) {
+			return domain.ErrRoleExists
+		}
+		return err
+	}
+	if err := grantPermissions(ctx, tx, r.Name, r.Permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *RoleStore) SetRolePermissions(ctx context.Context, role string, permissions []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock the role so a concurrent delete cannot interleave
+	var name string
+	err = tx.QueryRowContext(ctx, `SELECT name FROM roles WHERE name = $1 FOR UPDATE`, role).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = $1`, role); err != nil {
+		return err
+	}
+	if err := grantPermissions(ctx, tx, role, permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func grantPermissions(ctx context.Context, tx *sql.Tx, role string, permissions []string) error {
+	for _, p := range permissions {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING`, role, p)
+		if isForeignKeyViolation(err) {
+			return domain.ErrPermissionNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RoleStore) DeleteRole(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM roles WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrRoleNotFound
+	}
+	return nil
+}
+
+func (s *RoleStore) ListPermissions(ctx context.Context) ([]domain.Permission, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, description FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var perms []domain.Permission
+	for rows.Next() {
+		var p domain.Permission
+		if err := rows.Scan(&p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		perms = append(perms, p)
+	}
+	return perms, rows.Err()
+}
+
+// AssignRole is idempotent; an unknown role is reported as
+// domain.ErrRoleNotFound.
+func (s *RoleStore) AssignRole(ctx context.Context, userID, role string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, role)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" && pgErr.ConstraintName == "user_roles_role_fkey" {
+		return domain.ErrRoleNotFound
+	}
+	return err
+}
+
+func (s *RoleStore) UnassignRole(ctx context.Context, userID, role string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role)
+	return err
+}
+
+func (s *RoleStore) UserAccess(ctx context.Context, userID string) (domain.Access, error) {
+	const q = `
+	SELECT ur.role, COALESCE(rp.permission, '')
+	  FROM user_roles ur
+	  LEFT JOIN role_permissions rp ON rp.role = ur.role
+	 WHERE ur.user_id = $1
+	 ORDER BY ur.role, rp.permission
+	`
+	rows, err := s.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return domain.Access{}, err
+	}
+	defer rows.Close()
+
+	var (
+		access domain.Access
+		seen   = make(map[string]bool)
+	)
+	for rows.Next() {
+		var role, perm string
+		if err := rows.Scan(&role, &perm); err != nil {
+			return domain.Access{}, err
+		}
+		if n := len(access.Roles); n == 0 || access.Roles[n-1] != role {
+			access.Roles = append(access.Roles, role)
+		}
+		if perm != "" && !seen[perm] {
+			seen[perm] = true
+			access.Permissions = append(access.Permissions, perm)
+		}
+	}
+	return access, rows.Err()
+}
+
+func scanRole(row rowScanner) (*domain.Role, error) {
+	var (
+		r     domain.Role
+		perms string
+	)
+	if err := row.Scan(&r.Name, &r.Description, &r.CreatedAt, &perms); err != nil {
+		return nil, err
+	}
+	if perms != "" {
+		r.Permissions = strings.Split(perms, ",")
+	}
+	return &r, nil
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 23503 — foreign_key_violation
+		return pgErr.Code == "23503"
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+type WebAuthnRepository interface {
+	ListCredentials(ctx context.Context, userID string) ([]domain.WebAuthnCredential, error)
+	CountCredentials(ctx context.Context, userID string) (int, error)
+	FindCredential(ctx context.Context, id []byte) (*domain.WebAuthnCredential, error)
+	SaveCredential(ctx context.Context, c *domain.WebAuthnCredential) error
+	// TouchCredential stores the counter and backup state reported by the
+	// last successful assertion.
+	TouchCredential(ctx context.Context, id []byte, signCount uint32, backupState bool) error
+	DeleteCredential(ctx context.Context, userID string, id []byte) error
+}
+
+type WebAuthnStore struct {
+	db *sql.DB
+}
+
+func NewWebAuthnStore(db *sql.DB) *WebAuthnStore {
+	return &WebAuthnStore{db: db}
+}
+
+const webauthnColumns = `
+	id, user_id, name, public_key, attestation_type, aaguid, sign_count,
+	transports, backup_eligible, backup_state, created_at, last_used_at
+`
+
+func (s *WebAuthnStore) ListCredentials(ctx context.Context, userID string) ([]domain.WebAuthnCredential, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+webauthnColumns+` FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []domain.WebAuthnCredential
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, *c)
+	}
+	return creds, rows.Err()
+}
+
+func (s *WebAuthnStore) CountCredentials(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT count(*) FROM webauthn_credentials WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *WebAuthnStore) FindCredential(ctx context.Context, id []byte) (*domain.WebAuthnCredential, error) {
+	c, err := scanCredential(s.db.QueryRowContext(ctx,
+		`SELECT `+webauthnColumns+` FROM webauthn_credentials WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrCredentialNotFound
+	}
+	return c, err
+}
+
+func (s *WebAuthnStore) SaveCredential(ctx context.Context, c *domain.WebAuthnCredential) error {
+	const q = `
+	INSERT INTO webauthn_credentials
+	  (id, user_id, name, public_key, attestation_type, aaguid, sign_count,
+	   transports, backup_eligible, backup_state)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := s.db.ExecContext(ctx, q,
+		c.ID, c.UserID, c.Name, c.PublicKey, c.AttestationType, c.AAGUID, int64(c.SignCount),
+		strings.Join(c.Transports, ","), c.BackupEligible, c.BackupState,
+	)
+	if err != nil && isDuplicateKey(err) {
+		return domain.ErrCredentialExists
+	}
+	return err
+}
+
+func (s *WebAuthnStore) TouchCredential(ctx context.Context, id []byte, signCount uint32, backupState bool) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE webauthn_credentials
+		    SET sign_count = $2, backup_state = $3, last_used_at = now()
+		  WHERE id = $1`, id, int64(signCount), backupState)
+	return err
+}
+
+func (s *WebAuthnStore) DeleteCredential(ctx context.Context, userID string, id []byte) error {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrCredentialNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCredential(row rowScanner) (*domain.WebAuthnCredential, error) {
+	var (
+		c          domain.WebAuthnCredential
+		signCount  int64
+		transports string
+		lastUsed   sql.NullTime
+		createdAt  time.Time
+	)
+	err := row.Scan(
+		&c.ID, &c.UserID, &c.Name, &c.PublicKey, &c.AttestationType, &c.AAGUID, &signCount,
+		&transports, &c.BackupEligible, &c.BackupState, &createdAt, &lastUsed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.SignCount = uint32(signCount)
+	if transports != "" {
+		c.Transports = strings.Split(transports, ",")
+	}
+	c.CreatedAt = createdAt
+	c.LastUsedAt = lastUsed.Time
+	return &c, nil
+}
@@ -0,0 +1,228 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+// dkimHeaders are signed when present, in this order.
+var dkimHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// DKIMSigner adds an RFC 6376 DKIM-Signature to composed messages, using
+// relaxed canonicalization for both header and body. RSA keys sign with
+// rsa-sha256, Ed25519 keys with ed25519-sha256 (RFC 8463).
+type DKIMSigner struct {
+	domain    string
+	selector  string
+	key       crypto.Signer
+	algorithm string
+	now       func() time.Time
+}
+
+// LoadDKIMSigner reads the key cfg names. It returns nil when cfg.Domain
+// is empty, which turns signing off.
+func LoadDKIMSigner(cfg config.DKIMConfig) (*DKIMSigner, error) {
+	if cfg.Domain == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read dkim key: %w", err)
+	}
+	return NewDKIMSigner(cfg.Domain, cfg.Selector, raw)
+}
+
+func NewDKIMSigner(domain, selector string, pemBytes []byte) (*DKIMSigner, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("dkim: domain and selector are required")
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("dkim: no PEM block found")
+	}
+	var (
+		priv any
+		err  error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("dkim: unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: %w", err)
+	}
+
+	s := &DKIMSigner{domain: domain, selector: selector, now: time.Now}
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		// RFC 8301 forbids shorter keys
+		if key.N.BitLen() < 1024 {
+			return nil, errors.New("dkim: rsa key shorter than 1024 bits")
+		}
+		s.key, s.algorithm = key, "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.key, s.algorithm = key, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key type %T", priv)
+	}
+	return s, nil
+}
+
+// Sign returns msg, a CRLF-separated RFC 5322 message, with a
+// DKIM-Signature header prepended. A nil signer returns msg unchanged.
+func (s *DKIMSigner) Sign(msg []byte) ([]byte, error) {
+	if s == nil {
+		return msg, nil
+	}
+	header, body, ok := bytes.Cut(msg, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, errors.New("dkim: message has no body separator")
+	}
+	fields := splitHeader(string(header) + "\r\n")
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	var signed []string
+	var canon strings.Builder
+	used := make(map[int]bool)
+	for _, name := range dkimHeaders {
+		// the last unused instance, as RFC 6376 section 5.4.2 asks
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fieldName(fields[i]), name) {
+				used[i] = true
+				signed = append(signed, name)
+				canon.WriteString(relaxedHeader(fields[i]))
+				break
+			}
+		}
+	}
+
+	sig := fmt.Sprintf(
+		"DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n t=%d; h=%s;\r\n bh=%s;\r\n b=",
+		s.algorithm, s.domain, s.selector, s.now().Unix(),
+		strings.ToLower(strings.Join(signed, ":")),
+		base64.StdEncoding.EncodeToString(bodyHash[:]),
+	)
+	// the signature header itself is signed with an empty b= and no
+	// trailing CRLF
+	canon.WriteString(strings.TrimSuffix(relaxedHeader(sig+"\r\n"), "\r\n"))
+
+	digest := sha256.Sum256([]byte(canon.String()))
+	var (
+		b   []byte
+		err error
+	)
+	if s.algorithm == "ed25519-sha256" {
+		b, err = s.key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		b, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: sign: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(sig)
+	out.WriteString(foldBase64(base64.StdEncoding.EncodeToString(b)))
+	out.WriteString("\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+// splitHeader splits a header block into fields, each keeping its
+// continuation lines and final CRLF.
+func splitHeader(header string) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimRight(name, " \t")
+}
+
+// relaxedHeader is the relaxed header canonicalization of RFC 6376
+// section 3.4.2.
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	name = strings.ToLower(strings.TrimRight(name, " \t"))
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return name + ":" + strings.Trim(collapseWSP(value), " ") + "\r\n"
+}
+
+// relaxedBody is the relaxed body canonicalization of RFC 6376 section
+// 3.4.4.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWSP replaces every run of spaces and tabs with a single space.
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == ' ' || c == '\t' {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func foldBase64(s string) string {
+	const width = 72
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width])
+		b.WriteString("\r\n  ")
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrNoTransport = errors.New("no mail transport available")
+
+// Provider is one transport of a FailoverMailer.
+type Provider struct {
+	Name   string
+	Mailer Mailer
+}
+
+// FailoverMailer sends through the first provider that accepts the
+// message. Each provider has a circuit breaker: after threshold
+// consecutive failures it is skipped for cooldown, then given a single
+// trial send that either closes the breaker or opens it again. Rejected
+// messages are returned at once, since another provider would refuse
+// them too.
+type FailoverMailer struct {
+	providers []*breaker
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+type breaker struct {
+	Provider
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool // a half-open trial send is in flight
+}
+
+func NewFailoverMailer(providers []Provider, threshold int, cooldown time.Duration) *FailoverMailer {
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if cooldown <= 0 {
+		cooldown = time.Minute
+	}
+	f := &FailoverMailer{threshold: threshold, cooldown: cooldown, now: time.Now}
+	for _, p := range providers {
+		f.providers = append(f.providers, &breaker{Provider: p})
+	}
+	return f
+}
+
+func (f *FailoverMailer) Send(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, b := range f.providers {
+		if !f.allow(b) {
+			continue
+		}
+		err := b.Mailer.Send(ctx, msg)
+		switch {
+		case err == nil:
+			f.record(b, true)
+			return nil
+		case IsRejected(err):
+			// the provider works, the message does not
+			f.record(b, true)
+			return err
+		case ctx.Err() != nil:
+			f.release(b)
+			return ctx.Err()
+		}
+		f.record(b, false)
+		errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+	}
+	if len(errs) == 0 {
+		return ErrNoTransport
+	}
+	return errors.Join(errs...)
+}
+
+// allow reports whether b may be tried now, claiming the half-open trial
+// when its cooldown is over.
+func (f *FailoverMailer) allow(b *breaker) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < f.threshold {
+		return true
+	}
+	if b.trial || f.now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (f *FailoverMailer) record(b *breaker, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= f.threshold {
+		b.openUntil = f.now().Add(f.cooldown)
+	}
+}
+
+// release gives up a trial without judging the provider.
+func (f *FailoverMailer) release(b *breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
@@ -0,0 +1,77 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+// HTTPMailer hands emails to a provider API as a JSON document:
+//
+//	{"from": "...", "to": "...", "subject": "...", "text": "...", "html": "..."}
+//
+// Any 2xx answer counts as accepted. 400, 413 and 422 mean the message
+// itself was refused and are reported as ErrRejected; anything else,
+// including authentication failures, is a failure of the transport.
+type HTTPMailer struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+func NewHTTPMailer(cfg config.MailHTTPConfig, from string) (*HTTPMailer, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("email: http transport needs a url")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPMailer{url: cfg.URL, token: cfg.Token, from: from, client: &http.Client{Timeout: timeout}}, nil
+}
+
+type httpMessage struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+func (m *HTTPMailer) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(httpMessage{From: m.from, To: msg.To, Subject: msg.Subject, Text: msg.Text, HTML: msg.HTML})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return nil
+	case code == http.StatusBadRequest || code == http.StatusRequestEntityTooLarge || code == http.StatusUnprocessableEntity:
+		return fmt.Errorf("%w: http %d: %s", ErrRejected, code, bytes.TrimSpace(detail))
+	default:
+		return fmt.Errorf("email api: http %d: %s", code, bytes.TrimSpace(detail))
+	}
+}
@@ -0,0 +1,75 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MaildirMailer delivers into a local maildir, for development. Every
+// email becomes a file in new/ that mail clients and grep can read.
+type MaildirMailer struct {
+	dir    string
+	from   string
+	signer *DKIMSigner
+}
+
+// NewMaildirMailer delivers into dir, creating it if needed. signer may be
+// nil; a signed copy lets DKIM setups be checked without a mail server.
+func NewMaildirMailer(dir, from string, signer *DKIMSigner) (*MaildirMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("email: maildir path is empty")
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &MaildirMailer{dir: dir, from: from, signer: signer}, nil
+}
+
+// Send writes the message to tmp/ and then moves it to new/, so readers
+// never see a partial file.
+func (m *MaildirMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	raw, err := msg.Compose(m.from)
+	if err != nil {
+		return err
+	}
+	if raw, err = m.signer.Sign(raw); err != nil {
+		return err
+	}
+
+	name, err := maildirName()
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(m.dir, "tmp", name)
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(m.dir, "new", name)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func maildirName() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	now := time.Now()
+	return fmt.Sprintf("%d.M%dP%dR%s.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), hex.EncodeToString(b[:]), host), nil
+}
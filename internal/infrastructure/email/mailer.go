@@ -0,0 +1,63 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+// ErrRejected is wrapped by transports when the provider refused the
+// message itself; sending it again, anywhere, will not help.
+var ErrRejected = errors.New("message rejected")
+
+// IsRejected reports whether err is a refusal of the message rather than a
+// failure of the transport, such as bad credentials or a relay that is
+// down, which another provider or a later attempt may not hit.
+func IsRejected(err error) bool {
+	return errors.Is(err, ErrRejected)
+}
+
+// NewMailer builds the transport cfg.Transport names. The smtp and
+// maildir transports DKIM-sign when cfg.DKIM is configured.
+func NewMailer(cfg config.EmailConfig) (Mailer, error) {
+	signer, err := LoadDKIMSigner(cfg.DKIM)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Transport {
+	case "failover":
+		if len(cfg.Failover.Transports) == 0 {
+			return nil, fmt.Errorf("email: failover needs transports")
+		}
+		providers := make([]Provider, 0, len(cfg.Failover.Transports))
+		for _, name := range cfg.Failover.Transports {
+			if name == "failover" {
+				return nil, fmt.Errorf("email: failover cannot contain itself")
+			}
+			m, err := newTransport(name, cfg, signer)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, Provider{Name: name, Mailer: m})
+		}
+		return NewFailoverMailer(providers, cfg.Failover.FailureThreshold, cfg.Failover.Cooldown), nil
+	default:
+		return newTransport(cfg.Transport, cfg, signer)
+	}
+}
+
+func newTransport(name string, cfg config.EmailConfig, signer *DKIMSigner) (Mailer, error) {
+	switch name {
+	case "", "smtp":
+		return NewSMTPMailer(cfg, signer), nil
+	case "maildir":
+		return NewMaildirMailer(cfg.Maildir, cfg.From, signer)
+	case "memory":
+		return NewMemoryMailer(), nil
+	case "http":
+		return NewHTTPMailer(cfg.HTTP, cfg.From)
+	default:
+		return nil, fmt.Errorf("email: unknown transport %q", name)
+	}
+}
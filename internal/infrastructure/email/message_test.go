@@ -0,0 +1,94 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompose_MultipartAlternative(t *testing.T) {
+	raw, err := Message{
+		To:      "a@example.com",
+		Subject: "Подтвердите адрес",
+		Text:    "line one\nline two",
+		HTML:    "<p>Привет</p>",
+	}.Compose("noreply@example.com")
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.Equal(t, "noreply@example.com", msg.Header.Get("From"))
+	require.Equal(t, "a@example.com", msg.Header.Get("To"))
+
+	// the subject travels as RFC 2047 encoded words
+	require.True(t, strings.HasPrefix(msg.Header.Get("Subject"), "=?utf-8?q?"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Подтвердите адрес", subject)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		// multipart.Reader decodes quoted-printable itself
+		body, err := io.ReadAll(p)
+		require.NoError(t, err)
+		types = append(types, p.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	require.Equal(t, []string{"text/plain; charset=UTF-8", "text/html; charset=UTF-8"}, types)
+	require.Equal(t, []string{"line one\r\nline two", "<p>Привет</p>"}, bodies)
+}
+
+func TestCompose_TextOnly(t *testing.T) {
+	raw, err := Message{To: "a@example.com", Subject: "Plain subject", Text: "hello"}.Compose("noreply@example.com")
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.Equal(t, "Plain subject", msg.Header.Get("Subject"))
+	require.Equal(t, "text/plain; charset=UTF-8", msg.Header.Get("Content-Type"))
+	require.Equal(t, "quoted-printable", msg.Header.Get("Content-Transfer-Encoding"))
+}
+
+func TestCompose_RejectsHeaderInjection(t *testing.T) {
+	_, err := Message{To: "a@example.com\r\nBcc: b@example.com", Text: "x"}.Compose("noreply@example.com")
+	require.Error(t, err)
+}
+
+func TestCompose_DateAndMessageID(t *testing.T) {
+	m := Message{To: "a@example.com", Subject: "s", Text: "hello"}
+	raw, err := m.Compose("Auth <noreply@mail.example.com>")
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	date, err := msg.Header.Date()
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), date, time.Minute)
+
+	id := msg.Header.Get("Message-ID")
+	require.Regexp(t, `^<[0-9a-f]{32}@mail\.example\.com>$`, id)
+
+	// every message gets its own id
+	again, err := m.Compose("Auth <noreply@mail.example.com>")
+	require.NoError(t, err)
+	msg, err = mail.ReadMessage(bytes.NewReader(again))
+	require.NoError(t, err)
+	require.NotEqual(t, id, msg.Header.Get("Message-ID"))
+}
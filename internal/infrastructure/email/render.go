@@ -0,0 +1,129 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownJob = errors.New("unknown email job")
+	ErrBadJob     = errors.New("malformed email job")
+)
+
+// Job is the union of the payloads the usecases queue.
+type Job struct {
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Code      string `json:"code"`
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expires_in"`
+	// Language is the Accept-Language header of the request that caused
+	// the email. Users have no stored language preference, so an email
+	// follows the browser that triggered it rather than the account.
+	Language string `json:"language"`
+
+	// the sign-in a login alert is about
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	SignedInAt time.Time `json:"signed_in_at"`
+}
+
+type kind struct {
+	template string
+	// path and query of the front-end page the email links to
+	link func(j Job) (string, url.Values)
+}
+
+var kinds = map[string]kind{
+	"email.confirm": {
+		template: "confirm_email",
+		link: func(j Job) (string, url.Values) {
+			return "/confirm", url.Values{"email": {j.Email}, "code": {j.Code}}
+		},
+	},
+	"email.password_reset": {
+		template: "password_reset",
+		link: func(j Job) (string, url.Values) {
+			return "/password/reset", url.Values{"token": {j.Token}}
+		},
+	},
+	"email.login": {
+		template: "login_link",
+		link: func(j Job) (string, url.Values) {
+			return "/login/email", url.Values{"token": {j.Token}}
+		},
+	},
+	"email.login_alert": {
+		template: "new_login_alert",
+		link: func(j Job) (string, url.Values) {
+			return "/account/sessions", nil
+		},
+	},
+}
+
+// Renderer turns queued email jobs into messages. Links point below
+// appURL.
+type Renderer struct {
+	templates *Templates
+	appURL    string
+}
+
+func NewRenderer(templates *Templates, appURL string) *Renderer {
+	return &Renderer{templates: templates, appURL: strings.TrimRight(appURL, "/")}
+}
+
+// Render builds the message for a job taken from queue. Unknown queues
+// and payloads without a recipient are reported as ErrUnknownJob and
+// ErrBadJob.
+func (r *Renderer) Render(queue string, body []byte) (Message, error) {
+	k, ok := kinds[queue]
+	if !ok {
+		return Message{}, fmt.Errorf("%w: %s", ErrUnknownJob, queue)
+	}
+	var j Job
+	if err := json.Unmarshal(body, &j); err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrBadJob, err)
+	}
+	if j.Email == "" {
+		return Message{}, fmt.Errorf("%w: no recipient", ErrBadJob)
+	}
+	return r.render(k, j)
+}
+
+// Preview renders template name for j as the worker would.
+func (r *Renderer) Preview(name string, j Job) (Message, error) {
+	for _, k := range kinds {
+		if k.template == name {
+			return r.render(k, j)
+		}
+	}
+	return Message{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+}
+
+func (r *Renderer) render(k kind, j Job) (Message, error) {
+	path, query := k.link(j)
+	link := r.appURL + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	data := struct {
+		Job
+		Link           string
+		ExpiresMinutes int
+	}{
+		Job:            j,
+		Link:           link,
+		ExpiresMinutes: (j.ExpiresIn + 59) / 60,
+	}
+
+	msg, err := r.templates.Render(k.template, j.Language, data)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.To = j.Email
+	return msg, nil
+}
@@ -3,16 +3,18 @@ package email
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/smtp"
+	"net/textproto"
 	"time"
 
 	"github.com/ParkieV/auth-service/internal/config"
 )
 
 type Mailer interface {
-	Send(ctx context.Context, to, subject, html string) error
+	Send(ctx context.Context, msg Message) error
 }
 
 type SMTPMailer struct {
@@ -22,9 +24,12 @@ type SMTPMailer struct {
 	useTLS bool
 	tlsCfg *tls.Config
 	ttl    time.Duration
+	signer *DKIMSigner
 }
 
-func NewSMTPMailer(cfg config.EmailConfig) *SMTPMailer {
+// NewSMTPMailer sends through the server cfg names. signer may be nil to
+// send unsigned mail.
+func NewSMTPMailer(cfg config.EmailConfig, signer *DKIMSigner) *SMTPMailer {
 	addr := fmt.Sprintf("%s:%d", cfg.SMTPHost, cfg.SMTPPort)
 
 	return &SMTPMailer{
@@ -34,18 +39,18 @@ func NewSMTPMailer(cfg config.EmailConfig) *SMTPMailer {
 		useTLS: cfg.UseTLS,
 		tlsCfg: &tls.Config{ServerName: cfg.SMTPHost},
 		ttl:    10 * time.Second,
+		signer: signer,
 	}
 }
 
-func (m *SMTPMailer) Send(ctx context.Context, to, subject, htmlBody string) error {
-	msg := []byte(fmt.Sprintf(
-		"From: %s\r\n"+
-			"To: %s\r\n"+
-			"Subject: %s\r\n"+
-			"MIME-Version: 1.0\r\n"+
-			"Content-Type: text/html; charset=UTF-8\r\n\r\n%s",
-		m.from, to, subject, htmlBody,
-	))
+func (m *SMTPMailer) Send(ctx context.Context, email Message) error {
+	msg, err := email.Compose(m.from)
+	if err != nil {
+		return err
+	}
+	if msg, err = m.signer.Sign(msg); err != nil {
+		return err
+	}
 
 	dialer := &net.Dialer{Timeout: m.ttl}
 	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
@@ -53,6 +58,9 @@ func (m *SMTPMailer) Send(ctx context.Context, to, subject, htmlBody string) err
 		return err
 	}
 	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
 
 	var c *smtp.Client
 	if m.useTLS {
@@ -77,6 +85,7 @@ func (m *SMTPMailer) Send(ctx context.Context, to, subject, htmlBody string) err
 		}
 	}
 
+	// a refused login or sender is the provider's problem, not the message's
 	if err := c.Auth(m.auth); err != nil {
 		return err
 	}
@@ -84,16 +93,27 @@ func (m *SMTPMailer) Send(ctx context.Context, to, subject, htmlBody string) err
 	if err := c.Mail(m.from); err != nil {
 		return err
 	}
-	if err := c.Rcpt(to); err != nil {
-		return err
+	if err := c.Rcpt(email.To); err != nil {
+		return rejected(err)
 	}
 
 	w, err := c.Data()
 	if err != nil {
-		return err
+		return rejected(err)
 	}
 	if _, err := w.Write(msg); err != nil {
 		return err
 	}
-	return w.Close()
+	return rejected(w.Close())
+}
+
+// rejected wraps the replies to RCPT and DATA that refuse this recipient or
+// content (550-553) as ErrRejected. Other 5xx replies, such as 554 relay
+// denied, say nothing about the message and stay transport failures.
+func rejected(err error) error {
+	var tp *textproto.Error
+	if errors.As(err, &tp) && tp.Code >= 550 && tp.Code <= 553 {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	return err
 }
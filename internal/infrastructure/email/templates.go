@@ -0,0 +1,188 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+//go:embed templates
+var embedded embed.FS
+
+// EmbeddedTemplates returns the templates compiled into the binary.
+func EmbeddedTemplates() fs.FS {
+	sub, _ := fs.Sub(embedded, "templates")
+	return sub
+}
+
+type localized struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template // nil for text-only emails
+}
+
+// Templates holds named email templates in one or more locales. The root
+// of the file system has a directory per locale ("en", "pt-br"), each with
+// NAME.txt, the plain-text body that also defines a "subject" template,
+// and optionally NAME.html. Every template must exist in the default
+// locale, which the others fall back to.
+type Templates struct {
+	defaultLocale string
+	byLocale      map[string]map[string]localized
+}
+
+func LoadTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	t := &Templates{defaultLocale: strings.ToLower(defaultLocale), byLocale: map[string]map[string]localized{}}
+
+	dirs, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		locale := strings.ToLower(dir.Name())
+		set, err := loadLocale(fsys, dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		t.byLocale[locale] = set
+	}
+
+	defaults, ok := t.byLocale[t.defaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("email templates: no %q locale", t.defaultLocale)
+	}
+	for locale, set := range t.byLocale {
+		for name := range set {
+			if _, ok := defaults[name]; !ok {
+				return nil, fmt.Errorf("email templates: %s/%s has no %q fallback", locale, name, t.defaultLocale)
+			}
+		}
+	}
+	return t, nil
+}
+
+func loadLocale(fsys fs.FS, dir string) (map[string]localized, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	set := map[string]localized{}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+
+		text, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("email templates: %s defines no subject", file)
+		}
+		l := localized{text: text}
+
+		htmlFile := path.Join(dir, name+".html")
+		if _, err := fs.Stat(fsys, htmlFile); err == nil {
+			if l.html, err = htmltemplate.ParseFS(fsys, htmlFile); err != nil {
+				return nil, err
+			}
+		}
+		set[name] = l
+	}
+	return set, nil
+}
+
+// Names lists the templates of the default locale.
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.byLocale[t.defaultLocale]))
+	for name := range t.byLocale[t.defaultLocale] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes template name in the locale that best matches
+// language, an Accept-Language value. The returned message has no
+// recipient.
+func (t *Templates) Render(name, language string, data any) (Message, error) {
+	l, ok := t.lookup(name, language)
+	if !ok {
+		return Message{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := l.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := l.text.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if l.html != nil {
+		if err := l.html.Execute(&html, data); err != nil {
+			return Message{}, err
+		}
+	}
+	return Message{
+		// a subject is a single header line
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func (t *Templates) lookup(name, language string) (localized, bool) {
+	for _, locale := range preferredLocales(language) {
+		if l, ok := t.byLocale[locale][name]; ok {
+			return l, true
+		}
+	}
+	l, ok := t.byLocale[t.defaultLocale][name]
+	return l, ok
+}
+
+// preferredLocales orders the tags of an Accept-Language value by weight,
+// following each region-specific tag ("pt-br") with its language ("pt").
+func preferredLocales(language string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(language, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{strings.ReplaceAll(name, "_", "-"), q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	locales := make([]string, 0, 2*len(tags))
+	for _, t := range tags {
+		locales = append(locales, t.name)
+		if base, _, ok := strings.Cut(t.name, "-"); ok {
+			locales = append(locales, base)
+		}
+	}
+	return locales
+}
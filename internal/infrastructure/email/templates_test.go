@@ -0,0 +1,89 @@
+package email
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testTemplates(t *testing.T) *Templates {
+	t.Helper()
+	templates, err := LoadTemplates(fstest.MapFS{
+		"en/greet.txt":    {Data: []byte(`{{define "subject"}}Hello {{.}}{{end}}Hi {{.}}`)},
+		"en/greet.html":   {Data: []byte(`<b>Hi {{.}}</b>`)},
+		"en/plain.txt":    {Data: []byte("{{define \"subject\"}}\n  Two\n  lines\n{{end}}body")},
+		"de/greet.txt":    {Data: []byte(`{{define "subject"}}Hallo {{.}}{{end}}Hallo {{.}}`)},
+		"pt-BR/greet.txt": {Data: []byte(`{{define "subject"}}Olá {{.}}{{end}}Olá {{.}}`)},
+	}, "en")
+	require.NoError(t, err)
+	return templates
+}
+
+func TestTemplates_PicksLocaleByWeight(t *testing.T) {
+	templates := testTemplates(t)
+
+	for lang, want := range map[string]string{
+		"":                       "Hello Ann",
+		"de":                     "Hallo Ann",
+		"de-AT":                  "Hallo Ann",
+		"fr, de;q=0.5":           "Hallo Ann",
+		"en;q=0.4, de;q=0.8":     "Hallo Ann",
+		"pt-br":                  "Olá Ann",
+		"pt_BR":                  "Olá Ann",
+		"de;q=0, *":              "Hello Ann",
+		"es, fr;q=0.9, jp;q=0.1": "Hello Ann",
+		"not a; q=header,, ;q=x": "Hello Ann",
+	} {
+		msg, err := templates.Render("greet", lang, "Ann")
+		require.NoError(t, err, lang)
+		require.Equal(t, want, msg.Subject, lang)
+	}
+}
+
+func TestTemplates_FallsBackPerTemplate(t *testing.T) {
+	templates := testTemplates(t)
+
+	// de has no plain template, en does
+	msg, err := templates.Render("plain", "de", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Two lines", msg.Subject)
+	require.Equal(t, "body", msg.Text)
+	require.Empty(t, msg.HTML)
+
+	// de greet is text-only even though en has html
+	msg, err = templates.Render("greet", "de", "Ann")
+	require.NoError(t, err)
+	require.Empty(t, msg.HTML)
+
+	_, err = templates.Render("missing", "en", nil)
+	require.ErrorIs(t, err, ErrUnknownTemplate)
+	require.Equal(t, []string{"greet", "plain"}, templates.Names())
+}
+
+func TestLoadTemplates_Validates(t *testing.T) {
+	_, err := LoadTemplates(fstest.MapFS{
+		"en/greet.txt": {Data: []byte(`{{define "subject"}}Hi{{end}}`)},
+	}, "de")
+	require.ErrorContains(t, err, `no "de" locale`)
+
+	_, err = LoadTemplates(fstest.MapFS{
+		"en/greet.txt": {Data: []byte(`{{define "subject"}}Hi{{end}}`)},
+		"de/extra.txt": {Data: []byte(`{{define "subject"}}Hi{{end}}`)},
+	}, "en")
+	require.ErrorContains(t, err, "de/extra")
+
+	_, err = LoadTemplates(fstest.MapFS{
+		"en/greet.txt": {Data: []byte(`Hi`)},
+	}, "en")
+	require.ErrorContains(t, err, "defines no subject")
+}
+
+func TestEmbeddedTemplates_AllLocalesComplete(t *testing.T) {
+	templates, err := LoadTemplates(EmbeddedTemplates(), "en")
+	require.NoError(t, err)
+	require.Equal(t, []string{"confirm_email", "login_link", "new_login_alert", "password_reset"}, templates.Names())
+	for _, k := range kinds {
+		require.Contains(t, templates.Names(), k.template)
+	}
+}
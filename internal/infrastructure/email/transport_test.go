@@ -0,0 +1,319 @@
+package email
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+var (
+	_ Mailer = (*SMTPMailer)(nil)
+	_ Mailer = (*MaildirMailer)(nil)
+	_ Mailer = (*MemoryMailer)(nil)
+	_ Mailer = (*HTTPMailer)(nil)
+	_ Mailer = (*FailoverMailer)(nil)
+)
+
+var testMessage = Message{To: "a@example.com", Subject: "Hello", Text: "hi", HTML: "<p>hi</p>"}
+
+func TestMemoryMailer_Captures(t *testing.T) {
+	m := NewMemoryMailer()
+	_, ok := m.Last()
+	require.False(t, ok)
+
+	require.NoError(t, m.Send(context.Background(), testMessage))
+	require.NoError(t, m.Send(context.Background(), Message{To: "b@example.com", Subject: "Other"}))
+
+	require.Len(t, m.Sent(), 2)
+	require.Equal(t, []Message{testMessage}, m.SentTo("a@example.com"))
+	last, ok := m.Last()
+	require.True(t, ok)
+	require.Equal(t, "Other", last.Subject)
+
+	m.Reset()
+	require.Empty(t, m.Sent())
+}
+
+func TestMaildirMailer_WritesToNew(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewMaildirMailer(dir, "noreply@example.com", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Send(context.Background(), testMessage))
+	require.NoError(t, m.Send(context.Background(), testMessage))
+
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	tmp, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	require.NoError(t, err)
+	require.Empty(t, tmp)
+
+	f, err := os.Open(filepath.Join(dir, "new", files[0].Name()))
+	require.NoError(t, err)
+	defer f.Close()
+	parsed, err := mail.ReadMessage(f)
+	require.NoError(t, err)
+	require.Equal(t, "a@example.com", parsed.Header.Get("To"))
+	require.Equal(t, "noreply@example.com", parsed.Header.Get("From"))
+}
+
+func TestHTTPMailer_PostsJSON(t *testing.T) {
+	var got httpMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	m, err := NewHTTPMailer(config.MailHTTPConfig{URL: srv.URL, Token: "secret"}, "noreply@example.com")
+	require.NoError(t, err)
+	require.NoError(t, m.Send(context.Background(), testMessage))
+	require.Equal(t, httpMessage{From: "noreply@example.com", To: "a@example.com", Subject: "Hello", Text: "hi", HTML: "<p>hi</p>"}, got)
+}
+
+func TestHTTPMailer_ClassifiesStatus(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("provider says no"))
+	}))
+	defer srv.Close()
+	m, err := NewHTTPMailer(config.MailHTTPConfig{URL: srv.URL}, "noreply@example.com")
+	require.NoError(t, err)
+
+	for code, rejected := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusUnprocessableEntity: true,
+		http.StatusUnauthorized:        false,
+		http.StatusTooManyRequests:     false,
+		http.StatusBadGateway:          false,
+	} {
+		status = code
+		err := m.Send(context.Background(), testMessage)
+		require.Error(t, err, code)
+		require.Equal(t, rejected, IsRejected(err), code)
+		require.ErrorContains(t, err, "provider says no")
+	}
+}
+
+// fakeSMTP answers one SMTP session, replying to each command with the
+// entry of replies its verb names, or 250.
+func fakeSMTP(t *testing.T, replies map[string]string) config.EmailConfig {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb := strings.ToUpper(strings.Fields(line + " ")[0])
+			reply, ok := replies[verb]
+			switch {
+			case ok:
+			case verb == "EHLO":
+				reply = "250-fake\r\n250 AUTH PLAIN"
+			case verb == "AUTH":
+				reply = "235 ok"
+			case verb == "DATA":
+				reply = "354 go ahead"
+			case verb == "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				reply = "250 ok"
+			}
+			_ = tp.PrintfLine("%s", reply)
+			if verb == "DATA" && strings.HasPrefix(reply, "354") {
+				if _, err := tp.ReadDotBytes(); err != nil {
+					return
+				}
+				_ = tp.PrintfLine("%s", cmp.Or(replies["."], "250 queued"))
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return config.EmailConfig{SMTPHost: "127.0.0.1", SMTPPort: addr.Port, SMTPUser: "u", SMTPPass: "p", From: "noreply@example.com"}
+}
+
+func TestSMTPMailer_ClassifiesReplies(t *testing.T) {
+	for name, tc := range map[string]struct {
+		replies  map[string]string
+		rejected bool
+	}{
+		"bad credentials":   {map[string]string{"AUTH": "535 authentication failed"}, false},
+		"auth required":     {map[string]string{"MAIL": "530 authentication required"}, false},
+		"relay denied":      {map[string]string{"RCPT": "554 relay access denied"}, false},
+		"greylisted":        {map[string]string{"RCPT": "451 try again later"}, false},
+		"unknown recipient": {map[string]string{"RCPT": "550 no such user"}, true},
+		"content refused":   {map[string]string{".": "552 message too large"}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := NewSMTPMailer(fakeSMTP(t, tc.replies), nil)
+			err := m.Send(context.Background(), testMessage)
+			require.Error(t, err)
+			require.Equal(t, tc.rejected, IsRejected(err))
+		})
+	}
+
+	m := NewSMTPMailer(fakeSMTP(t, nil), nil)
+	require.NoError(t, m.Send(context.Background(), testMessage))
+}
+
+type scriptedMailer struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (m *scriptedMailer) Send(context.Context, Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+func newTestFailover(providers ...Mailer) (*FailoverMailer, *time.Time) {
+	ps := make([]Provider, len(providers))
+	for i, p := range providers {
+		ps[i] = Provider{Name: string(rune('a' + i)), Mailer: p}
+	}
+	f := NewFailoverMailer(ps, 2, time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	f.now = func() time.Time { return now }
+	return f, &now
+}
+
+func TestFailover_FallsThroughInOrder(t *testing.T) {
+	down := errors.New("connection refused")
+	primary := &scriptedMailer{errs: []error{down}}
+	secondary := &scriptedMailer{}
+	f, _ := newTestFailover(primary, secondary)
+
+	require.NoError(t, f.Send(context.Background(), testMessage))
+	require.Equal(t, 1, primary.calls)
+	require.Equal(t, 1, secondary.calls)
+
+	// primary is healthy again and preferred
+	require.NoError(t, f.Send(context.Background(), testMessage))
+	require.Equal(t, 2, primary.calls)
+	require.Equal(t, 1, secondary.calls)
+}
+
+func TestFailover_BreakerOpensAndRecovers(t *testing.T) {
+	down := errors.New("timeout")
+	primary := &scriptedMailer{errs: []error{down, down, down}}
+	secondary := &scriptedMailer{}
+	f, now := newTestFailover(primary, secondary)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, f.Send(context.Background(), testMessage))
+	}
+	// two failures open the breaker; the next sends skip primary
+	require.Equal(t, 2, primary.calls)
+	require.Equal(t, 4, secondary.calls)
+
+	// after the cooldown one trial goes to primary, fails and reopens
+	*now = now.Add(time.Minute)
+	require.NoError(t, f.Send(context.Background(), testMessage))
+	require.Equal(t, 3, primary.calls)
+	require.NoError(t, f.Send(context.Background(), testMessage))
+	require.Equal(t, 3, primary.calls)
+
+	// the next trial succeeds and closes it
+	*now = now.Add(time.Minute)
+	require.NoError(t, f.Send(context.Background(), testMessage))
+	require.NoError(t, f.Send(context.Background(), testMessage))
+	require.Equal(t, 5, primary.calls)
+	require.Equal(t, 6, secondary.calls)
+}
+
+func TestFailover_RejectionIsNotRetriedElsewhere(t *testing.T) {
+	primary := &scriptedMailer{errs: []error{rejected(&textproto.Error{Code: 550, Msg: "no such user"})}}
+	secondary := &scriptedMailer{}
+	f, _ := newTestFailover(primary, secondary)
+
+	err := f.Send(context.Background(), testMessage)
+	require.True(t, IsRejected(err))
+	require.Zero(t, secondary.calls)
+}
+
+func TestFailover_AllDown(t *testing.T) {
+	down := errors.New("down")
+	f, _ := newTestFailover(&scriptedMailer{errs: []error{down, down}}, &scriptedMailer{errs: []error{down, down}})
+
+	err := f.Send(context.Background(), testMessage)
+	require.ErrorIs(t, err, down)
+	require.False(t, IsRejected(err))
+	_ = f.Send(context.Background(), testMessage)
+
+	// both breakers are open now
+	require.ErrorIs(t, f.Send(context.Background(), testMessage), ErrNoTransport)
+}
+
+func TestNewMailer_SelectsTransport(t *testing.T) {
+	cfg := config.EmailConfig{From: "noreply@example.com", Maildir: t.TempDir(), HTTP: config.MailHTTPConfig{URL: "http://mail.invalid"}}
+
+	for transport, want := range map[string]Mailer{
+		"":        (*SMTPMailer)(nil),
+		"smtp":    (*SMTPMailer)(nil),
+		"maildir": (*MaildirMailer)(nil),
+		"memory":  (*MemoryMailer)(nil),
+		"http":    (*HTTPMailer)(nil),
+	} {
+		cfg.Transport = transport
+		m, err := NewMailer(cfg)
+		require.NoError(t, err, transport)
+		require.IsType(t, want, m, transport)
+	}
+
+	cfg.Transport = "failover"
+	cfg.Failover.Transports = []string{"http", "maildir"}
+	m, err := NewMailer(cfg)
+	require.NoError(t, err)
+	require.IsType(t, (*FailoverMailer)(nil), m)
+
+	cfg.Failover.Transports = []string{"failover"}
+	_, err = NewMailer(cfg)
+	require.Error(t, err)
+
+	cfg.Transport = "pigeon"
+	_, err = NewMailer(cfg)
+	require.Error(t, err)
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+)
+
+// Worker sends the email jobs consumed from the broker. Its Handle method
+// is a broker.Handler.
+type Worker struct {
+	mailer      Mailer
+	renderer    *Renderer
+	sendTimeout time.Duration
+	log         *slog.Logger
+}
+
+func NewWorker(mailer Mailer, renderer *Renderer, sendTimeout time.Duration, log *slog.Logger) *Worker {
+	return &Worker{mailer: mailer, renderer: renderer, sendTimeout: sendTimeout, log: log}
+}
+
+// Handle renders and sends one job. Jobs that cannot be rendered and
+// recipients the server rejects for good are reported as permanent
+// failures; anything else is worth retrying.
+func (w *Worker) Handle(ctx context.Context, queue string, body []byte, attempt int) error {
+	msg, err := w.renderer.Render(queue, body)
+	if err != nil {
+		return broker.Permanent(err)
+	}
+
+	if w.sendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.sendTimeout)
+		defer cancel()
+	}
+	if err := w.mailer.Send(ctx, msg); err != nil {
+		if IsRejected(err) {
+			return broker.Permanent(err)
+		}
+		return err
+	}
+	w.log.Info("email sent", "queue", queue, "attempt", attempt)
+	return nil
+}
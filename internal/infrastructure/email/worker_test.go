@@ -0,0 +1,147 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+)
+
+type fakeMailer struct {
+	sent []Message
+	err  error
+}
+
+func (m *fakeMailer) Send(_ context.Context, msg Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestRenderer(t *testing.T) *Renderer {
+	t.Helper()
+	templates, err := LoadTemplates(EmbeddedTemplates(), "en")
+	require.NoError(t, err)
+	return NewRenderer(templates, "https://app.example.com/")
+}
+
+func newTestWorker(t *testing.T) (*Worker, *fakeMailer) {
+	t.Helper()
+	m := &fakeMailer{}
+	return NewWorker(m, newTestRenderer(t), 0, slog.New(slog.NewTextHandler(io.Discard, nil))), m
+}
+
+func TestRender_Confirm(t *testing.T) {
+	r := newTestRenderer(t)
+
+	msg, err := r.Render("email.confirm", []byte(`{"user_id":"u1","email":"a+b@example.com","code":"c0de"}`))
+	require.NoError(t, err)
+	require.Equal(t, "a+b@example.com", msg.To)
+	require.Equal(t, "Confirm your email", msg.Subject)
+	require.Contains(t, msg.HTML, `href="https://app.example.com/confirm?code=c0de&amp;email=a%2Bb%40example.com"`)
+	require.Contains(t, msg.HTML, "<strong>c0de</strong>")
+	require.Contains(t, msg.Text, "https://app.example.com/confirm?code=c0de&email=a%2Bb%40example.com")
+}
+
+func TestRender_UsesJobLanguage(t *testing.T) {
+	r := newTestRenderer(t)
+
+	msg, err := r.Render("email.password_reset", []byte(`{"email":"a@example.com","token":"t","language":"ru-RU,ru;q=0.9"}`))
+	require.NoError(t, err)
+	require.Equal(t, "Сброс пароля", msg.Subject)
+
+	msg, err = r.Render("email.password_reset", []byte(`{"email":"a@example.com","token":"t","language":"fr"}`))
+	require.NoError(t, err)
+	require.Equal(t, "Reset your password", msg.Subject)
+}
+
+func TestRender_LoginShowsExpiry(t *testing.T) {
+	r := newTestRenderer(t)
+
+	msg, err := r.Render("email.login", []byte(`{"email":"a@example.com","token":"tok","code":"123456","expires_in":600}`))
+	require.NoError(t, err)
+	require.Contains(t, msg.HTML, "/login/email?token=tok")
+	require.Contains(t, msg.HTML, "expire in 10 minutes")
+	require.Contains(t, msg.Text, "expire in 10 minutes")
+}
+
+func TestRender_LoginAlert(t *testing.T) {
+	r := newTestRenderer(t)
+
+	msg, err := r.Render("email.login_alert", []byte(`{"email":"a@example.com","ip":"203.0.113.7","user_agent":"<Firefox>","signed_in_at":"2026-03-01T09:30:00Z"}`))
+	require.NoError(t, err)
+	require.Equal(t, "New sign-in to your account", msg.Subject)
+	require.Contains(t, msg.Text, "Time: 2026-03-01 09:30 UTC")
+	require.Contains(t, msg.Text, "IP address: 203.0.113.7")
+	require.Contains(t, msg.Text, "/account/sessions\n")
+	require.Contains(t, msg.HTML, "&lt;Firefox&gt;")
+
+	msg, err = r.Render("email.login_alert", []byte(`{"email":"a@example.com","language":"ru"}`))
+	require.NoError(t, err)
+	require.Equal(t, "Новый вход в аккаунт", msg.Subject)
+	require.NotContains(t, msg.Text, "IP-адрес")
+}
+
+func TestRender_EscapesPayload(t *testing.T) {
+	r := newTestRenderer(t)
+
+	msg, err := r.Render("email.confirm", []byte(`{"email":"a@example.com","code":"<script>"}`))
+	require.NoError(t, err)
+	require.NotContains(t, msg.HTML, "<script>")
+}
+
+func TestWorker_SendsRenderedJob(t *testing.T) {
+	w, m := newTestWorker(t)
+
+	err := w.Handle(context.Background(), "email.password_reset", []byte(`{"email":"a@example.com","token":"t"}`), 1)
+	require.NoError(t, err)
+	require.Len(t, m.sent, 1)
+	require.Equal(t, "a@example.com", m.sent[0].To)
+	require.Contains(t, m.sent[0].HTML, "https://app.example.com/password/reset?token=t")
+}
+
+func TestWorker_MalformedJobsArePermanent(t *testing.T) {
+	w, m := newTestWorker(t)
+
+	for _, tc := range []struct {
+		queue, body string
+		want        error
+	}{
+		{"email.unknown", `{"email":"a@example.com"}`, ErrUnknownJob},
+		{"email.confirm", `not json`, ErrBadJob},
+		{"email.confirm", `{"code":"c"}`, ErrBadJob},
+	} {
+		err := w.Handle(context.Background(), tc.queue, []byte(tc.body), 1)
+		require.ErrorIs(t, err, tc.want)
+		require.True(t, broker.IsPermanent(err), "%s %s", tc.queue, tc.body)
+	}
+	require.Empty(t, m.sent)
+}
+
+func TestWorker_ClassifiesSMTPErrors(t *testing.T) {
+	w, m := newTestWorker(t)
+	body := []byte(`{"email":"a@example.com","code":"c"}`)
+
+	m.err = rejected(&textproto.Error{Code: 550, Msg: "mailbox unavailable"})
+	require.True(t, broker.IsPermanent(w.Handle(context.Background(), "email.confirm", body, 1)))
+
+	// a bad SMTP password is retried, not dead-lettered
+	m.err = &textproto.Error{Code: 535, Msg: "authentication failed"}
+	require.False(t, broker.IsPermanent(w.Handle(context.Background(), "email.confirm", body, 1)))
+
+	m.err = &textproto.Error{Code: 451, Msg: "try again later"}
+	err := w.Handle(context.Background(), "email.confirm", body, 1)
+	require.Error(t, err)
+	require.False(t, broker.IsPermanent(err))
+
+	m.err = errors.New("dial tcp: connection refused")
+	require.False(t, broker.IsPermanent(w.Handle(context.Background(), "email.confirm", body, 1)))
+}
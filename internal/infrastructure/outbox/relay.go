@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+)
+
+const (
+	// purgeInterval is how often the relay deletes expired messages, and
+	// purgeBatch how many it deletes per statement.
+	purgeInterval = time.Hour
+	purgeBatch    = 1000
+)
+
+// Relay publishes outbox messages through the broker. Delivery is at least
+// once: a message whose lease runs out before it is marked delivered is
+// published again, so consumers must tolerate duplicates.
+type Relay struct {
+	repo      db.OutboxRepository
+	broker    broker.MessageBroker
+	cfg       config.OutboxConfig
+	log       *slog.Logger
+	now       func() time.Time
+	nextPurge time.Time
+}
+
+func NewRelay(repo db.OutboxRepository, broker broker.MessageBroker, cfg config.OutboxConfig, log *slog.Logger) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	cfg.MaxBackoff = max(cfg.MaxBackoff, cfg.BaseBackoff)
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+	return &Relay{repo: repo, broker: broker, cfg: cfg, log: log, now: time.Now}
+}
+
+// Run relays messages until ctx is cancelled. A full batch is followed
+// by the next one straight away; otherwise the relay waits PollInterval.
+func (r *Relay) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wait := r.cfg.PollInterval
+		if n, err := r.relayBatch(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.log.Error("outbox claim failed", "err", err)
+		} else if n == r.cfg.BatchSize {
+			wait = 0
+		}
+		r.maybePurge(ctx)
+		timer.Reset(wait)
+	}
+}
+
+// relayBatch claims one batch and publishes it, returning how many
+// messages were claimed.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	msgs, err := r.repo.ClaimOutbox(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range msgs {
+		r.relay(ctx, m)
+	}
+	return len(msgs), nil
+}
+
+func (r *Relay) relay(ctx context.Context, m db.OutboxMessage) {
+	if err := r.publish(ctx, m); err != nil {
+		retryAt := r.now().Add(r.backoff(m.Attempts))
+		r.log.Warn("outbox publish failed",
+			"id", m.ID, "destination", m.Destination, "attempts", m.Attempts, "retry_at", retryAt, "err", err)
+		if err := r.repo.MarkFailed(ctx, m.ID, retryAt, err.Error()); err != nil {
+			// the lease runs out and the message is claimed again
+			r.log.Error("outbox mark failed failed", "id", m.ID, "err", err)
+		}
+		return
+	}
+	if err := r.repo.MarkDelivered(ctx, m.ID); err != nil {
+		r.log.Error("outbox mark delivered failed", "id", m.ID, "err", err)
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, m db.OutboxMessage) error {
+	switch m.Kind {
+	case db.OutboxQueue:
+		return r.broker.PublishToQueue(ctx, m.Destination, m.Payload)
+	case db.OutboxTopic:
+		return r.broker.PublishToTopic(ctx, m.Destination, m.Payload)
+	default:
+		return fmt.Errorf("unknown outbox kind %q", m.Kind)
+	}
+}
+
+// maybePurge deletes messages delivered more than Retention ago, at most
+// once per purgeInterval.
+func (r *Relay) maybePurge(ctx context.Context) {
+	now := r.now()
+	if now.Before(r.nextPurge) {
+		return
+	}
+	r.nextPurge = now.Add(purgeInterval)
+
+	before := now.Add(-r.cfg.Retention)
+	total := 0
+	for {
+		n, err := r.repo.PurgeDelivered(ctx, before, purgeBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.log.Error("outbox purge failed", "err", err)
+			}
+			return
+		}
+		total += n
+		if n < purgeBatch {
+			break
+		}
+	}
+	if total > 0 {
+		r.log.Info("outbox purged", "deleted", total, "before", before)
+	}
+}
+
+// backoff is BaseBackoff doubled for every attempt after the first,
+// capped at MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.BaseBackoff
+	for i := 1; i < attempts && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, r.cfg.MaxBackoff)
+}
@@ -0,0 +1,287 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+)
+
+var _ db.OutboxRepository = (*db.OutboxStore)(nil)
+
+// memoryOutbox mimics the claiming rules of OutboxStore.
+type memoryOutbox struct {
+	mu        sync.Mutex
+	msgs      []*row
+	now       func() time.Time
+	delivered []int64
+	purges    int
+}
+
+type row struct {
+	db.OutboxMessage
+	nextAttempt time.Time
+	lockedUntil time.Time
+	lastError   string
+	done        bool
+	deliveredAt time.Time
+	purged      bool
+}
+
+func (o *memoryOutbox) add(m db.OutboxMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	m.ID = int64(len(o.msgs) + 1)
+	o.msgs = append(o.msgs, &row{OutboxMessage: m})
+}
+
+func (o *memoryOutbox) ClaimOutbox(_ context.Context, limit int, lease time.Duration) ([]db.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	blocked := map[string]bool{}
+	var out []db.OutboxMessage
+	for _, r := range o.msgs {
+		if r.done {
+			continue
+		}
+		head := !blocked[r.AggregateID]
+		blocked[r.AggregateID] = true
+		if !head || r.nextAttempt.After(now) || r.lockedUntil.After(now) || len(out) == limit {
+			continue
+		}
+		r.lockedUntil = now.Add(lease)
+		r.Attempts++
+		out = append(out, r.OutboxMessage)
+	}
+	return out, nil
+}
+
+func (o *memoryOutbox) MarkDelivered(_ context.Context, id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r := o.msgs[id-1]
+	r.done, r.lockedUntil, r.deliveredAt = true, time.Time{}, o.now()
+	o.delivered = append(o.delivered, id)
+	return nil
+}
+
+func (o *memoryOutbox) MarkFailed(_ context.Context, id int64, retryAt time.Time, reason string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r := o.msgs[id-1]
+	r.nextAttempt, r.lockedUntil, r.lastError = retryAt, time.Time{}, reason
+	return nil
+}
+
+func (o *memoryOutbox) PurgeDelivered(_ context.Context, before time.Time, limit int) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.purges++
+	n := 0
+	for _, r := range o.msgs {
+		if n == limit {
+			break
+		}
+		if r.done && !r.purged && r.deliveredAt.Before(before) {
+			r.purged = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (o *memoryOutbox) purged() []int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var ids []int64
+	for _, r := range o.msgs {
+		if r.purged {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+type published struct {
+	kind, destination, payload string
+}
+
+type fakeBroker struct {
+	mu   sync.Mutex
+	sent []published
+	// fail rejects the next n publishes
+	fail int
+}
+
+func (b *fakeBroker) record(kind, dest string, body []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail > 0 {
+		b.fail--
+		return errors.New("broker unavailable")
+	}
+	b.sent = append(b.sent, published{kind, dest, string(body)})
+	return nil
+}
+
+func (b *fakeBroker) PublishToQueue(_ context.Context, queue string, body []byte) error {
+	return b.record(db.OutboxQueue, queue, body)
+}
+
+func (b *fakeBroker) PublishToTopic(_ context.Context, topic string, body []byte) error {
+	return b.record(db.OutboxTopic, topic, body)
+}
+
+func (b *fakeBroker) Close() error { return nil }
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestRelay(cfg config.OutboxConfig) (*Relay, *memoryOutbox, *fakeBroker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	repo := &memoryOutbox{now: clock.now}
+	b := &fakeBroker{}
+	r := NewRelay(repo, b, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r.now = clock.now
+	return r, repo, b, clock
+}
+
+func TestRelay_PublishesByKindAndMarksDelivered(t *testing.T) {
+	r, repo, b, _ := newTestRelay(config.OutboxConfig{BatchSize: 10})
+	repo.add(db.QueueMessage("u1", "email.confirm", []byte("mail")))
+	repo.add(db.TopicMessage("u2", "UserRegistered", []byte("event")))
+
+	n, err := r.relayBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []published{
+		{db.OutboxQueue, "email.confirm", "mail"},
+		{db.OutboxTopic, "UserRegistered", "event"},
+	}, b.sent)
+	require.Equal(t, []int64{1, 2}, repo.delivered)
+
+	n, err = r.relayBatch(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestRelay_KeepsOrderWithinAggregate(t *testing.T) {
+	r, repo, b, clock := newTestRelay(config.OutboxConfig{BatchSize: 10, BaseBackoff: time.Second, MaxBackoff: time.Minute})
+	repo.add(db.QueueMessage("u1", "email.confirm", []byte("first")))
+	repo.add(db.TopicMessage("u1", "UserRegistered", []byte("second")))
+	repo.add(db.TopicMessage("u2", "UserRegistered", []byte("other")))
+
+	// the first message of u1 fails; u1's second message must wait for it
+	b.fail = 1
+	_, err := r.relayBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []published{{db.OutboxTopic, "UserRegistered", "other"}}, b.sent)
+	require.Equal(t, "broker unavailable", repo.msgs[0].lastError)
+
+	// not yet due
+	n, _ := r.relayBatch(context.Background())
+	require.Zero(t, n)
+
+	clock.advance(time.Second)
+	_, _ = r.relayBatch(context.Background())
+	_, _ = r.relayBatch(context.Background())
+
+	var payloads []string
+	for _, p := range b.sent {
+		payloads = append(payloads, p.payload)
+	}
+	require.Equal(t, []string{"other", "first", "second"}, payloads)
+	ids := append([]int64(nil), repo.delivered...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	require.Equal(t, []int64{1, 2, 3}, ids)
+}
+
+func TestRelay_BackoffDoublesUpToMax(t *testing.T) {
+	r, _, _, _ := newTestRelay(config.OutboxConfig{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	require.Equal(t, time.Second, r.backoff(1))
+	require.Equal(t, 2*time.Second, r.backoff(2))
+	require.Equal(t, 8*time.Second, r.backoff(4))
+	require.Equal(t, 10*time.Second, r.backoff(5))
+	require.Equal(t, 10*time.Second, r.backoff(1000))
+}
+
+func TestRelay_RetriesUntilDelivered(t *testing.T) {
+	r, repo, b, clock := newTestRelay(config.OutboxConfig{BaseBackoff: time.Second, MaxBackoff: time.Minute})
+	repo.add(db.QueueMessage("u1", "email.confirm", []byte("mail")))
+
+	b.fail = 3
+	for i := 0; i < 4; i++ {
+		_, err := r.relayBatch(context.Background())
+		require.NoError(t, err)
+		clock.advance(time.Minute)
+	}
+	require.Len(t, b.sent, 1)
+	require.Equal(t, 4, repo.msgs[0].Attempts)
+	require.Equal(t, []int64{1}, repo.delivered)
+}
+
+func TestRelay_PurgesExpiredDeliveries(t *testing.T) {
+	r, repo, b, clock := newTestRelay(config.OutboxConfig{Retention: 24 * time.Hour, BaseBackoff: time.Hour})
+	repo.add(db.QueueMessage("u1", "email.confirm", []byte("first")))
+	repo.add(db.QueueMessage("u2", "email.confirm", []byte("second")))
+	_, _ = r.relayBatch(context.Background())
+
+	// undelivered messages are never purged
+	b.fail = 1
+	repo.add(db.QueueMessage("u3", "email.confirm", []byte("third")))
+	_, _ = r.relayBatch(context.Background())
+
+	r.maybePurge(context.Background())
+	require.Empty(t, repo.purged())
+	// and not again within purgeInterval
+	r.maybePurge(context.Background())
+	require.Equal(t, 1, repo.purges)
+
+	clock.advance(25 * time.Hour)
+	r.maybePurge(context.Background())
+	require.Equal(t, []int64{1, 2}, repo.purged())
+
+	_, _ = r.relayBatch(context.Background())
+	require.Len(t, b.sent, 3)
+
+	clock.advance(25 * time.Hour)
+	r.maybePurge(context.Background())
+	require.Equal(t, []int64{1, 2, 3}, repo.purged())
+}
+
+func TestRelay_RunStopsWithContext(t *testing.T) {
+	r, repo, b, _ := newTestRelay(config.OutboxConfig{PollInterval: time.Millisecond})
+	repo.add(db.QueueMessage("u1", "email.confirm", []byte("mail")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.sent) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
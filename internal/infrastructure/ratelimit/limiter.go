@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyClient = "client"
+)
+
+// Decision is the outcome of one request against a bucket. RetryAfter is
+// set when the request was refused and tells when a token is available.
+type Decision struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds, the unit of the
+// Retry-After header.
+func (d Decision) RetryAfterSeconds() int {
+	return int((d.RetryAfter + time.Second - 1) / time.Second)
+}
+
+// Limiter takes one token from the bucket key under policy p.
+type Limiter interface {
+	Allow(ctx context.Context, key string, p config.RateLimitPolicy) (Decision, error)
+}
+
+// New builds the limiter named by cfg.Backend; nil means rate limiting is
+// off.
+func New(cfg config.RateLimitConfig, redisCfg config.RedisConfig, log *slog.Logger) (Limiter, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewMemoryLimiter(), nil
+	case "redis":
+		return NewRedisLimiter(redisCfg, log), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+	}
+}
+
+// Rules resolves the policy that applies to a route.
+type Rules struct {
+	byRoute map[string]config.RateLimitPolicy
+	def     config.RateLimitPolicy
+}
+
+func NewRules(cfg config.RateLimitConfig) (*Rules, error) {
+	r := &Rules{byRoute: make(map[string]config.RateLimitPolicy), def: cfg.Default}
+	if r.def.Name == "" {
+		r.def.Name = "default"
+	}
+	if err := validate(r.def); err != nil {
+		return nil, err
+	}
+	for _, p := range cfg.Policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("rate limit policy without a name")
+		}
+		if err := validate(p); err != nil {
+			return nil, err
+		}
+		for _, route := range p.Routes {
+			if other, ok := r.byRoute[route]; ok {
+				return nil, fmt.Errorf("route %q is in rate limit policies %q and %q", route, other.Name, p.Name)
+			}
+			r.byRoute[route] = p
+		}
+	}
+	return r, nil
+}
+
+func validate(p config.RateLimitPolicy) error {
+	if p.Rate <= 0 {
+		return nil
+	}
+	if p.Per <= 0 {
+		return fmt.Errorf("rate limit policy %q: per must be positive", p.Name)
+	}
+	switch p.Key {
+	case KeyIP, KeyUser, KeyClient:
+		return nil
+	default:
+		return fmt.Errorf("rate limit policy %q: unknown key %q", p.Name, p.Key)
+	}
+}
+
+// For returns the policy for route, falling back to the default. ok is
+// false when the route is not limited at all.
+func (r *Rules) For(route string) (p config.RateLimitPolicy, ok bool) {
+	p, found := r.byRoute[route]
+	if !found {
+		p = r.def
+	}
+	return p, p.Rate > 0
+}
+
+// BucketKey names the bucket of subject (an IP, user or client id) under p.
+func BucketKey(p config.RateLimitPolicy, kind, subject string) string {
+	return "ratelimit:" + p.Name + ":" + kind + ":" + subject
+}
+
+// capacity and refill turn a policy into bucket parameters: the bucket
+// holds Burst tokens (Rate when unset) and gains one every Per/Rate.
+func capacity(p config.RateLimitPolicy) float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Rate)
+}
+
+func refill(p config.RateLimitPolicy) float64 {
+	return float64(p.Rate) / float64(p.Per)
+}
@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+var _ Limiter = (*MemoryLimiter)(nil)
+var _ Limiter = (*RedisLimiter)(nil)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter() (*MemoryLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	m := NewMemoryLimiter()
+	m.now = clock.now
+	return m, clock
+}
+
+func TestMemoryLimiter_BurstThenRefill(t *testing.T) {
+	m, clock := newTestLimiter()
+	p := config.RateLimitPolicy{Name: "login", Rate: 6, Per: time.Minute, Burst: 3, Key: KeyIP}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		d, err := m.Allow(ctx, "k", p)
+		require.NoError(t, err)
+		require.True(t, d.Allowed, "request %d", i)
+	}
+	d, err := m.Allow(ctx, "k", p)
+	require.NoError(t, err)
+	require.False(t, d.Allowed)
+	// one token every ten seconds
+	require.Equal(t, 10*time.Second, d.RetryAfter)
+	require.Equal(t, 10, d.RetryAfterSeconds())
+
+	clock.advance(4 * time.Second)
+	d, _ = m.Allow(ctx, "k", p)
+	require.False(t, d.Allowed)
+	require.Equal(t, 6*time.Second, d.RetryAfter)
+
+	clock.advance(6 * time.Second)
+	d, _ = m.Allow(ctx, "k", p)
+	require.True(t, d.Allowed)
+}
+
+func TestMemoryLimiter_RefillIsCappedAtBurst(t *testing.T) {
+	m, clock := newTestLimiter()
+	p := config.RateLimitPolicy{Name: "p", Rate: 60, Per: time.Minute, Burst: 2, Key: KeyIP}
+	ctx := context.Background()
+
+	clock.advance(time.Hour)
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if d, _ := m.Allow(ctx, "k", p); d.Allowed {
+			allowed++
+		}
+	}
+	require.Equal(t, 2, allowed)
+}
+
+func TestMemoryLimiter_KeysAreIndependent(t *testing.T) {
+	m, _ := newTestLimiter()
+	p := config.RateLimitPolicy{Name: "p", Rate: 1, Per: time.Minute, Key: KeyIP}
+	ctx := context.Background()
+
+	d, _ := m.Allow(ctx, "a", p)
+	require.True(t, d.Allowed)
+	d, _ = m.Allow(ctx, "a", p)
+	require.False(t, d.Allowed)
+	d, _ = m.Allow(ctx, "b", p)
+	require.True(t, d.Allowed)
+}
+
+func TestMemoryLimiter_SweepsFullBuckets(t *testing.T) {
+	m, clock := newTestLimiter()
+	p := config.RateLimitPolicy{Name: "p", Rate: 10, Per: time.Second, Key: KeyIP}
+	ctx := context.Background()
+
+	_, _ = m.Allow(ctx, "idle", p)
+	clock.advance(2 * sweepEvery)
+	_, _ = m.Allow(ctx, "busy", p)
+	require.NotContains(t, m.buckets, "idle")
+	require.Contains(t, m.buckets, "busy")
+}
+
+func TestRules(t *testing.T) {
+	rules, err := NewRules(config.RateLimitConfig{
+		Default: config.RateLimitPolicy{Rate: 100, Per: time.Minute, Key: KeyIP},
+		Policies: []config.RateLimitPolicy{{
+			Name:   "login",
+			Routes: []string{"POST /api/login", "/auth.AuthService/Login"},
+			Rate:   5, Per: time.Minute, Key: KeyIP,
+		}},
+	})
+	require.NoError(t, err)
+
+	grpcLogin, ok := rules.For("/auth.AuthService/Login")
+	require.True(t, ok)
+	require.Equal(t, "login", grpcLogin.Name)
+	restLogin, _ := rules.For("POST /api/login")
+	// REST and gRPC routes of a policy share its buckets
+	require.Equal(t, BucketKey(restLogin, KeyIP, "10.0.0.1"), BucketKey(grpcLogin, KeyIP, "10.0.0.1"))
+
+	p, ok := rules.For("GET /api/sessions")
+	require.True(t, ok)
+	require.Equal(t, "default", p.Name)
+}
+
+func TestRules_NoDefaultMeansUnlimited(t *testing.T) {
+	rules, err := NewRules(config.RateLimitConfig{})
+	require.NoError(t, err)
+	_, ok := rules.For("POST /api/login")
+	require.False(t, ok)
+}
+
+func TestRules_Invalid(t *testing.T) {
+	login := config.RateLimitPolicy{Name: "login", Routes: []string{"POST /api/login"}, Rate: 5, Per: time.Minute, Key: KeyIP}
+
+	cases := map[string]config.RateLimitConfig{
+		"unknown key":     {Policies: []config.RateLimitPolicy{{Name: "x", Rate: 1, Per: time.Second, Key: "session"}}},
+		"missing per":     {Policies: []config.RateLimitPolicy{{Name: "x", Rate: 1, Key: KeyIP}}},
+		"missing name":    {Policies: []config.RateLimitPolicy{{Rate: 1, Per: time.Second, Key: KeyIP}}},
+		"duplicate route": {Policies: []config.RateLimitPolicy{login, {Name: "other", Routes: login.Routes, Rate: 1, Per: time.Second, Key: KeyIP}}},
+	}
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewRules(cfg)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	l, err := New(config.RateLimitConfig{}, config.RedisConfig{}, nil)
+	require.NoError(t, err)
+	require.Nil(t, l)
+
+	l, err = New(config.RateLimitConfig{Backend: "memory"}, config.RedisConfig{}, nil)
+	require.NoError(t, err)
+	require.IsType(t, &MemoryLimiter{}, l)
+
+	_, err = New(config.RateLimitConfig{Backend: "etcd"}, config.RedisConfig{}, nil)
+	require.Error(t, err)
+}
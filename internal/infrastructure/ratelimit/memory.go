@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+// sweepEvery bounds how often idle buckets are dropped from memory.
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will have refilled completely
+}
+
+// MemoryLimiter keeps the buckets in process. Every replica counts on its
+// own, so it suits single instances and tests.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string, p config.RateLimitPolicy) (Decision, error) {
+	capTokens, rate := capacity(p), refill(p)
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capTokens, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = min(capTokens, b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	d := Decision{Allowed: b.tokens >= 1}
+	if d.Allowed {
+		b.tokens--
+	} else {
+		d.RetryAfter = time.Duration((1 - b.tokens) / rate)
+	}
+	b.full = now.Add(time.Duration((capTokens - b.tokens) / rate))
+	return d, nil
+}
+
+// sweep forgets buckets that have refilled completely; a fresh bucket would
+// be identical.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ParkieV/auth-service/internal/config"
+)
+
+// tokenBucket refills and drains the bucket in one step. Time comes from
+// the Redis server so replicas with drifting clocks agree. The bucket
+// expires once it would be full again.
+var tokenBucket = redis.NewScript(`
+	local capacity = tonumber(ARGV[1])
+	local rate = tonumber(ARGV[2])
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+	local b = redis.call("HMGET", KEYS[1], "tokens", "ts")
+	local tokens = tonumber(b[1]) or capacity
+	local ts = tonumber(b[2]) or now
+	tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+	local allowed, wait = 0, 0
+	if tokens >= 1 then
+		tokens = tokens - 1
+		allowed = 1
+	else
+		wait = math.ceil((1 - tokens) / rate)
+	end
+
+	redis.call("HSET", KEYS[1], "tokens", string.format("%.6f", tokens), "ts", string.format("%d", now))
+	redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1)
+	return {allowed, wait}
+`)
+
+// RedisLimiter keeps the buckets in Redis so all replicas share them.
+type RedisLimiter struct {
+	client *redis.Client
+	log    *slog.Logger
+}
+
+func NewRedisLimiter(cfg config.RedisConfig, log *slog.Logger) *RedisLimiter {
+	c := redis.NewClient(&redis.Options{
+		Addr: cfg.Addr,
+		DB:   cfg.DB,
+	})
+	return &RedisLimiter{client: c, log: log}
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, p config.RateLimitPolicy) (Decision, error) {
+	perMs := refill(p) * float64(time.Millisecond)
+	res, err := tokenBucket.Run(ctx, r.client, []string{key},
+		strconv.FormatFloat(capacity(p), 'f', -1, 64),
+		strconv.FormatFloat(perMs, 'g', -1, 64),
+	).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	return Decision{Allowed: res[0] == 1, RetryAfter: time.Duration(res[1]) * time.Millisecond}, nil
+}
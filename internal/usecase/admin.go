@@ -0,0 +1,446 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrSelfAction       = errors.New("admins cannot disable, delete or demote their own account")
+	// ErrProtectedRole guards the admin role: without it nobody could manage
+	// roles again short of editing the database.
+	ErrProtectedRole = errors.New("the admin role cannot be changed or deleted")
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type UserPage struct {
+	Users []*domain.User
+	Total int
+}
+
+type UserDetails struct {
+	User  *domain.User
+	Roles []string
+}
+
+// AdminUsecase operates on other users' accounts. Callers are expected to
+// have checked the operation's permission with Authorize; actorID is the
+// admin's id.
+type AdminUsecase struct {
+	repo   db.UserAdminRepository
+	roles  db.RoleRepository
+	ac     auth_client.AuthClient
+	cache  cache.Cache
+	broker broker.MessageBroker
+	ttl    time.Duration
+	audit  *AuditUsecase
+	log    *slog.Logger
+}
+
+func NewAdminUsecase(repo db.UserAdminRepository, roles db.RoleRepository, ac auth_client.AuthClient, cache cache.Cache, broker broker.MessageBroker, resetTTL time.Duration, audit *AuditUsecase, log *slog.Logger) *AdminUsecase {
+	return &AdminUsecase{repo: repo, roles: roles, ac: ac, cache: cache, broker: broker, ttl: resetTTL, audit: audit, log: log}
+}
+
+// Authorize checks that a verified access token grants permission. The
+// admin role passes every check: it holds all permissions and they cannot
+// be taken from it.
+func (uc *AdminUsecase) Authorize(access domain.Access, permission string) error {
+	if !access.HasRole(domain.RoleAdmin) && !access.Can(permission) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+func (uc *AdminUsecase) ListUsers(ctx context.Context, query string, limit, offset int) (*UserPage, error) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+	offset = max(offset, 0)
+
+	users, total, err := uc.repo.ListUsers(ctx, query, limit, offset)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("list users failed", "err", err)
+		return nil, err
+	}
+	return &UserPage{Users: users, Total: total}, nil
+}
+
+func (uc *AdminUsecase) GetUser(ctx context.Context, userID string) (*UserDetails, error) {
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	access, err := uc.roles.UserAccess(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("load user roles failed", "user_id", userID, "err", err)
+		return nil, err
+	}
+	return &UserDetails{User: user, Roles: access.Roles}, nil
+}
+
+// Disable blocks every login path and ends the user's sessions.
+func (uc *AdminUsecase) Disable(ctx context.Context, actorID, userID string) error {
+	if actorID == userID {
+		return ErrSelfAction
+	}
+	if err := uc.setDisabled(ctx, userID, true); err != nil {
+		return err
+	}
+	if err := uc.revokeAll(ctx, userID); err != nil {
+		return err
+	}
+	uc.record(ctx, actorID, domain.AuditAdminDisable, userID)
+	return nil
+}
+
+func (uc *AdminUsecase) Enable(ctx context.Context, actorID, userID string) error {
+	if err := uc.setDisabled(ctx, userID, false); err != nil {
+		return err
+	}
+	uc.record(ctx, actorID, domain.AuditAdminEnable, userID)
+	return nil
+}
+
+// Confirm marks the email confirmed without the emailed code. Consumers
+// get the same UserConfirmed event as for a confirmation by code.
+func (uc *AdminUsecase) Confirm(ctx context.Context, actorID, userID string) error {
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.IsConfirmed() {
+		return domain.ErrAlreadyConfirmed
+	}
+	event, err := confirmedEvent(userID, user.Email().String())
+	if err != nil {
+		uc.log.Error("marshal confirmed payload failed", "err", err)
+		return err
+	}
+	if err := uc.repo.MarkConfirmed(ctx, userID, event); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("mark confirmed failed", "user_id", userID, "err", err)
+		return err
+	}
+	uc.record(ctx, actorID, domain.AuditAdminConfirm, userID)
+	return nil
+}
+
+// ForcePasswordReset replaces the password with an unguessable one, ends all
+// sessions and emails the user a reset link, so the only way back in is
+// through their mailbox.
+func (uc *AdminUsecase) ForcePasswordReset(ctx context.Context, actorID, userID string) error {
+	user, err := uc.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	scrambled, err := generateToken()
+	if err != nil {
+		uc.log.Error("generate password failed", "err", err)
+		return err
+	}
+	pwd, err := domain.NewPasswordFromPlain(scrambled)
+	if err != nil {
+		return err
+	}
+	if err := uc.repo.UpdatePasswordHash(ctx, userID, pwd.Hash()); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("update password failed", "user_id", userID, "err", err)
+		return err
+	}
+	if err := uc.revokeAll(ctx, userID); err != nil {
+		return err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		uc.log.Error("generate reset token failed", "err", err)
+		return err
+	}
+	if err := uc.cache.Set(ctx, resetKeyPrefix+hashToken(token), userID, uc.ttl); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("store reset token failed", "err", err)
+		return err
+	}
+
+	msg := struct {
+		UserID string `json:"user_id"`
+		Email  string `json:"email"`
+		Token  string `json:"token"`
+	}{
+		UserID: userID,
+		Email:  user.Email().String(),
+		Token:  token,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal reset payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToQueue(ctx, "email.password_reset", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish reset email failed", "err", err)
+	}
+
+	uc.record(ctx, actorID, domain.AuditAdminPasswordReset, userID)
+	return nil
+}
+
+// Delete ends the user's sessions before removing the account so no token
+// outlives it.
+func (uc *AdminUsecase) Delete(ctx context.Context, actorID, userID string) error {
+	if actorID == userID {
+		return ErrSelfAction
+	}
+	if _, err := uc.findUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := uc.revokeAll(ctx, userID); err != nil {
+		return err
+	}
+	if err := uc.repo.Delete(ctx, userID); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			uc.log.Error("delete user failed", "user_id", userID, "err", err)
+		}
+		return err
+	}
+	uc.record(ctx, actorID, domain.AuditAdminDelete, userID)
+	return nil
+}
+
+func (uc *AdminUsecase) RevokeSessions(ctx context.Context, actorID, userID string) error {
+	if _, err := uc.findUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := uc.revokeAll(ctx, userID); err != nil {
+		return err
+	}
+	uc.record(ctx, actorID, domain.AuditAdminRevokeSessions, userID)
+	return nil
+}
+
+func (uc *AdminUsecase) ListRoles(ctx context.Context) ([]domain.Role, error) {
+	roles, err := uc.roles.ListRoles(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("list roles failed", "err", err)
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (uc *AdminUsecase) ListPermissions(ctx context.Context) ([]domain.Permission, error) {
+	perms, err := uc.roles.ListPermissions(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("list permissions failed", "err", err)
+		return nil, err
+	}
+	return perms, nil
+}
+
+// CreateRole adds a role granting existing permissions only; permissions
+// themselves come from the migrations.
+func (uc *AdminUsecase) CreateRole(ctx context.Context, actorID, name, description string, permissions []string) (*domain.Role, error) {
+	role, err := domain.NewRole(name, description, permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.roles.CreateRole(ctx, role); err != nil {
+		return nil, uc.roleError(ctx, "create role failed", name, err)
+	}
+	uc.recordRole(ctx, actorID, domain.AuditAdminRoleCreate, "", name)
+	return role, nil
+}
+
+// SetRolePermissions replaces what a role grants. Holders see the change
+// in their next access token.
+func (uc *AdminUsecase) SetRolePermissions(ctx context.Context, actorID, name string, permissions []string) error {
+	if name == domain.RoleAdmin {
+		return ErrProtectedRole
+	}
+	if _, err := domain.NewRole(name, "", permissions); err != nil {
+		return err
+	}
+	if err := uc.roles.SetRolePermissions(ctx, name, permissions); err != nil {
+		return uc.roleError(ctx, "set role permissions failed", name, err)
+	}
+	uc.recordRole(ctx, actorID, domain.AuditAdminRoleUpdate, "", name)
+	return nil
+}
+
+func (uc *AdminUsecase) DeleteRole(ctx context.Context, actorID, name string) error {
+	if name == domain.RoleAdmin {
+		return ErrProtectedRole
+	}
+	if err := uc.roles.DeleteRole(ctx, name); err != nil {
+		return uc.roleError(ctx, "delete role failed", name, err)
+	}
+	uc.recordRole(ctx, actorID, domain.AuditAdminRoleDelete, "", name)
+	return nil
+}
+
+// AssignRole grants a role to a user; it takes effect with their next
+// access token.
+func (uc *AdminUsecase) AssignRole(ctx context.Context, actorID, userID, role string) error {
+	if _, err := uc.findUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := uc.roles.AssignRole(ctx, userID, role); err != nil {
+		return uc.roleError(ctx, "assign role failed", role, err)
+	}
+	uc.recordRole(ctx, actorID, domain.AuditAdminRoleAssign, userID, role)
+	return nil
+}
+
+// UnassignRole takes a role away. Admins cannot drop their own admin role
+// so the last admin cannot lock everyone out.
+func (uc *AdminUsecase) UnassignRole(ctx context.Context, actorID, userID, role string) error {
+	if actorID == userID && role == domain.RoleAdmin {
+		return ErrSelfAction
+	}
+	if _, err := uc.findUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := uc.roles.UnassignRole(ctx, userID, role); err != nil {
+		return uc.roleError(ctx, "unassign role failed", role, err)
+	}
+	uc.recordRole(ctx, actorID, domain.AuditAdminRoleUnassign, userID, role)
+	return nil
+}
+
+// AuditLog reads the audit log, newest entries first.
+func (uc *AdminUsecase) AuditLog(ctx context.Context, q domain.AuditQuery) ([]domain.AuditEvent, error) {
+	return uc.audit.List(ctx, q)
+}
+
+func (uc *AdminUsecase) findUser(ctx context.Context, userID string) (*domain.User, error) {
+	user, err := uc.repo.FindByID(ctx, userID)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, domain.ErrUserNotFound):
+			return nil, err
+		default:
+			uc.log.Error("find user failed", "user_id", userID, "err", err)
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (uc *AdminUsecase) setDisabled(ctx context.Context, userID string, disabled bool) error {
+	if err := uc.repo.SetDisabled(ctx, userID, disabled); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, domain.ErrUserNotFound):
+			return err
+		default:
+			uc.log.Error("set disabled failed", "user_id", userID, "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (uc *AdminUsecase) revokeAll(ctx context.Context, userID string) error {
+	if err := uc.ac.RevokeAll(ctx, userID); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("revoke sessions failed", "user_id", userID, "err", err)
+		return err
+	}
+	if _, err := uc.cache.DeleteUserRefresh(ctx, userID); err != nil {
+		uc.log.WarnContext(ctx, "cache purge failed", "err", err)
+	}
+	return nil
+}
+
+func (uc *AdminUsecase) roleError(ctx context.Context, msg, role string, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.Is(err, domain.ErrRoleNotFound),
+		errors.Is(err, domain.ErrRoleExists),
+		errors.Is(err, domain.ErrPermissionNotFound):
+		return err
+	default:
+		uc.log.Error(msg, "role", role, "err", err)
+		return err
+	}
+}
+
+// record writes who did what to whom to the audit log and publishes it as
+// an AdminAction event for downstream consumers.
+func (uc *AdminUsecase) record(ctx context.Context, actorID, action, targetID string) {
+	uc.recordRole(ctx, actorID, action, targetID, "")
+}
+
+// recordRole is record for role changes; targetID is empty when the role
+// itself was changed rather than a user's roles.
+func (uc *AdminUsecase) recordRole(ctx context.Context, actorID, action, targetID, role string) {
+	var detail string
+	if role != "" {
+		detail = "role=" + role
+	}
+	uc.audit.Record(ctx, domain.AuditEvent{ActorID: actorID, UserID: targetID, Action: action, Outcome: domain.AuditSuccess, Detail: detail})
+
+	msg := struct {
+		ActorID  string `json:"actor_id"`
+		Action   string `json:"action"`
+		TargetID string `json:"target_id,omitempty"`
+		Role     string `json:"role,omitempty"`
+	}{
+		ActorID:  actorID,
+		Action:   action,
+		TargetID: targetID,
+		Role:     role,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal admin action payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToTopic(ctx, "AdminAction", body); err != nil && ctx.Err() == nil {
+		uc.log.Error("publish admin action failed", "err", err)
+	}
+}
@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"context"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+type clientKey struct{}
+
+// WithClient attaches the caller's device to ctx so audit entries written
+// deeper down can name the IP and user agent. Transports set it for every
+// request.
+func WithClient(ctx context.Context, client domain.ClientInfo) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func clientFrom(ctx context.Context) domain.ClientInfo {
+	client, _ := ctx.Value(clientKey{}).(domain.ClientInfo)
+	return client
+}
+
+// AuditUsecase writes and reads the audit log. Writing never fails the
+// action being recorded: by the time it is written the action has already
+// happened, so a storage error is logged instead. A nil repository turns
+// recording off.
+type AuditUsecase struct {
+	repo db.AuditRepository
+	log  *slog.Logger
+}
+
+func NewAuditUsecase(repo db.AuditRepository, log *slog.Logger) *AuditUsecase {
+	return &AuditUsecase{repo: repo, log: log}
+}
+
+// Record appends e, filling the client from ctx where e leaves it empty.
+func (uc *AuditUsecase) Record(ctx context.Context, e domain.AuditEvent) {
+	if uc.repo == nil {
+		return
+	}
+	client := clientFrom(ctx)
+	if e.IP == "" {
+		e.IP = client.IP
+	}
+	if e.UserAgent == "" {
+		e.UserAgent = client.UserAgent
+	}
+	// the request may be cancelled right after the action succeeded; the
+	// entry must still be written
+	if err := uc.repo.AppendAudit(context.WithoutCancel(ctx), e); err != nil {
+		uc.log.Error("write audit log failed", "action", e.Action, "user_id", e.UserID, "err", err)
+	}
+}
+
+// Success records an action users take on their own account.
+func (uc *AuditUsecase) Success(ctx context.Context, action, userID string) {
+	uc.Record(ctx, domain.AuditEvent{ActorID: userID, UserID: userID, Action: action, Outcome: domain.AuditSuccess})
+}
+
+// Failure records a refused attempt; reason says why.
+func (uc *AuditUsecase) Failure(ctx context.Context, action, userID string, reason error) {
+	uc.Record(ctx, domain.AuditEvent{ActorID: userID, UserID: userID, Action: action, Outcome: domain.AuditFailure, Detail: reason.Error()})
+}
+
+func (uc *AuditUsecase) List(ctx context.Context, q domain.AuditQuery) ([]domain.AuditEvent, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultAuditPageSize
+	}
+	q.Limit = min(q.Limit, maxAuditPageSize)
+
+	events, err := uc.repo.ListAudit(ctx, q)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("list audit log failed", "err", err)
+		return nil, err
+	}
+	return events, nil
+}
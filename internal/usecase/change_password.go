@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+type ChangePasswordUsecase struct {
+	repo   db.UserMutRepository
+	ac     auth_client.AuthClient
+	cache  cache.Cache
+	broker broker.MessageBroker
+	audit  *AuditUsecase
+	log    *slog.Logger
+}
+
+func NewChangePasswordUsecase(repo db.UserMutRepository, ac auth_client.AuthClient, cache cache.Cache, broker broker.MessageBroker, audit *AuditUsecase, log *slog.Logger) *ChangePasswordUsecase {
+	return &ChangePasswordUsecase{repo: repo, ac: ac, cache: cache, broker: broker, audit: audit, log: log}
+}
+
+// ChangePassword keeps the session identified by accessToken alive; when
+// revokeOthers is set every other session of the user is revoked.
+func (uc *ChangePasswordUsecase) ChangePassword(ctx context.Context, userID, accessToken, currentPassword, newPassword string, revokeOthers bool) error {
+	user, err := uc.repo.FindByID(ctx, userID)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		uc.log.Error("find user failed", "user_id", userID, "err", err)
+		return ErrUserNotFound
+	}
+
+	if ok, _ := user.VerifyPassword(currentPassword); !ok {
+		uc.audit.Failure(ctx, domain.AuditPasswordChange, user.ID(), ErrInvalidCredentials)
+		return ErrInvalidCredentials
+	}
+
+	pwd, err := domain.NewPasswordFromPlain(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.repo.UpdatePasswordHash(ctx, user.ID(), pwd.Hash()); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("update password failed", "err", err)
+		return err
+	}
+	uc.audit.Success(ctx, domain.AuditPasswordChange, user.ID())
+
+	var revoked []string
+	if revokeOthers {
+		revoked, err = uc.ac.RevokeOthers(ctx, user.ID(), accessToken)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			uc.log.Error("revoke sessions failed", "user_id", user.ID(), "err", err)
+			return err
+		}
+		for _, rt := range revoked {
+			if err := uc.cache.Delete(ctx, rt); err != nil {
+				uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+			}
+		}
+	}
+
+	msg := struct {
+		UserID          string `json:"user_id"`
+		RevokedSessions int    `json:"revoked_sessions"`
+	}{
+		UserID:          user.ID(),
+		RevokedSessions: len(revoked),
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal password changed payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToTopic(ctx, "UserPasswordChanged", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish password changed failed", "err", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+type ConfirmEmailUsecase struct {
+	repo  db.UserMutRepository
+	audit *AuditUsecase
+	log   *slog.Logger
+}
+
+func NewConfirmEmailUsecase(repo db.UserMutRepository, audit *AuditUsecase, log *slog.Logger) *ConfirmEmailUsecase {
+	return &ConfirmEmailUsecase{repo: repo, audit: audit, log: log}
+}
+
+func (uc *ConfirmEmailUsecase) Confirm(ctx context.Context, emailStr, code string) error {
+	email, err := domain.NewEmail(strings.TrimSpace(emailStr))
+	if err != nil {
+		uc.log.Info("invalid email", "email", emailStr, "err", err)
+		return err
+	}
+
+	user, err := uc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// answered like a wrong code, so the endpoint does not reveal
+		// which addresses are registered
+		uc.log.Info("confirm for unknown user", "email", email)
+		return domain.ErrInvalidConfirmationCode
+	}
+
+	if err := user.Confirm(strings.TrimSpace(code), time.Now()); err != nil {
+		uc.log.Info("confirmation rejected", "user_id", user.ID(), "err", err)
+		uc.audit.Failure(ctx, domain.AuditEmailConfirm, user.ID(), err)
+		return err
+	}
+
+	event, err := confirmedEvent(user.ID(), email.String())
+	if err != nil {
+		uc.log.Error("marshal confirmed payload failed", "err", err)
+		return err
+	}
+
+	if err := uc.repo.MarkConfirmed(ctx, user.ID(), event); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("mark confirmed failed", "err", err)
+		return err
+	}
+	uc.audit.Success(ctx, domain.AuditEmailConfirm, user.ID())
+
+	return nil
+}
+
+// confirmedEvent is the UserConfirmed message written with the confirmation,
+// however the email came to be confirmed.
+func confirmedEvent(userID, email string) (db.OutboxMessage, error) {
+	body, err := json.Marshal(struct {
+		UserID string `json:"user_id"`
+		Email  string `json:"email"`
+	}{
+		UserID: userID,
+		Email:  email,
+	})
+	if err != nil {
+		return db.OutboxMessage{}, err
+	}
+	return db.TopicMessage(userID, "UserConfirmed", body), nil
+}
@@ -0,0 +1,19 @@
+package usecase
+
+import (
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+type JWKSUsecase struct {
+	keys auth_client.KeySetProvider
+}
+
+func NewJWKSUsecase(keys auth_client.KeySetProvider) *JWKSUsecase {
+	return &JWKSUsecase{keys: keys}
+}
+
+func (uc *JWKSUsecase) KeySet() jose.JSONWebKeySet {
+	return uc.keys.JWKS()
+}
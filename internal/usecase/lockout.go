@@ -0,0 +1,262 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var (
+	ErrAccountLocked = errors.New("too many failed logins, try again later")
+)
+
+const (
+	lockoutFailPrefix = "login_fail:"
+	lockoutLockPrefix = "login_lock:"
+)
+
+// LockedError is returned while a lock is in force; errors.Is(err,
+// ErrAccountLocked) holds for it.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string { return ErrAccountLocked.Error() }
+func (e *LockedError) Unwrap() error { return ErrAccountLocked }
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds, the unit of the
+// Retry-After header.
+func (e *LockedError) RetryAfterSeconds() int {
+	return int((e.RetryAfter + time.Second - 1) / time.Second)
+}
+
+// LoginGuard throttles password guessing. Failures are counted per account
+// (the email as typed, so unknown addresses are throttled the same way)
+// and per client IP. Each failure is answered with a growing delay; once a
+// counter reaches its limit further logins are refused until the lock
+// expires or an operator lifts it.
+type LoginGuard struct {
+	cache  cache.Cache
+	broker broker.MessageBroker
+	cfg    config.LockoutConfig
+	audit  *AuditUsecase
+	log    *slog.Logger
+}
+
+func NewLoginGuard(cache cache.Cache, broker broker.MessageBroker, cfg config.LockoutConfig, audit *AuditUsecase, log *slog.Logger) *LoginGuard {
+	return &LoginGuard{cache: cache, broker: broker, cfg: cfg, audit: audit, log: log}
+}
+
+func accountKey(email string) string { return "account:" + strings.ToLower(strings.TrimSpace(email)) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// Check refuses the attempt with a *LockedError while the account or the
+// IP is locked.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	keys := make([]string, 0, 2)
+	if g.cfg.MaxAccountFailures > 0 {
+		keys = append(keys, accountKey(email))
+	}
+	if g.cfg.MaxIPFailures > 0 && ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	for _, key := range keys {
+		until, err := g.lockedUntil(ctx, key)
+		if err != nil {
+			return err
+		}
+		if left := time.Until(until); left > 0 {
+			return &LockedError{RetryAfter: left}
+		}
+	}
+	return nil
+}
+
+// Fail records a failed attempt, locks whatever reached its limit and then
+// waits out the progressive delay. userID is empty for unknown emails.
+func (g *LoginGuard) Fail(ctx context.Context, email, userID, ip string) {
+	// the delay follows the account counter; without one, the IP counter
+	var n int64
+	if g.cfg.MaxAccountFailures > 0 {
+		n = g.count(ctx, accountKey(email))
+		if n >= int64(g.cfg.MaxAccountFailures) {
+			until := g.lock(ctx, accountKey(email))
+			g.log.Warn("account locked out", "user_id", userID, "ip", ip, "failures", n)
+			if userID != "" {
+				g.publish(ctx, userID, email, ip, until)
+			}
+		}
+	}
+	if g.cfg.MaxIPFailures > 0 && ip != "" {
+		ipN := g.count(ctx, ipKey(ip))
+		if ipN >= int64(g.cfg.MaxIPFailures) {
+			g.lock(ctx, ipKey(ip))
+			g.log.Warn("ip locked out", "ip", ip, "failures", ipN)
+		}
+		if g.cfg.MaxAccountFailures <= 0 {
+			n = ipN
+		}
+	}
+	g.wait(ctx, g.delay(n))
+}
+
+// Succeed clears the account's failure history after a correct password.
+// The IP counter is left alone: one valid account must not reset a spray
+// over many others.
+func (g *LoginGuard) Succeed(ctx context.Context, email string) {
+	if g.cfg.MaxAccountFailures <= 0 {
+		return
+	}
+	if err := g.cache.Delete(ctx, lockoutFailPrefix+accountKey(email)); err != nil {
+		g.log.WarnContext(ctx, "cache remove failed", "err", err)
+	}
+}
+
+// LockStatus reports when the lock on an account ends; zero when unlocked.
+func (g *LoginGuard) LockStatus(ctx context.Context, email string) (time.Time, error) {
+	until, err := g.lockedUntil(ctx, accountKey(email))
+	if err != nil || time.Until(until) <= 0 {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// Unlock lifts an account lock and forgets its failures. actor names the
+// operator for the audit log.
+func (g *LoginGuard) Unlock(ctx context.Context, actor, email string) error {
+	if err := g.clear(ctx, accountKey(email)); err != nil {
+		return err
+	}
+	g.audit.Record(ctx, domain.AuditEvent{
+		ActorID: actor,
+		Email:   strings.ToLower(strings.TrimSpace(email)),
+		Action:  domain.AuditLockoutUnlock,
+		Outcome: domain.AuditSuccess,
+	})
+	return nil
+}
+
+// UnlockIP lifts an IP lock and forgets its failures.
+func (g *LoginGuard) UnlockIP(ctx context.Context, actor, ip string) error {
+	if err := g.clear(ctx, ipKey(ip)); err != nil {
+		return err
+	}
+	g.audit.Record(ctx, domain.AuditEvent{
+		ActorID: actor,
+		Action:  domain.AuditLockoutUnlock,
+		Outcome: domain.AuditSuccess,
+		IP:      ip,
+	})
+	return nil
+}
+
+func (g *LoginGuard) clear(ctx context.Context, key string) error {
+	for _, k := range []string{lockoutLockPrefix + key, lockoutFailPrefix + key} {
+		if err := g.cache.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *LoginGuard) lockedUntil(ctx context.Context, key string) (time.Time, error) {
+	v, err := g.cache.Get(ctx, lockoutLockPrefix+key)
+	switch {
+	case errors.Is(err, cache.ErrKeyNotFound):
+		return time.Time{}, nil
+	case err != nil:
+		if ctx.Err() != nil {
+			return time.Time{}, ctx.Err()
+		}
+		// fail open: a cache outage must not lock everybody out
+		g.log.Error("read login lock failed", "err", err)
+		return time.Time{}, nil
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (g *LoginGuard) count(ctx context.Context, key string) int64 {
+	n, err := g.cache.IncrWindow(ctx, lockoutFailPrefix+key, g.cfg.Window)
+	if err != nil {
+		if ctx.Err() == nil {
+			g.log.Error("count login failure failed", "err", err)
+		}
+		return 0
+	}
+	return n
+}
+
+// lock stores the end of the lock as its value so Check can report how
+// long is left; the key expires on its own, which is the automatic unlock.
+func (g *LoginGuard) lock(ctx context.Context, key string) time.Time {
+	until := time.Now().Add(g.cfg.LockDuration)
+	if err := g.cache.Set(ctx, lockoutLockPrefix+key, strconv.FormatInt(until.UnixMilli(), 10), g.cfg.LockDuration); err != nil {
+		g.log.Error("store login lock failed", "err", err)
+	}
+	// the next window starts from scratch once the lock expires
+	if err := g.cache.Delete(ctx, lockoutFailPrefix+key); err != nil {
+		g.log.WarnContext(ctx, "cache remove failed", "err", err)
+	}
+	return until
+}
+
+// delay doubles BaseDelay with every failure after the first, up to MaxDelay.
+func (g *LoginGuard) delay(failures int64) time.Duration {
+	if failures <= 0 || g.cfg.BaseDelay <= 0 {
+		return 0
+	}
+	d := g.cfg.BaseDelay
+	for i := int64(1); i < failures && (g.cfg.MaxDelay <= 0 || d < g.cfg.MaxDelay); i++ {
+		d *= 2
+	}
+	if g.cfg.MaxDelay > 0 && d > g.cfg.MaxDelay {
+		d = g.cfg.MaxDelay
+	}
+	return d
+}
+
+func (g *LoginGuard) wait(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+func (g *LoginGuard) publish(ctx context.Context, userID, email, ip string, until time.Time) {
+	msg := struct {
+		UserID      string    `json:"user_id"`
+		Email       string    `json:"email"`
+		IP          string    `json:"ip"`
+		LockedUntil time.Time `json:"locked_until"`
+	}{
+		UserID:      userID,
+		Email:       email,
+		IP:          ip,
+		LockedUntil: until.UTC(),
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		g.log.Error("marshal lockout payload failed", "err", err)
+	}
+	if err := g.broker.PublishToTopic(ctx, "UserLockedOut", body); err != nil && ctx.Err() == nil {
+		g.log.Error("publish lockout event failed", "err", err)
+	}
+}
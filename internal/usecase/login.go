@@ -9,6 +9,7 @@ import (
 	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
 	"github.com/ParkieV/auth-service/internal/infrastructure/db"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/ParkieV/auth-service/internal/domain"
@@ -17,44 +18,69 @@ import (
 var (
 	ErrNotConfirmed       = errors.New("email not confirmed")
 	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserNotFound       = errors.New("user not found")
+	ErrUserNotFound       = domain.ErrUserNotFound
+	ErrAccountDisabled    = errors.New("account disabled")
+	ErrInvalidMFAToken    = errors.New("invalid or expired mfa token")
+)
+
+const (
+	mfaChallengePrefix = "mfa_challenge:"
+	mfaAttemptsPrefix  = "mfa_attempts:"
 )
 
 type LoginUsecase struct {
-	repo   db.UserMutRepository
-	ac     auth_client.AuthClient
-	cache  cache.Cache
-	broker broker.MessageBroker
-	log    *slog.Logger
+	repo             db.UserMutRepository
+	mfa              db.MFARepository
+	passkeys         db.WebAuthnRepository
+	guard            *LoginGuard
+	ac               auth_client.AuthClient
+	cache            cache.Cache
+	broker           broker.MessageBroker
+	requireConfirmed bool
+	challengeTTL     time.Duration
+	maxAttempts      int
+	audit            *AuditUsecase
+	log              *slog.Logger
 }
 
-func NewLoginUsecase(repo db.UserMutRepository, ac auth_client.AuthClient, cache cache.Cache, broker broker.MessageBroker, log *slog.Logger) *LoginUsecase {
-	return &LoginUsecase{repo: repo, ac: ac, cache: cache, broker: broker, log: log}
+func NewLoginUsecase(repo db.UserMutRepository, mfa db.MFARepository, passkeys db.WebAuthnRepository, guard *LoginGuard, ac auth_client.AuthClient, cache cache.Cache, broker broker.MessageBroker, requireConfirmed bool, challengeTTL time.Duration, maxAttempts int, audit *AuditUsecase, log *slog.Logger) *LoginUsecase {
+	return &LoginUsecase{repo: repo, mfa: mfa, passkeys: passkeys, guard: guard, ac: ac, cache: cache, broker: broker, requireConfirmed: requireConfirmed, challengeTTL: challengeTTL, maxAttempts: maxAttempts, audit: audit, log: log}
 }
 
-func (uc *LoginUsecase) Login(ctx context.Context, emailStr, plainPassword string) (string, string, error) {
+func (uc *LoginUsecase) Login(ctx context.Context, emailStr, plainPassword string, client domain.ClientInfo) (string, string, error) {
 	email, err := domain.NewEmail(emailStr)
 	if err != nil {
 		uc.log.Error("could not parse email", "err", err)
 		return "", "", err
 	}
+	if err := uc.guard.Check(ctx, email.String(), client.IP); err != nil {
+		uc.fail(ctx, "", email.String(), client, err)
+		return "", "", err
+	}
 
 	user, err := uc.repo.FindByEmail(ctx, email)
 	if err != nil {
-		uc.log.Error("AUF1", "email", email)
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return "", "", ctxErr
 		}
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			uc.log.Error("find user failed", "err", err)
+		}
+		uc.guard.Fail(ctx, email.String(), "", client.IP)
+		uc.fail(ctx, "", email.String(), client, ErrUserNotFound)
 		return "", "", ErrUserNotFound
 	}
-	//if !user.IsConfirmed() {
-	//	return "", "", ErrNotConfirmed
-	//}
 
 	ok, needRehash := user.VerifyPassword(plainPassword)
 	if !ok {
+		uc.guard.Fail(ctx, email.String(), user.ID(), client.IP)
+		uc.fail(ctx, user.ID(), email.String(), client, ErrInvalidCredentials)
 		return "", "", ErrInvalidCredentials
 	}
+	if err := uc.admit(user); err != nil {
+		uc.fail(ctx, user.ID(), email.String(), client, err)
+		return "", "", err
+	}
 
 	defer func() {
 		if needRehash {
@@ -66,18 +92,239 @@ func (uc *LoginUsecase) Login(ctx context.Context, emailStr, plainPassword strin
 		}
 	}()
 
-	access, refresh, err := uc.ac.GenerateTokens(ctx, user.ID())
+	access, refresh, err := uc.signIn(ctx, user.ID(), client)
+	if err == nil {
+		// a pending second factor leaves the failures counted until it passes
+		uc.guard.Succeed(ctx, email.String())
+	}
+	return access, refresh, err
+}
+
+// admit refuses accounts that may not sign in, whichever first factor
+// they presented.
+func (uc *LoginUsecase) admit(user *domain.User) error {
+	if user.IsDisabled() {
+		return ErrAccountDisabled
+	}
+	if uc.requireConfirmed && !user.IsConfirmed() {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+// fail records a refused login. userID is empty when the account is not
+// known, email when the attempt did not name one.
+func (uc *LoginUsecase) fail(ctx context.Context, userID, email string, client domain.ClientInfo, reason error) {
+	uc.audit.Record(ctx, domain.AuditEvent{
+		ActorID:   userID,
+		UserID:    userID,
+		Email:     email,
+		Action:    domain.AuditLogin,
+		Outcome:   domain.AuditFailure,
+		Detail:    reason.Error(),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+}
+
+// signIn runs after the first factor has been checked: it either issues the
+// tokens or, when a second factor is enrolled, returns an MFAChallenge.
+func (uc *LoginUsecase) signIn(ctx context.Context, userID string, client domain.ClientInfo) (string, string, error) {
+	methods, err := uc.mfaMethods(ctx, userID)
 	if err != nil {
-		uc.log.Error("ERRORRR HERE", "error", err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", "", ctxErr
+		}
+		uc.log.Error("load mfa enrollment failed", "user_id", userID, "err", err)
+		return "", "", err
+	}
+	if len(methods) > 0 {
+		return "", "", uc.challenge(ctx, userID, methods)
+	}
+
+	return uc.issue(ctx, userID, client)
+}
+
+// VerifyMFA completes a login that returned an MFAChallenge. A challenge
+// survives wrong codes up to maxAttempts but is consumed by the first
+// correct one. Wrong codes also count towards the account lockout, like
+// wrong passwords.
+func (uc *LoginUsecase) VerifyMFA(ctx context.Context, mfaToken, code string, client domain.ClientInfo) (string, string, error) {
+	hash := hashToken(strings.TrimSpace(mfaToken))
+	userID, err := uc.attempt(ctx, hash)
+	if err != nil {
+		return "", "", err
+	}
+	user, err := uc.repo.FindByID(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return "", "", ErrInvalidMFAToken
+		}
+		uc.log.Error("find user failed", "user_id", userID, "err", err)
+		return "", "", err
+	}
+
+	totp, err := uc.mfa.FindTOTP(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		if errors.Is(err, domain.ErrMFANotEnrolled) {
+			return "", "", ErrInvalidMFAToken
+		}
+		uc.log.Error("load mfa enrollment failed", "user_id", userID, "err", err)
+		return "", "", err
+	}
+	if err := uc.verifyTOTP(ctx, totp, code); err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		if !errors.Is(err, domain.ErrInvalidOTP) {
+			uc.log.Error("verify second factor failed", "user_id", userID, "err", err)
+			return "", "", err
+		}
+		uc.secondFactorFailed(ctx, user, client, err)
+		return "", "", err
+	}
+
+	return uc.complete(ctx, hash, user, client)
+}
+
+// verifyTOTP checks a code or recovery code against a confirmed enrollment.
+// A pending one does not count as a second factor, as in mfaMethods: the
+// challenge may have been issued for a passkey.
+func (uc *LoginUsecase) verifyTOTP(ctx context.Context, totp *domain.TOTP, code string) error {
+	if !totp.Confirmed {
+		return domain.ErrInvalidOTP
+	}
+	return verifySecondFactor(ctx, uc.mfa, totp, code)
+}
+
+// secondFactorFailed counts a wrong second factor against the lockout and
+// records it.
+func (uc *LoginUsecase) secondFactorFailed(ctx context.Context, user *domain.User, client domain.ClientInfo, reason error) {
+	uc.guard.Fail(ctx, user.Email().String(), user.ID(), client.IP)
+	uc.fail(ctx, user.ID(), user.Email().String(), client, reason)
+}
+
+// attempt resolves the challenge stored under hash and counts one
+// verification attempt against it.
+func (uc *LoginUsecase) attempt(ctx context.Context, hash string) (string, error) {
+	userID, err := uc.cache.Get(ctx, mfaChallengePrefix+hash)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return "", ctx.Err()
+		case errors.Is(err, cache.ErrKeyNotFound):
+			return "", ErrInvalidMFAToken
+		default:
+			uc.log.Error("cache get failed", "err", err)
+			return "", err
+		}
+	}
+
+	n, err := uc.cache.Incr(ctx, mfaAttemptsPrefix+hash, uc.challengeTTL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		uc.log.Error("mfa attempt counter failed", "err", err)
+		return "", err
+	}
+	if uc.maxAttempts > 0 && n > int64(uc.maxAttempts) {
+		uc.log.Info("mfa attempts exhausted", "user_id", userID)
+		if err := uc.cache.Delete(ctx, mfaChallengePrefix+hash); err != nil {
+			uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+		}
+		return "", ErrInvalidMFAToken
+	}
+	return userID, nil
+}
+
+// complete consumes the challenge after a successful second factor, issues
+// the tokens and only then clears the account's failed attempts.
+func (uc *LoginUsecase) complete(ctx context.Context, hash string, user *domain.User, client domain.ClientInfo) (string, string, error) {
+	// a concurrent request may have consumed the challenge in the meantime
+	if _, err := uc.cache.GetDel(ctx, mfaChallengePrefix+hash); err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		return "", "", ErrInvalidMFAToken
+	}
+
+	access, refresh, err := uc.issue(ctx, user.ID(), client)
+	if err != nil {
+		return "", "", err
+	}
+	uc.guard.Succeed(ctx, user.Email().String())
+	return access, refresh, nil
+}
+
+func (uc *LoginUsecase) mfaMethods(ctx context.Context, userID string) ([]string, error) {
+	var methods []string
+
+	totp, err := uc.mfa.FindTOTP(ctx, userID)
+	switch {
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+	case err != nil:
+		return nil, err
+	case totp.Confirmed:
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	n, err := uc.passkeys.CountCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+func (uc *LoginUsecase) challenge(ctx context.Context, userID string, methods []string) error {
+	token, err := generateToken()
+	if err != nil {
+		uc.log.Error("generate mfa token failed", "err", err)
+		return err
+	}
+	if err := uc.cache.Set(ctx, mfaChallengePrefix+hashToken(token), userID, uc.challengeTTL); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("store mfa challenge failed", "err", err)
+		return err
+	}
+	return &MFAChallenge{Token: token, Methods: methods}
+}
+
+func (uc *LoginUsecase) issue(ctx context.Context, userID string, client domain.ClientInfo) (string, string, error) {
+	// checked before the new session exists, or it would always match
+	newDevice := uc.isNewDevice(ctx, userID, client)
+
+	access, refresh, err := uc.ac.GenerateTokens(ctx, userID, client)
+	if err != nil {
+		uc.log.Error("generate tokens failed", "err", err)
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return "", "", ctxErr
 		}
 		return "", "", ErrInvalidCredentials
 	}
 
-	if err := uc.cache.Set(ctx, refresh, user.ID(), 24*time.Hour); err != nil {
+	if err := uc.cache.SetRefresh(ctx, userID, refresh, 24*time.Hour); err != nil {
 		uc.log.WarnContext(ctx, "cache set failed", "err", err)
 	}
+	uc.audit.Record(ctx, domain.AuditEvent{
+		ActorID:   userID,
+		UserID:    userID,
+		Action:    domain.AuditLogin,
+		Outcome:   domain.AuditSuccess,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
 
 	msg := struct {
 		AccessToken  string `json:"access_token"`
@@ -98,5 +345,63 @@ func (uc *LoginUsecase) Login(ctx context.Context, emailStr, plainPassword strin
 		uc.log.Error("publish confirm email failed", "err", err)
 	}
 
+	if newDevice {
+		uc.alertLogin(ctx, userID, client)
+	}
 	return access, refresh, nil
 }
+
+// isNewDevice reports whether none of the user's active sessions runs on
+// client. Sessions are matched by user agent, or by IP where the backend
+// does not record one.
+func (uc *LoginUsecase) isNewDevice(ctx context.Context, userID string, client domain.ClientInfo) bool {
+	sessions, err := uc.ac.ListSessions(ctx, userID, "")
+	if err != nil {
+		uc.log.WarnContext(ctx, "list sessions failed", "user_id", userID, "err", err)
+		return false
+	}
+	for _, s := range sessions {
+		if s.Client.UserAgent != "" && s.Client.UserAgent == client.UserAgent {
+			return false
+		}
+		if s.Client.UserAgent == "" && s.Client.IP == client.IP {
+			return false
+		}
+	}
+	return true
+}
+
+// alertLogin emails the user about a sign-in from a new device.
+func (uc *LoginUsecase) alertLogin(ctx context.Context, userID string, client domain.ClientInfo) {
+	user, err := uc.repo.FindByID(ctx, userID)
+	if err != nil {
+		if ctx.Err() == nil {
+			uc.log.Error("find user for login alert failed", "user_id", userID, "err", err)
+		}
+		return
+	}
+
+	msg := struct {
+		UserID     string    `json:"user_id"`
+		Email      string    `json:"email"`
+		IP         string    `json:"ip,omitempty"`
+		UserAgent  string    `json:"user_agent,omitempty"`
+		SignedInAt time.Time `json:"signed_in_at"`
+		Language   string    `json:"language,omitempty"`
+	}{
+		UserID:     userID,
+		Email:      user.Email().String(),
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		SignedInAt: time.Now().UTC(),
+		Language:   clientFrom(ctx).Language,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal login alert payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToQueue(ctx, "email.login_alert", body); err != nil && ctx.Err() == nil {
+		uc.log.Error("publish login alert failed", "err", err)
+	}
+}
@@ -7,17 +7,20 @@ import (
 	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
 	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
 	"log/slog"
+
+	"github.com/ParkieV/auth-service/internal/domain"
 )
 
 type LogoutUsecase struct {
 	ac     auth_client.AuthClient
 	broker broker.MessageBroker
 	cache  cache.Cache
+	audit  *AuditUsecase
 	log    *slog.Logger
 }
 
-func NewLogoutUsecase(ac auth_client.AuthClient, broker broker.MessageBroker, cache cache.Cache, log *slog.Logger) *LogoutUsecase {
-	return &LogoutUsecase{ac: ac, broker: broker, cache: cache, log: log}
+func NewLogoutUsecase(ac auth_client.AuthClient, broker broker.MessageBroker, cache cache.Cache, audit *AuditUsecase, log *slog.Logger) *LogoutUsecase {
+	return &LogoutUsecase{ac: ac, broker: broker, cache: cache, audit: audit, log: log}
 }
 
 func (uc *LogoutUsecase) Logout(ctx context.Context, userID, refresh string) error {
@@ -30,6 +33,7 @@ func (uc *LogoutUsecase) Logout(ctx context.Context, userID, refresh string) err
 	if err != nil {
 		uc.log.WarnContext(ctx, "cache remove failed", "err", err)
 	}
+	uc.audit.Success(ctx, domain.AuditLogout, userID)
 
 	msg := struct {
 		UserID string `json:"user_id"`
@@ -51,3 +55,41 @@ func (uc *LogoutUsecase) Logout(ctx context.Context, userID, refresh string) err
 
 	return nil
 }
+
+func (uc *LogoutUsecase) LogoutAll(ctx context.Context, userID string) error {
+	if err := uc.ac.RevokeAll(ctx, userID); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("logout all failed", "user_id", userID, "err", err)
+		return err
+	}
+
+	purged, err := uc.cache.DeleteUserRefresh(ctx, userID)
+	if err != nil {
+		uc.log.WarnContext(ctx, "cache purge failed", "err", err)
+	}
+	uc.audit.Success(ctx, domain.AuditLogoutAll, userID)
+
+	msg := struct {
+		UserID        string `json:"user_id"`
+		PurgedRefresh int    `json:"purged_refresh_tokens"`
+	}{
+		UserID:        userID,
+		PurgedRefresh: purged,
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal logout all payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToTopic(ctx, "UserLoggedOutEverywhere", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish logout all failed", "err", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+	"time"
+
+	"rsc.io/qr"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+const MFAMethodTOTP = "totp"
+
+// MFAChallenge is returned by Login in place of tokens when the user has a
+// second factor enrolled. VerifyMFA exchanges Token and a code for tokens.
+type MFAChallenge struct {
+	Token   string
+	Methods []string
+}
+
+func (c *MFAChallenge) Error() string { return "mfa required" }
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+	// QRCode is a data:image/png URI of the otpauth URI, ready for an <img>.
+	QRCode string
+}
+
+type MFAUsecase struct {
+	users  db.UserRepository
+	mfa    db.MFARepository
+	broker broker.MessageBroker
+	issuer string
+	audit  *AuditUsecase
+	log    *slog.Logger
+}
+
+func NewMFAUsecase(users db.UserRepository, mfa db.MFARepository, broker broker.MessageBroker, issuer string, audit *AuditUsecase, log *slog.Logger) *MFAUsecase {
+	return &MFAUsecase{users: users, mfa: mfa, broker: broker, issuer: issuer, audit: audit, log: log}
+}
+
+// EnrollTOTP starts (or restarts) an enrollment. It stays inactive until
+// ConfirmTOTP sees a first valid code, so a half-finished setup never locks
+// the user out.
+func (uc *MFAUsecase) EnrollTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	user, err := uc.users.FindByID(ctx, userID)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		uc.log.Error("find user failed", "user_id", userID, "err", err)
+		return nil, ErrUserNotFound
+	}
+
+	totp, err := domain.NewTOTP(user.ID())
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.mfa.SavePendingTOTP(ctx, totp); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+			uc.log.Error("save totp failed", "user_id", userID, "err", err)
+		}
+		return nil, err
+	}
+
+	uri := totp.URI(uc.issuer, user.Email().String())
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret: totp.EncodedSecret(),
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()),
+	}, nil
+}
+
+// ConfirmTOTP activates a pending enrollment and returns the recovery codes.
+// They are shown once; only their hashes are kept.
+func (uc *MFAUsecase) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	totp, err := uc.mfa.FindTOTP(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if totp.Confirmed {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	step, err := totp.Verify(code, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := domain.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.mfa.ConfirmTOTP(ctx, userID, step, hashes); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("confirm totp failed", "user_id", userID, "err", err)
+		return nil, err
+	}
+
+	uc.audit.Success(ctx, domain.AuditMFAEnable, userID)
+	uc.publish(ctx, "UserMFAEnabled", userID)
+	return codes, nil
+}
+
+// DisableTOTP removes the second factor after checking a current code or a
+// recovery code, so a stolen access token alone cannot turn MFA off.
+func (uc *MFAUsecase) DisableTOTP(ctx context.Context, userID, code string) error {
+	totp, err := uc.mfa.FindTOTP(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if !totp.Confirmed {
+		return domain.ErrMFANotEnrolled
+	}
+	if err := verifySecondFactor(ctx, uc.mfa, totp, code); err != nil {
+		if errors.Is(err, domain.ErrInvalidOTP) {
+			uc.audit.Failure(ctx, domain.AuditMFADisable, userID, err)
+		}
+		return err
+	}
+
+	if err := uc.mfa.DeleteTOTP(ctx, userID); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("delete totp failed", "user_id", userID, "err", err)
+		return err
+	}
+
+	uc.audit.Success(ctx, domain.AuditMFADisable, userID)
+	uc.publish(ctx, "UserMFADisabled", userID)
+	return nil
+}
+
+func (uc *MFAUsecase) publish(ctx context.Context, topic, userID string) {
+	msg := struct {
+		UserID string `json:"user_id"`
+		Method string `json:"method"`
+	}{
+		UserID: userID,
+		Method: MFAMethodTOTP,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal mfa payload failed", "err", err)
+	}
+	if err := uc.broker.PublishToTopic(ctx, topic, body); err != nil && ctx.Err() == nil {
+		uc.log.Error("publish mfa event failed", "topic", topic, "err", err)
+	}
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code
+// and burns whichever matched.
+func verifySecondFactor(ctx context.Context, repo db.MFARepository, totp *domain.TOTP, code string) error {
+	if domain.IsTOTPCode(code) {
+		step, err := totp.Verify(code, time.Now())
+		if err != nil {
+			return err
+		}
+		ok, err := repo.AdvanceTOTPStep(ctx, totp.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return domain.ErrInvalidOTP
+		}
+		return nil
+	}
+
+	ok, err := repo.UseRecoveryCode(ctx, totp.UserID, domain.HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrInvalidOTP
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"log/slog"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var (
+	ErrInvalidClient = errors.New("invalid client")
+)
+
+// OAuthUsecase serves the RFC 7662 introspection and RFC 7009 revocation
+// endpoints used by API gateways, resource servers and OAuth client
+// libraries. Confidential callers authenticate as one of the configured
+// clients.
+type OAuthUsecase struct {
+	ac      auth_client.AuthClient
+	cache   cache.Cache
+	broker  broker.MessageBroker
+	clients map[string]string
+	audit   *AuditUsecase
+	log     *slog.Logger
+}
+
+func NewOAuthUsecase(ac auth_client.AuthClient, cache cache.Cache, broker broker.MessageBroker, clients []config.OAuthClient, audit *AuditUsecase, log *slog.Logger) *OAuthUsecase {
+	secrets := make(map[string]string, len(clients))
+	for _, c := range clients {
+		secrets[c.ID] = c.Secret
+	}
+	return &OAuthUsecase{ac: ac, cache: cache, broker: broker, clients: secrets, audit: audit, log: log}
+}
+
+// IsClient reports whether clientSecret is the secret of the configured
+// client clientID.
+func (uc *OAuthUsecase) IsClient(clientID, clientSecret string) bool {
+	secret, ok := uc.clients[clientID]
+	return ok && secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(clientSecret)) == 1
+}
+
+func (uc *OAuthUsecase) authenticate(clientID, clientSecret string) error {
+	if !uc.IsClient(clientID, clientSecret) {
+		uc.log.Info("oauth client authentication failed", "client_id", clientID)
+		return ErrInvalidClient
+	}
+	return nil
+}
+
+// Introspect returns an inactive TokenInfo for any token that is unknown,
+// expired or revoked; only client authentication and backend failures are
+// reported as errors.
+func (uc *OAuthUsecase) Introspect(ctx context.Context, clientID, clientSecret, token, hint string) (auth_client.TokenInfo, error) {
+	if err := uc.authenticate(clientID, clientSecret); err != nil {
+		return auth_client.TokenInfo{}, err
+	}
+
+	info, err := uc.ac.Introspect(ctx, token, hint)
+	if err != nil {
+		if ctx.Err() != nil {
+			return auth_client.TokenInfo{}, ctx.Err()
+		}
+		uc.log.Error("introspect failed", "client_id", clientID, "err", err)
+		return auth_client.TokenInfo{}, err
+	}
+	return info, nil
+}
+
+// Revoke ends the session of an access or refresh token. Possession of the
+// token is enough to revoke it, so public clients may call it with just a
+// client_id, but a configured client or a presented secret must
+// authenticate. Unknown tokens succeed silently as RFC 7009 requires.
+func (uc *OAuthUsecase) Revoke(ctx context.Context, clientID, clientSecret, token, hint string) error {
+	if _, confidential := uc.clients[clientID]; confidential || clientSecret != "" {
+		if err := uc.authenticate(clientID, clientSecret); err != nil {
+			return err
+		}
+	}
+
+	userID, revoked, err := uc.ac.RevokeToken(ctx, token, hint)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("revoke token failed", "client_id", clientID, "err", err)
+		return err
+	}
+	if userID == "" {
+		return nil
+	}
+
+	for _, rt := range revoked {
+		if err := uc.cache.Delete(ctx, rt); err != nil {
+			uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+		}
+	}
+
+	var detail string
+	if clientID != "" {
+		detail = "client_id=" + clientID
+	}
+	uc.audit.Record(ctx, domain.AuditEvent{ActorID: userID, UserID: userID, Action: domain.AuditTokenRevoke, Outcome: domain.AuditSuccess, Detail: detail})
+
+	msg := struct {
+		UserID   string `json:"user_id"`
+		ClientID string `json:"client_id,omitempty"`
+	}{
+		UserID:   userID,
+		ClientID: clientID,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal token revoked payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToTopic(ctx, "TokenRevoked", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish token revoked failed", "err", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,272 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var (
+	ErrInvalidLoginCode = errors.New("invalid or expired login code")
+)
+
+const (
+	loginLinkPrefix     = "login_link:"
+	loginCodePrefix     = "login_code:"
+	loginAttemptsPrefix = "login_code_attempts:"
+)
+
+// PasswordlessUsecase signs users in with a one-time link or code sent to
+// their email. Every request sends both: the link for the device that
+// reads the mail, the code for typing into another one. Redeeming either
+// invalidates the other.
+type PasswordlessUsecase struct {
+	repo        db.UserRepository
+	login       *LoginUsecase
+	cache       cache.Cache
+	broker      broker.MessageBroker
+	ttl         time.Duration
+	maxAttempts int
+	log         *slog.Logger
+}
+
+func NewPasswordlessUsecase(repo db.UserRepository, login *LoginUsecase, cache cache.Cache, broker broker.MessageBroker, ttl time.Duration, maxAttempts int, log *slog.Logger) *PasswordlessUsecase {
+	return &PasswordlessUsecase{repo: repo, login: login, cache: cache, broker: broker, ttl: ttl, maxAttempts: maxAttempts, log: log}
+}
+
+// RequestLogin always succeeds for a well-formed email so callers cannot
+// probe which addresses are registered. A new request replaces the code
+// and link of the previous one.
+func (uc *PasswordlessUsecase) RequestLogin(ctx context.Context, emailStr string) error {
+	email, err := domain.NewEmail(strings.TrimSpace(emailStr))
+	if err != nil {
+		uc.log.Info("invalid email", "email", emailStr, "err", err)
+		return err
+	}
+
+	user, err := uc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		uc.log.Info("passwordless login for unknown user", "email", email)
+		return nil
+	}
+	if err := uc.login.admit(user); err != nil {
+		uc.log.Info("passwordless login refused", "user_id", user.ID(), "reason", err)
+		return nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		uc.log.Error("generate login token failed", "err", err)
+		return nil
+	}
+	code, err := generateLoginCode()
+	if err != nil {
+		uc.log.Error("generate login code failed", "err", err)
+		return nil
+	}
+
+	uc.revokeLink(ctx, user.ID())
+
+	// the code entry remembers the link so redeeming the code can revoke it
+	linkHash := hashToken(token)
+	if err := uc.cache.Set(ctx, loginLinkPrefix+linkHash, user.ID(), uc.ttl); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("store login link failed", "err", err)
+		return nil
+	}
+	if err := uc.cache.Set(ctx, loginCodePrefix+user.ID(), hashToken(code)+":"+linkHash, uc.ttl); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("store login code failed", "err", err)
+		return nil
+	}
+
+	msg := struct {
+		UserID    string `json:"user_id"`
+		Email     string `json:"email"`
+		Token     string `json:"token"`
+		Code      string `json:"code"`
+		ExpiresIn int    `json:"expires_in"`
+		Language  string `json:"language,omitempty"`
+	}{
+		UserID:    user.ID(),
+		Email:     email.String(),
+		Token:     token,
+		Code:      code,
+		ExpiresIn: int(uc.ttl.Seconds()),
+		Language:  clientFrom(ctx).Language,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal login payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToQueue(ctx, "email.login", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish login email failed", "err", err)
+	}
+
+	return nil
+}
+
+// LoginWithLink redeems the token from the emailed link. Like a password
+// login it may end in an MFAChallenge.
+func (uc *PasswordlessUsecase) LoginWithLink(ctx context.Context, token string, client domain.ClientInfo) (string, string, error) {
+	userID, err := uc.cache.GetDel(ctx, loginLinkPrefix+hashToken(strings.TrimSpace(token)))
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return "", "", ctx.Err()
+		case errors.Is(err, cache.ErrKeyNotFound):
+			return "", "", ErrInvalidLoginCode
+		default:
+			uc.log.Error("cache getdel failed", "err", err)
+			return "", "", err
+		}
+	}
+	if err := uc.cache.Delete(ctx, loginCodePrefix+userID); err != nil {
+		uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+	}
+
+	// the account may have been disabled since the link was sent
+	user, err := uc.repo.FindByID(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		return "", "", ErrInvalidLoginCode
+	}
+	if err := uc.login.admit(user); err != nil {
+		uc.login.fail(ctx, userID, "", client, err)
+		return "", "", err
+	}
+
+	return uc.login.signIn(ctx, userID, client)
+}
+
+// LoginWithCode redeems the emailed code. Attempts count against the user
+// over a window as long as a code lives, not against one request: asking
+// for a new code does not buy more guesses. Past maxAttempts the pending
+// code is dropped and codes are refused until the window has passed.
+func (uc *PasswordlessUsecase) LoginWithCode(ctx context.Context, emailStr, code string, client domain.ClientInfo) (string, string, error) {
+	email, err := domain.NewEmail(strings.TrimSpace(emailStr))
+	if err != nil {
+		return "", "", err
+	}
+	user, err := uc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", "", ctxErr
+		}
+		return "", "", ErrInvalidLoginCode
+	}
+	userID := user.ID()
+
+	stored, err := uc.cache.Get(ctx, loginCodePrefix+userID)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return "", "", ctx.Err()
+		case errors.Is(err, cache.ErrKeyNotFound):
+			return "", "", ErrInvalidLoginCode
+		default:
+			uc.log.Error("cache get failed", "err", err)
+			return "", "", err
+		}
+	}
+
+	n, err := uc.cache.IncrWindow(ctx, loginAttemptsPrefix+userID, uc.ttl)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		uc.log.Error("login attempt counter failed", "err", err)
+		return "", "", err
+	}
+	if uc.maxAttempts > 0 && n > int64(uc.maxAttempts) {
+		uc.log.Info("login code attempts exhausted", "user_id", userID)
+		uc.drop(ctx, userID, stored)
+		uc.login.fail(ctx, userID, email.String(), client, ErrInvalidLoginCode)
+		return "", "", ErrInvalidLoginCode
+	}
+
+	codeHash, _, _ := strings.Cut(stored, ":")
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashToken(strings.TrimSpace(code)))) != 1 {
+		uc.login.fail(ctx, userID, email.String(), client, ErrInvalidLoginCode)
+		return "", "", ErrInvalidLoginCode
+	}
+
+	// a concurrent request may have redeemed the code in the meantime
+	if _, err := uc.cache.GetDel(ctx, loginCodePrefix+userID); err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		return "", "", ErrInvalidLoginCode
+	}
+	uc.drop(ctx, userID, stored)
+	if err := uc.cache.Delete(ctx, loginAttemptsPrefix+userID); err != nil {
+		uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+	}
+	if err := uc.login.admit(user); err != nil {
+		uc.login.fail(ctx, userID, email.String(), client, err)
+		return "", "", err
+	}
+
+	return uc.login.signIn(ctx, userID, client)
+}
+
+// revokeLink deletes the link of the user's pending request, if any. The
+// new request overwrites its code, but the link has a key of its own and
+// would stay valid until it expires.
+func (uc *PasswordlessUsecase) revokeLink(ctx context.Context, userID string) {
+	stored, err := uc.cache.Get(ctx, loginCodePrefix+userID)
+	if err != nil {
+		if ctx.Err() == nil && !errors.Is(err, cache.ErrKeyNotFound) {
+			uc.log.WarnContext(ctx, "cache get failed", "err", err)
+		}
+		return
+	}
+	if _, linkHash, ok := strings.Cut(stored, ":"); ok {
+		if err := uc.cache.Delete(ctx, loginLinkPrefix+linkHash); err != nil {
+			uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+		}
+	}
+}
+
+// drop forgets a login request: its code and its link.
+func (uc *PasswordlessUsecase) drop(ctx context.Context, userID, stored string) {
+	_, linkHash, _ := strings.Cut(stored, ":")
+	for _, key := range []string{loginCodePrefix + userID, loginLinkPrefix + linkHash} {
+		if err := uc.cache.Delete(ctx, key); err != nil {
+			uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+		}
+	}
+}
+
+func generateLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
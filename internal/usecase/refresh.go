@@ -5,12 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
-	_ "github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
 	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
 	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
 	"github.com/google/uuid"
 	"log/slog"
 	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
 )
 
 var (
@@ -23,50 +24,45 @@ type RefreshUsecase struct {
 	broker     broker.MessageBroker
 	cache      cache.Cache
 	refreshTTL time.Duration
+	audit      *AuditUsecase
 	log        *slog.Logger
 }
 
-func NewRefreshUsecase(ac auth_client.AuthClient, broker broker.MessageBroker, cache cache.Cache, refreshTTL time.Duration, log *slog.Logger) *RefreshUsecase {
-	return &RefreshUsecase{ac: ac, broker: broker, cache: cache, refreshTTL: refreshTTL, log: log}
+func NewRefreshUsecase(ac auth_client.AuthClient, broker broker.MessageBroker, cache cache.Cache, refreshTTL time.Duration, audit *AuditUsecase, log *slog.Logger) *RefreshUsecase {
+	return &RefreshUsecase{ac: ac, broker: broker, cache: cache, refreshTTL: refreshTTL, audit: audit, log: log}
 }
 
 func (uc *RefreshUsecase) Refresh(ctx context.Context, oldRT string) (string, string, error) {
-
-	userID, err := uc.cache.Get(ctx, oldRT)
+	newRT := uuid.NewString()
+	rot, err := uc.ac.RotateRefresh(ctx, oldRT, newRT)
 	if err != nil {
 		switch {
 		case ctx.Err() != nil:
 			return "", "", ctx.Err()
-		case errors.Is(err, cache.ErrKeyNotFound):
-			uc.log.Error("Cannot get refresh token from cache")
+		case errors.Is(err, auth_client.ErrRefreshTokenReused):
+			uc.audit.Failure(ctx, domain.AuditRefresh, rot.UserID, err)
+			uc.revokeFamily(ctx, rot)
+			return "", "", ErrInvalidRefreshToken
+		case errors.Is(err, auth_client.ErrRefreshTokenNotFound):
 			return "", "", ErrInvalidRefreshToken
 		default:
-			uc.log.Error("cache get failed", "err", err)
-			return "", "", err
-		}
-	}
-
-	newRT := uuid.NewString()
-	ok, err := uc.cache.SwapRefresh(ctx, userID, oldRT, newRT, uc.refreshTTL)
-	if err != nil {
-		if ctx.Err() != nil {
-			return "", "", ctx.Err()
+			uc.log.Error("rotate refresh token failed", "err", err)
+			return "", "", ErrRefreshFailed
 		}
-		uc.log.Error("cache swap failed", "err", err)
-		return "", "", ErrRefreshFailed
 	}
-	if !ok {
-		uc.log.Error("Problem is here")
-		return "", "", ErrInvalidRefreshToken
+	userID, newAT := rot.UserID, rot.AccessToken
+	if rot.RefreshToken != "" {
+		newRT = rot.RefreshToken
 	}
+	uc.audit.Success(ctx, domain.AuditRefresh, userID)
 
-	newAT, err := uc.ac.IssueAccessToken(ctx, userID)
+	ok, err := uc.cache.SwapRefresh(ctx, userID, oldRT, newRT, uc.refreshTTL)
 	if err != nil {
-		if ctx.Err() != nil {
-			return "", "", ctx.Err()
+		uc.log.WarnContext(ctx, "cache swap failed", "err", err)
+	} else if !ok {
+		if err := uc.cache.SetRefresh(ctx, userID, newRT, uc.refreshTTL); err != nil {
+			uc.log.WarnContext(ctx, "cache set failed", "err", err)
 		}
-		uc.log.Error("issue access token failed", "err", err)
-		return "", "", ErrRefreshFailed
 	}
 
 	msg := struct {
@@ -93,3 +89,36 @@ func (uc *RefreshUsecase) Refresh(ctx context.Context, oldRT string) (string, st
 
 	return newAT, newRT, nil
 }
+
+// revokeFamily is called when an already rotated refresh token is presented:
+// either the client or an attacker holds a stale copy, so every token of the
+// family is revoked and both parties have to log in again.
+func (uc *RefreshUsecase) revokeFamily(ctx context.Context, rot auth_client.Rotation) {
+	uc.log.Warn("refresh token reuse detected", "user_id", rot.UserID, "family_id", rot.FamilyID)
+
+	revoked, err := uc.ac.RevokeFamily(ctx, rot.FamilyID)
+	if err != nil {
+		uc.log.Error("revoke token family failed", "family_id", rot.FamilyID, "err", err)
+	}
+	for _, rt := range revoked {
+		if err := uc.cache.Delete(ctx, rt); err != nil {
+			uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+		}
+	}
+
+	msg := struct {
+		UserID   string `json:"user_id"`
+		FamilyID string `json:"family_id"`
+	}{
+		UserID:   rot.UserID,
+		FamilyID: rot.FamilyID,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal reuse payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToTopic(ctx, "RefreshTokenReuseDetected", body); err != nil {
+		uc.log.Error("publish reuse detected failed", "err", err)
+	}
+}
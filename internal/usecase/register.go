@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
-	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
 	"github.com/ParkieV/auth-service/internal/infrastructure/db"
 	"log/slog"
 	"strings"
@@ -21,15 +20,15 @@ var (
 )
 
 type RegisterUsecase struct {
-	repo   db.UserMutRepository
-	broker broker.MessageBroker
-	ac     auth_client.AuthClient
-	ttl    time.Duration
-	log    *slog.Logger
+	repo  db.UserMutRepository
+	ac    auth_client.AuthClient
+	ttl   time.Duration
+	audit *AuditUsecase
+	log   *slog.Logger
 }
 
-func NewRegisterUsecase(repo db.UserMutRepository, broker broker.MessageBroker, ac auth_client.AuthClient, confirmationTTL time.Duration, log *slog.Logger) *RegisterUsecase {
-	return &RegisterUsecase{repo: repo, broker: broker, ac: ac, ttl: confirmationTTL, log: log}
+func NewRegisterUsecase(repo db.UserMutRepository, ac auth_client.AuthClient, confirmationTTL time.Duration, audit *AuditUsecase, log *slog.Logger) *RegisterUsecase {
+	return &RegisterUsecase{repo: repo, ac: ac, ttl: confirmationTTL, audit: audit, log: log}
 }
 
 func (uc *RegisterUsecase) Register(ctx context.Context, emailStr, plainPassword string) (string, error) {
@@ -49,58 +48,51 @@ func (uc *RegisterUsecase) Register(ctx context.Context, emailStr, plainPassword
 		return "", err
 	}
 
-	if err := uc.repo.Save(ctx, user); err != nil {
-		switch {
-		case ctx.Err() != nil:
-			return "", ctx.Err()
-		case errors.Is(err, db.ErrDuplicateKey):
-			return "", ErrEmailExists
-		default:
-			uc.log.Error("save user failed", "err", err)
-			return "", err
-		}
-	}
-
-	msg := struct {
-		UserID string `json:"user_id"`
-		Email  string `json:"email"`
-		Code   string `json:"code"`
+	confirm, err := json.Marshal(struct {
+		UserID   string `json:"user_id"`
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Language string `json:"language,omitempty"`
 	}{
-		UserID: userID,
-		Email:  email.String(),
-		Code:   confirmID,
-	}
-	body, err := json.Marshal(msg)
+		UserID:   userID,
+		Email:    email.String(),
+		Code:     confirmID,
+		Language: clientFrom(ctx).Language,
+	})
 	if err != nil {
 		uc.log.Error("marshal confirm payload failed", "err", err)
+		return "", err
 	}
-
-	if err := uc.broker.PublishToQueue(ctx, "email.confirm", body); err != nil {
-		if ctx.Err() != nil {
-			return "", ctx.Err()
-		}
-		uc.log.Error("publish confirm email failed", "err", err)
-	}
-
-	msg2 := struct {
+	registered, err := json.Marshal(struct {
 		UserID string `json:"user_id"`
 		Email  string `json:"email"`
 	}{
 		UserID: userID,
 		Email:  email.String(),
-	}
-
-	body, err = json.Marshal(msg2)
+	})
 	if err != nil {
-		uc.log.Error("marshal confirm payload failed", "err", err)
+		uc.log.Error("marshal registered payload failed", "err", err)
+		return "", err
 	}
 
-	if err := uc.broker.PublishToTopic(ctx, "UserRegistered", body); err != nil {
-		if ctx.Err() != nil {
+	// the confirmation email and the event leave through the outbox, so
+	// they are sent if and only if the user is stored
+	if err := uc.repo.Save(ctx, user,
+		db.QueueMessage(userID, "email.confirm", confirm),
+		db.TopicMessage(userID, "UserRegistered", registered),
+	); err != nil {
+		switch {
+		case ctx.Err() != nil:
 			return "", ctx.Err()
+		case errors.Is(err, db.ErrDuplicateKey):
+			uc.audit.Record(ctx, domain.AuditEvent{Email: email.String(), Action: domain.AuditRegister, Outcome: domain.AuditFailure, Detail: ErrEmailExists.Error()})
+			return "", ErrEmailExists
+		default:
+			uc.log.Error("save user failed", "err", err)
+			return "", err
 		}
-		uc.log.Error("publish confirm email failed", "err", err)
 	}
+	uc.audit.Record(ctx, domain.AuditEvent{ActorID: userID, UserID: userID, Email: email.String(), Action: domain.AuditRegister, Outcome: domain.AuditSuccess})
 
 	return userID, nil
 }
@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var (
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+type ResendConfirmationUsecase struct {
+	repo   db.UserMutRepository
+	cache  cache.Cache
+	ttl    time.Duration
+	limit  int
+	window time.Duration
+	log    *slog.Logger
+}
+
+func NewResendConfirmationUsecase(repo db.UserMutRepository, cache cache.Cache, confirmationTTL time.Duration, limit int, window time.Duration, log *slog.Logger) *ResendConfirmationUsecase {
+	return &ResendConfirmationUsecase{repo: repo, cache: cache, ttl: confirmationTTL, limit: limit, window: window, log: log}
+}
+
+// Resend succeeds alike for unknown, confirmed and unconfirmed addresses,
+// so callers cannot probe which are registered. The throttle is keyed by
+// the address for the same reason.
+func (uc *ResendConfirmationUsecase) Resend(ctx context.Context, emailStr string) error {
+	email, err := domain.NewEmail(strings.TrimSpace(emailStr))
+	if err != nil {
+		uc.log.Info("invalid email", "email", emailStr, "err", err)
+		return err
+	}
+
+	if uc.limit > 0 {
+		n, err := uc.cache.Incr(ctx, "confirm_resend:"+email.String(), uc.window)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			uc.log.WarnContext(ctx, "resend counter failed", "err", err)
+		case n > int64(uc.limit):
+			uc.log.Info("resend throttled", "email", email, "count", n)
+			return ErrTooManyRequests
+		}
+	}
+
+	user, err := uc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		uc.log.Info("resend for unknown user", "email", email)
+		return nil
+	}
+	if user.IsConfirmed() {
+		uc.log.Info("resend for confirmed user", "user_id", user.ID())
+		return nil
+	}
+
+	confirmID := uuid.NewString()
+	if err := user.RotateConfirmation(confirmID, uc.ttl, time.Now()); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(struct {
+		UserID   string `json:"user_id"`
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Language string `json:"language,omitempty"`
+	}{
+		UserID:   user.ID(),
+		Email:    email.String(),
+		Code:     confirmID,
+		Language: clientFrom(ctx).Language,
+	})
+	if err != nil {
+		uc.log.Error("marshal confirm payload failed", "err", err)
+		return err
+	}
+
+	if err := uc.repo.UpdateConfirmation(ctx, user.ID(), user.ConfirmationID(), user.ExpiresAt(),
+		db.QueueMessage(user.ID(), "email.confirm", body),
+	); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("update confirmation failed", "err", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+const resetKeyPrefix = "pwd_reset:"
+
+type PasswordResetUsecase struct {
+	repo   db.UserMutRepository
+	ac     auth_client.AuthClient
+	broker broker.MessageBroker
+	cache  cache.Cache
+	ttl    time.Duration
+	audit  *AuditUsecase
+	log    *slog.Logger
+}
+
+func NewPasswordResetUsecase(repo db.UserMutRepository, ac auth_client.AuthClient, broker broker.MessageBroker, cache cache.Cache, resetTTL time.Duration, audit *AuditUsecase, log *slog.Logger) *PasswordResetUsecase {
+	return &PasswordResetUsecase{repo: repo, ac: ac, broker: broker, cache: cache, ttl: resetTTL, audit: audit, log: log}
+}
+
+// RequestReset always succeeds for a well-formed email so callers cannot
+// probe which addresses are registered.
+func (uc *PasswordResetUsecase) RequestReset(ctx context.Context, emailStr string) error {
+	email, err := domain.NewEmail(strings.TrimSpace(emailStr))
+	if err != nil {
+		uc.log.Info("invalid email", "email", emailStr, "err", err)
+		return err
+	}
+
+	user, err := uc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		uc.log.Info("password reset for unknown user", "email", email)
+		return nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		uc.log.Error("generate reset token failed", "err", err)
+		return nil
+	}
+
+	if err := uc.cache.Set(ctx, resetKeyPrefix+hashToken(token), user.ID(), uc.ttl); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("store reset token failed", "err", err)
+		return nil
+	}
+	uc.audit.Record(ctx, domain.AuditEvent{UserID: user.ID(), Email: email.String(), Action: domain.AuditPasswordResetRequest, Outcome: domain.AuditSuccess})
+
+	msg := struct {
+		UserID   string `json:"user_id"`
+		Email    string `json:"email"`
+		Token    string `json:"token"`
+		Language string `json:"language,omitempty"`
+	}{
+		UserID:   user.ID(),
+		Email:    email.String(),
+		Token:    token,
+		Language: clientFrom(ctx).Language,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal reset payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToQueue(ctx, "email.password_reset", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish reset email failed", "err", err)
+	}
+
+	return nil
+}
+
+func (uc *PasswordResetUsecase) ResetPassword(ctx context.Context, token, newPassword string) error {
+	pwd, err := domain.NewPasswordFromPlain(newPassword)
+	if err != nil {
+		return err
+	}
+
+	userID, err := uc.cache.GetDel(ctx, resetKeyPrefix+hashToken(strings.TrimSpace(token)))
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, cache.ErrKeyNotFound):
+			return ErrInvalidResetToken
+		default:
+			uc.log.Error("cache getdel failed", "err", err)
+			return err
+		}
+	}
+
+	if err := uc.repo.UpdatePasswordHash(ctx, userID, pwd.Hash()); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("update password failed", "err", err)
+		return err
+	}
+
+	uc.audit.Success(ctx, domain.AuditPasswordReset, userID)
+
+	// a reset usually means the account was compromised, so it only
+	// counts as done once every session is gone
+	if err := uc.ac.RevokeAll(ctx, userID); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("revoke sessions failed", "user_id", userID, "err", err)
+		return err
+	}
+	if _, err := uc.cache.DeleteUserRefresh(ctx, userID); err != nil {
+		uc.log.WarnContext(ctx, "cache purge failed", "err", err)
+	}
+
+	msg := struct {
+		UserID string `json:"user_id"`
+	}{
+		UserID: userID,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal reset payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToTopic(ctx, "UserPasswordReset", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish password reset failed", "err", err)
+	}
+
+	return nil
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
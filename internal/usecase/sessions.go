@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"log/slog"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+type SessionsUsecase struct {
+	ac     auth_client.AuthClient
+	cache  cache.Cache
+	broker broker.MessageBroker
+	audit  *AuditUsecase
+	log    *slog.Logger
+}
+
+func NewSessionsUsecase(ac auth_client.AuthClient, cache cache.Cache, broker broker.MessageBroker, audit *AuditUsecase, log *slog.Logger) *SessionsUsecase {
+	return &SessionsUsecase{ac: ac, cache: cache, broker: broker, audit: audit, log: log}
+}
+
+func (uc *SessionsUsecase) List(ctx context.Context, userID, accessToken string) ([]domain.Session, error) {
+	sessions, err := uc.ac.ListSessions(ctx, userID, accessToken)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("list sessions failed", "user_id", userID, "err", err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (uc *SessionsUsecase) Revoke(ctx context.Context, userID, sessionID string) error {
+	revoked, err := uc.ac.RevokeSession(ctx, userID, sessionID)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, domain.ErrSessionNotFound):
+			return err
+		default:
+			uc.log.Error("revoke session failed", "session_id", sessionID, "err", err)
+			return err
+		}
+	}
+
+	for _, rt := range revoked {
+		if err := uc.cache.Delete(ctx, rt); err != nil {
+			uc.log.WarnContext(ctx, "cache remove failed", "err", err)
+		}
+	}
+	uc.audit.Record(ctx, domain.AuditEvent{ActorID: userID, UserID: userID, Action: domain.AuditSessionRevoke, Outcome: domain.AuditSuccess, Detail: sessionID})
+
+	msg := struct {
+		UserID    string `json:"user_id"`
+		SessionID string `json:"session_id"`
+	}{
+		UserID:    userID,
+		SessionID: sessionID,
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal session revoked payload failed", "err", err)
+	}
+
+	if err := uc.broker.PublishToTopic(ctx, "SessionRevoked", body); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("publish session revoked failed", "err", err)
+	}
+
+	return nil
+}
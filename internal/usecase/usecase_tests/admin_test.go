@@ -0,0 +1,291 @@
+package usecase_tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+type adminFixture struct {
+	uc     *usecase.AdminUsecase
+	repo   *MockUserRepo
+	roles  *MockRoleRepo
+	kc     *MockKC
+	cache  *MockCache
+	broker *MockBroker
+}
+
+func newAdminFixture() *adminFixture {
+	f := &adminFixture{
+		repo:   &MockUserRepo{},
+		roles:  &MockRoleRepo{},
+		kc:     &MockKC{},
+		cache:  &MockCache{},
+		broker: &MockBroker{},
+	}
+	f.uc = usecase.NewAdminUsecase(f.repo, f.roles, f.kc, f.cache, f.broker, time.Hour, noAudit(), discardLogger())
+	f.broker.On("PublishToTopic", "AdminAction", mock.Anything).Return(nil)
+	return f
+}
+
+func (f *adminFixture) expectRevokeAll(userID string) {
+	f.kc.On("RevokeAll", userID).Return(nil)
+	f.cache.On("DeleteUserRefresh", userID).Return(1, nil)
+}
+
+// lastAudit разбирает последнее событие AdminAction
+func (f *adminFixture) lastAudit(t *testing.T) (actor, action, target string) {
+	t.Helper()
+	var msg struct {
+		ActorID  string `json:"actor_id"`
+		Action   string `json:"action"`
+		TargetID string `json:"target_id"`
+	}
+	for _, c := range f.broker.Calls {
+		if c.Method == "PublishToTopic" && c.Arguments.String(0) == "AdminAction" {
+			assert.NoError(t, json.Unmarshal(c.Arguments.Get(1).([]byte), &msg))
+		}
+	}
+	return msg.ActorID, msg.Action, msg.TargetID
+}
+
+func TestAdmin_Authorize(t *testing.T) {
+	f := newAdminFixture()
+	admin := domain.Access{Roles: []string{"support", domain.RoleAdmin}}
+	assert.NoError(t, f.uc.Authorize(admin, domain.PermRolesWrite))
+
+	// роль без admin получает только то, что дают её разрешения
+	support := domain.Access{Roles: []string{"support"}, Permissions: []string{domain.PermUsersRead}}
+	assert.NoError(t, f.uc.Authorize(support, domain.PermUsersRead))
+	assert.ErrorIs(t, f.uc.Authorize(support, domain.PermUsersWrite), usecase.ErrPermissionDenied)
+	assert.ErrorIs(t, f.uc.Authorize(support, domain.PermRolesRead), usecase.ErrPermissionDenied)
+	assert.ErrorIs(t, f.uc.Authorize(domain.Access{}, domain.PermUsersRead), usecase.ErrPermissionDenied)
+}
+
+func TestAdmin_ListUsersClampsPage(t *testing.T) {
+	f := newAdminFixture()
+	users := []*domain.User{newTestUser(t, "u1", "a@example.com", "password1", true)}
+	f.repo.On("ListUsers", "example", 200, 0).Return(users, 7, nil)
+	f.repo.On("ListUsers", "", 50, 10).Return(nil, 0, nil)
+
+	page, err := f.uc.ListUsers(context.Background(), "example", 1000, -5)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, page.Total)
+	assert.Len(t, page.Users, 1)
+
+	_, err = f.uc.ListUsers(context.Background(), "", 0, 10)
+	assert.NoError(t, err)
+}
+
+func TestAdmin_GetUserWithRoles(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("FindByID", "u1").Return(newTestUser(t, "u1", "a@example.com", "password1", true), nil)
+	f.roles.On("UserAccess", "u1").Return(domain.Access{Roles: []string{"admin"}}, nil)
+
+	details, err := f.uc.GetUser(context.Background(), "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", details.User.ID())
+	assert.Equal(t, []string{"admin"}, details.Roles)
+}
+
+func TestAdmin_GetUnknownUser(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("FindByID", "ghost").Return(nil, domain.ErrUserNotFound)
+
+	_, err := f.uc.GetUser(context.Background(), "ghost")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestAdmin_DisableRevokesSessions(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("SetDisabled", "u1", true).Return(nil)
+	f.expectRevokeAll("u1")
+
+	assert.NoError(t, f.uc.Disable(context.Background(), "root", "u1"))
+	f.kc.AssertCalled(t, "RevokeAll", "u1")
+	f.cache.AssertCalled(t, "DeleteUserRefresh", "u1")
+
+	actor, action, target := f.lastAudit(t)
+	assert.Equal(t, "root", actor)
+	assert.Equal(t, domain.AuditAdminDisable, action)
+	assert.Equal(t, "u1", target)
+}
+
+func TestAdmin_CannotDisableOrDeleteSelf(t *testing.T) {
+	f := newAdminFixture()
+
+	assert.ErrorIs(t, f.uc.Disable(context.Background(), "root", "root"), usecase.ErrSelfAction)
+	assert.ErrorIs(t, f.uc.Delete(context.Background(), "root", "root"), usecase.ErrSelfAction)
+	f.repo.AssertNotCalled(t, "SetDisabled", mock.Anything, mock.Anything)
+	f.repo.AssertNotCalled(t, "Delete", mock.Anything)
+	f.broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
+
+func TestAdmin_EnableUnknownUser(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("SetDisabled", "ghost", false).Return(domain.ErrUserNotFound)
+
+	assert.ErrorIs(t, f.uc.Enable(context.Background(), "root", "ghost"), domain.ErrUserNotFound)
+	f.broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
+
+func TestAdmin_Confirm(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("FindByID", "u1").Return(newTestUser(t, "u1", "a@example.com", "password1", false), nil)
+	f.repo.On("FindByID", "u2").Return(newTestUser(t, "u2", "b@example.com", "password1", true), nil)
+	f.repo.On("MarkConfirmed", "u1", mock.Anything).Return(nil)
+
+	assert.NoError(t, f.uc.Confirm(context.Background(), "root", "u1"))
+	events := outboxed(f.repo, "MarkConfirmed")
+	assert.Len(t, events, 1)
+	assert.Equal(t, "UserConfirmed", events[0].Destination)
+	assert.Equal(t, "u1", events[0].AggregateID)
+
+	assert.ErrorIs(t, f.uc.Confirm(context.Background(), "root", "u2"), domain.ErrAlreadyConfirmed)
+	f.repo.AssertNumberOfCalls(t, "MarkConfirmed", 1)
+}
+
+func TestAdmin_ForcePasswordReset(t *testing.T) {
+	f := newAdminFixture()
+	user := newTestUser(t, "u1", "a@example.com", "password1", true)
+	f.repo.On("FindByID", "u1").Return(user, nil)
+	f.repo.On("UpdatePasswordHash", "u1", mock.Anything).Return(nil)
+	f.expectRevokeAll("u1")
+	f.cache.On("Set", prefixed("pwd_reset:"), "u1", time.Hour).Return(nil)
+	f.broker.On("PublishToQueue", "email.password_reset", mock.Anything).Return(nil)
+
+	assert.NoError(t, f.uc.ForcePasswordReset(context.Background(), "root", "u1"))
+
+	// the old password no longer matches the stored hash
+	newHash := f.repo.Calls[1].Arguments.String(1)
+	assert.NotEqual(t, user.HashForStorage(), newHash)
+	pwd, err := domain.NewPasswordFromHash(newHash)
+	assert.NoError(t, err)
+	assert.False(t, pwd.Verify("password1"))
+
+	var msg struct {
+		Email string `json:"email"`
+		Token string `json:"token"`
+	}
+	body := f.broker.Calls[0].Arguments.Get(1).([]byte)
+	assert.NoError(t, json.Unmarshal(body, &msg))
+	assert.Equal(t, "a@example.com", msg.Email)
+	f.cache.AssertCalled(t, "Set", "pwd_reset:"+sha256Hex(msg.Token), "u1", time.Hour)
+}
+
+func TestAdmin_DeleteRevokesFirst(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("FindByID", "u1").Return(newTestUser(t, "u1", "a@example.com", "password1", true), nil)
+	f.expectRevokeAll("u1")
+	f.repo.On("Delete", "u1").Return(nil)
+
+	assert.NoError(t, f.uc.Delete(context.Background(), "root", "u1"))
+	f.kc.AssertCalled(t, "RevokeAll", "u1")
+	_, action, _ := f.lastAudit(t)
+	assert.Equal(t, domain.AuditAdminDelete, action)
+}
+
+func TestAdmin_RevokeSessions(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("FindByID", "u1").Return(newTestUser(t, "u1", "a@example.com", "password1", true), nil)
+	f.expectRevokeAll("u1")
+
+	assert.NoError(t, f.uc.RevokeSessions(context.Background(), "root", "u1"))
+	_, action, _ := f.lastAudit(t)
+	assert.Equal(t, domain.AuditAdminRevokeSessions, action)
+}
+
+func TestAdmin_CreateRole(t *testing.T) {
+	f := newAdminFixture()
+	f.roles.On("CreateRole", mock.Anything).Return(nil)
+
+	role, err := f.uc.CreateRole(context.Background(), "root", "support", "Helpdesk", []string{"users:read"})
+	assert.NoError(t, err)
+	assert.Equal(t, "support", role.Name)
+	_, action, target := f.lastAudit(t)
+	assert.Equal(t, domain.AuditAdminRoleCreate, action)
+	assert.Empty(t, target)
+
+	// некорректное имя не доходит до базы
+	_, err = f.uc.CreateRole(context.Background(), "root", "Bad Name", "", nil)
+	assert.ErrorIs(t, err, domain.ErrInvalidRoleName)
+	f.roles.AssertNumberOfCalls(t, "CreateRole", 1)
+}
+
+func TestAdmin_CreateRoleUnknownPermission(t *testing.T) {
+	f := newAdminFixture()
+	f.roles.On("CreateRole", mock.Anything).Return(domain.ErrPermissionNotFound)
+
+	_, err := f.uc.CreateRole(context.Background(), "root", "support", "", []string{"nope"})
+	assert.ErrorIs(t, err, domain.ErrPermissionNotFound)
+	f.broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
+
+func TestAdmin_AdminRoleIsProtected(t *testing.T) {
+	f := newAdminFixture()
+
+	assert.ErrorIs(t, f.uc.SetRolePermissions(context.Background(), "root", domain.RoleAdmin, nil), usecase.ErrProtectedRole)
+	assert.ErrorIs(t, f.uc.DeleteRole(context.Background(), "root", domain.RoleAdmin), usecase.ErrProtectedRole)
+	// снять с себя роль admin нельзя, с другого — можно
+	assert.ErrorIs(t, f.uc.UnassignRole(context.Background(), "root", "root", domain.RoleAdmin), usecase.ErrSelfAction)
+	f.roles.AssertNotCalled(t, "SetRolePermissions", mock.Anything, mock.Anything)
+	f.roles.AssertNotCalled(t, "DeleteRole", mock.Anything)
+	f.roles.AssertNotCalled(t, "UnassignRole", mock.Anything, mock.Anything)
+}
+
+func TestAdmin_SetRolePermissions(t *testing.T) {
+	f := newAdminFixture()
+	f.roles.On("SetRolePermissions", "support", []string{"users:read", "users:write"}).Return(nil)
+	f.roles.On("SetRolePermissions", "ghost", []string{"users:read"}).Return(domain.ErrRoleNotFound)
+
+	assert.NoError(t, f.uc.SetRolePermissions(context.Background(), "root", "support", []string{"users:read", "users:write"}))
+	_, action, _ := f.lastAudit(t)
+	assert.Equal(t, domain.AuditAdminRoleUpdate, action)
+
+	assert.ErrorIs(t, f.uc.SetRolePermissions(context.Background(), "root", "ghost", []string{"users:read"}), domain.ErrRoleNotFound)
+}
+
+func TestAdmin_DeleteRole(t *testing.T) {
+	f := newAdminFixture()
+	f.roles.On("DeleteRole", "support").Return(nil)
+
+	assert.NoError(t, f.uc.DeleteRole(context.Background(), "root", "support"))
+	_, action, _ := f.lastAudit(t)
+	assert.Equal(t, domain.AuditAdminRoleDelete, action)
+}
+
+func TestAdmin_AssignRole(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("FindByID", "u1").Return(newTestUser(t, "u1", "a@example.com", "password1", true), nil)
+	f.repo.On("FindByID", "ghost").Return(nil, domain.ErrUserNotFound)
+	f.roles.On("AssignRole", "u1", domain.RoleAdmin).Return(nil)
+	f.roles.On("AssignRole", "u1", "nope").Return(domain.ErrRoleNotFound)
+
+	assert.NoError(t, f.uc.AssignRole(context.Background(), "root", "u1", domain.RoleAdmin))
+	actor, action, target := f.lastAudit(t)
+	assert.Equal(t, "root", actor)
+	assert.Equal(t, domain.AuditAdminRoleAssign, action)
+	assert.Equal(t, "u1", target)
+
+	assert.ErrorIs(t, f.uc.AssignRole(context.Background(), "root", "u1", "nope"), domain.ErrRoleNotFound)
+	assert.ErrorIs(t, f.uc.AssignRole(context.Background(), "root", "ghost", domain.RoleAdmin), domain.ErrUserNotFound)
+	f.roles.AssertNumberOfCalls(t, "AssignRole", 2)
+}
+
+func TestAdmin_UnassignRole(t *testing.T) {
+	f := newAdminFixture()
+	f.repo.On("FindByID", "u1").Return(newTestUser(t, "u1", "a@example.com", "password1", true), nil)
+	f.roles.On("UnassignRole", "u1", domain.RoleAdmin).Return(nil)
+
+	assert.NoError(t, f.uc.UnassignRole(context.Background(), "root", "u1", domain.RoleAdmin))
+	_, action, target := f.lastAudit(t)
+	assert.Equal(t, domain.AuditAdminRoleUnassign, action)
+	assert.Equal(t, "u1", target)
+}
@@ -0,0 +1,124 @@
+package usecase_tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+// auditEvents возвращает записанные события в порядке записи
+func auditEvents(repo *MockAuditRepo) []domain.AuditEvent {
+	var events []domain.AuditEvent
+	for _, c := range repo.Calls {
+		if c.Method == "AppendAudit" {
+			events = append(events, c.Arguments.Get(0).(domain.AuditEvent))
+		}
+	}
+	return events
+}
+
+func TestAudit_RecordTakesClientFromContext(t *testing.T) {
+	audit, repo := recordingAudit()
+	ctx := usecase.WithClient(context.Background(), domain.ClientInfo{IP: "203.0.113.7", UserAgent: "curl/8"})
+
+	audit.Success(ctx, domain.AuditLogout, "uid")
+
+	events := auditEvents(repo)
+	assert.Len(t, events, 1)
+	assert.Equal(t, domain.AuditEvent{
+		ActorID:   "uid",
+		UserID:    "uid",
+		Action:    domain.AuditLogout,
+		Outcome:   domain.AuditSuccess,
+		IP:        "203.0.113.7",
+		UserAgent: "curl/8",
+	}, events[0])
+}
+
+func TestAudit_WriteErrorDoesNotPropagate(t *testing.T) {
+	repo := &MockAuditRepo{}
+	repo.On("AppendAudit", mock.Anything).Return(errors.New("db down"))
+	audit := usecase.NewAuditUsecase(repo, discardLogger())
+
+	// Record has no error to return; it must simply not panic
+	audit.Failure(context.Background(), domain.AuditLogin, "uid", usecase.ErrInvalidCredentials)
+	repo.AssertNumberOfCalls(t, "AppendAudit", 1)
+}
+
+func TestAudit_ListValidatesAndClamps(t *testing.T) {
+	repo := &MockAuditRepo{}
+	audit := usecase.NewAuditUsecase(repo, discardLogger())
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := audit.List(context.Background(), domain.AuditQuery{From: from, To: from.Add(-time.Hour)})
+	assert.ErrorIs(t, err, domain.ErrInvalidAuditQuery)
+
+	repo.On("ListAudit", domain.AuditQuery{UserID: "uid", From: from, Limit: 1000}).Return([]domain.AuditEvent{{ID: 1}}, nil)
+	events, err := audit.List(context.Background(), domain.AuditQuery{UserID: "uid", From: from, Limit: 5000})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestAudit_LoginOutcomes(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	mfa := &MockMFARepo{}
+	audit, auditRepo := recordingAudit()
+	uc := usecase.NewLoginUsecase(repo, mfa, noPasskeys(), noLockout(), kc, c, broker, true, time.Minute, 5, audit, discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	repo.On("FindByEmail", emailVO).Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	ghost, _ := domain.NewEmail("ghost@example.com")
+	repo.On("FindByEmail", ghost).Return(nil, domain.ErrUserNotFound)
+	mfa.On("FindTOTP", "uid").Return(nil, domain.ErrMFANotEnrolled)
+	client := domain.ClientInfo{IP: "198.51.100.1", UserAgent: "Firefox"}
+	kc.On("ListSessions", "uid", "").Return(knownDevice(client), nil)
+	kc.On("GenerateTokens", "uid", mock.Anything).Return("tok", "ref", nil)
+	c.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+
+	_, _, _ = uc.Login(context.Background(), "ghost@example.com", "password1", client)
+	_, _, _ = uc.Login(context.Background(), "alice@example.com", "wrong-password", client)
+	_, _, err := uc.Login(context.Background(), "alice@example.com", "password1", client)
+	assert.NoError(t, err)
+
+	events := auditEvents(auditRepo)
+	assert.Len(t, events, 3)
+
+	assert.Equal(t, domain.AuditFailure, events[0].Outcome)
+	assert.Empty(t, events[0].UserID)
+	assert.Equal(t, "ghost@example.com", events[0].Email)
+
+	assert.Equal(t, domain.AuditFailure, events[1].Outcome)
+	assert.Equal(t, "uid", events[1].UserID)
+	assert.Equal(t, usecase.ErrInvalidCredentials.Error(), events[1].Detail)
+
+	assert.Equal(t, domain.AuditLogin, events[2].Action)
+	assert.Equal(t, domain.AuditSuccess, events[2].Outcome)
+	assert.Equal(t, "198.51.100.1", events[2].IP)
+	assert.Equal(t, "Firefox", events[2].UserAgent)
+}
+
+func TestAudit_AdminActionNamesActorAndTarget(t *testing.T) {
+	f := newAdminFixture()
+	audit, auditRepo := recordingAudit()
+	f.uc = usecase.NewAdminUsecase(f.repo, f.roles, f.kc, f.cache, f.broker, time.Hour, audit, discardLogger())
+	f.repo.On("SetDisabled", "u1", false).Return(nil)
+
+	assert.NoError(t, f.uc.Enable(context.Background(), "root", "u1"))
+
+	events := auditEvents(auditRepo)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "root", events[0].ActorID)
+	assert.Equal(t, "u1", events[0].UserID)
+	assert.Equal(t, domain.AuditAdminEnable, events[0].Action)
+}
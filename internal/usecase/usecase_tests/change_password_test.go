@@ -0,0 +1,93 @@
+package usecase_tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func TestChangePassword_RevokesOtherSessions(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	uc := usecase.NewChangePasswordUsecase(repo, kc, c, broker, noAudit(), discardLogger())
+
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+
+	repo.On("FindByID", "uid").Return(user, nil)
+	repo.On("UpdatePasswordHash", "uid", mock.Anything).Return(nil)
+	kc.On("RevokeOthers", "uid", "current-at").Return([]string{"rt1", "rt2"}, nil)
+	c.On("Delete", "rt1").Return(nil)
+	c.On("Delete", "rt2").Return(nil)
+	broker.On("PublishToTopic", "UserPasswordChanged", mock.Anything).Return(nil)
+
+	err := uc.ChangePassword(context.Background(), "uid", "current-at", "password1", "password2", true)
+	assert.NoError(t, err)
+	c.AssertNumberOfCalls(t, "Delete", 2)
+	broker.AssertCalled(t, "PublishToTopic", "UserPasswordChanged", mock.Anything)
+}
+
+func TestChangePassword_RevokeFails(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	uc := usecase.NewChangePasswordUsecase(repo, kc, &MockCache{}, broker, noAudit(), discardLogger())
+
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+
+	repo.On("FindByID", "uid").Return(user, nil)
+	repo.On("UpdatePasswordHash", "uid", mock.Anything).Return(nil)
+	kc.On("RevokeOthers", "uid", "current-at").Return(nil, errors.New("db down"))
+
+	// пользователь просил завершить другие сессии — об ошибке нужно сообщить
+	err := uc.ChangePassword(context.Background(), "uid", "current-at", "password1", "password2", true)
+	assert.Error(t, err)
+	broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
+
+func TestChangePassword_KeepsSessions(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	uc := usecase.NewChangePasswordUsecase(repo, kc, &MockCache{}, broker, noAudit(), discardLogger())
+
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+
+	repo.On("FindByID", "uid").Return(user, nil)
+	repo.On("UpdatePasswordHash", "uid", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserPasswordChanged", mock.Anything).Return(nil)
+
+	err := uc.ChangePassword(context.Background(), "uid", "current-at", "password1", "password2", false)
+	assert.NoError(t, err)
+	kc.AssertNotCalled(t, "RevokeOthers", mock.Anything, mock.Anything)
+}
+
+func TestChangePassword_WrongCurrent(t *testing.T) {
+	repo := &MockUserRepo{}
+	uc := usecase.NewChangePasswordUsecase(repo, &MockKC{}, &MockCache{}, &MockBroker{}, noAudit(), discardLogger())
+
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+	repo.On("FindByID", "uid").Return(user, nil)
+
+	err := uc.ChangePassword(context.Background(), "uid", "at", "not-my-password", "password2", true)
+	assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	repo.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything)
+}
+
+func TestChangePassword_WeakNewPassword(t *testing.T) {
+	repo := &MockUserRepo{}
+	uc := usecase.NewChangePasswordUsecase(repo, &MockKC{}, &MockCache{}, &MockBroker{}, noAudit(), discardLogger())
+
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+	repo.On("FindByID", "uid").Return(user, nil)
+
+	err := uc.ChangePassword(context.Background(), "uid", "at", "password1", "short", true)
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+}
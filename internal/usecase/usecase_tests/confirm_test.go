@@ -0,0 +1,81 @@
+package usecase_tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func TestConfirm_Success(t *testing.T) {
+	repo := &MockUserRepo{}
+	uc := usecase.NewConfirmEmailUsecase(repo, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", false)
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+	repo.On("MarkConfirmed", "uid", mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.Confirm(context.Background(), "alice@example.com", "code"))
+	assert.True(t, user.IsConfirmed())
+	events := outboxed(repo, "MarkConfirmed")
+	assert.Len(t, events, 1)
+	assert.Equal(t, "UserConfirmed", events[0].Destination)
+	assert.Equal(t, "uid", events[0].AggregateID)
+}
+
+func TestConfirm_InvalidCode(t *testing.T) {
+	repo := &MockUserRepo{}
+	uc := usecase.NewConfirmEmailUsecase(repo, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", false)
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+
+	err := uc.Confirm(context.Background(), "alice@example.com", "wrong")
+	assert.ErrorIs(t, err, domain.ErrInvalidConfirmationCode)
+	repo.AssertNotCalled(t, "MarkConfirmed", mock.Anything, mock.Anything)
+}
+
+func TestConfirm_AlreadyConfirmed(t *testing.T) {
+	repo := &MockUserRepo{}
+	uc := usecase.NewConfirmEmailUsecase(repo, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+
+	err := uc.Confirm(context.Background(), "alice@example.com", "code")
+	assert.ErrorIs(t, err, domain.ErrAlreadyConfirmed)
+}
+
+func TestConfirm_AlreadyConfirmedWrongCode(t *testing.T) {
+	repo := &MockUserRepo{}
+	uc := usecase.NewConfirmEmailUsecase(repo, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	repo.On("FindByEmail", emailVO).Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+
+	err := uc.Confirm(context.Background(), "alice@example.com", "guess")
+	assert.ErrorIs(t, err, domain.ErrInvalidConfirmationCode)
+}
+
+func TestConfirm_UserNotFound(t *testing.T) {
+	repo := &MockUserRepo{}
+	uc := usecase.NewConfirmEmailUsecase(repo, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("bob@example.com")
+	repo.On("FindByEmail", emailVO).Return(nil, errors.New("no rows"))
+
+	// неизвестный адрес неотличим от неверного кода
+	err := uc.Confirm(context.Background(), "bob@example.com", "code")
+	assert.ErrorIs(t, err, domain.ErrInvalidConfirmationCode)
+}
@@ -0,0 +1,257 @@
+package usecase_tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+var testLockout = config.LockoutConfig{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      10,
+	Window:             15 * time.Minute,
+	LockDuration:       15 * time.Minute,
+}
+
+type lockoutFixture struct {
+	uc     *usecase.LoginUsecase
+	guard  *usecase.LoginGuard
+	repo   *MockUserRepo
+	cache  *MockCache
+	broker *MockBroker
+}
+
+func newLockoutFixture(t *testing.T, cfg config.LockoutConfig) *lockoutFixture {
+	f := &lockoutFixture{
+		repo:   &MockUserRepo{},
+		cache:  &MockCache{},
+		broker: &MockBroker{},
+	}
+	f.guard = usecase.NewLoginGuard(f.cache, f.broker, cfg, noAudit(), discardLogger())
+	f.uc = usecase.NewLoginUsecase(f.repo, &MockMFARepo{}, noPasskeys(), f.guard, &MockKC{}, f.cache, f.broker, false, time.Minute, 5, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	f.repo.On("FindByEmail", emailVO).Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	return f
+}
+
+func (f *lockoutFixture) unlocked() {
+	f.cache.On("Get", prefixed("login_lock:")).Return("", cache.ErrKeyNotFound)
+}
+
+var lockoutClient = domain.ClientInfo{IP: "10.0.0.1"}
+
+func TestLockout_WrongPasswordCounts(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.unlocked()
+	f.cache.On("IncrWindow", "login_fail:account:alice@example.com", 15*time.Minute).Return(int64(1), nil)
+	f.cache.On("IncrWindow", "login_fail:ip:10.0.0.1", 15*time.Minute).Return(int64(1), nil)
+
+	_, _, err := f.uc.Login(context.Background(), "alice@example.com", "wrong", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	f.cache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestLockout_UnknownAccountCounts(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	emailVO, _ := domain.NewEmail("ghost@example.com")
+	f.repo.On("FindByEmail", emailVO).Return(nil, errors.New("no rows"))
+	f.unlocked()
+	f.cache.On("IncrWindow", "login_fail:account:ghost@example.com", 15*time.Minute).Return(int64(1), nil)
+	f.cache.On("IncrWindow", "login_fail:ip:10.0.0.1", 15*time.Minute).Return(int64(1), nil)
+
+	_, _, err := f.uc.Login(context.Background(), "ghost@example.com", "wrong", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrUserNotFound)
+	f.cache.AssertNumberOfCalls(t, "IncrWindow", 2)
+}
+
+func TestLockout_LimitLocksAndPublishes(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.unlocked()
+	f.cache.On("IncrWindow", "login_fail:account:alice@example.com", 15*time.Minute).Return(int64(3), nil)
+	f.cache.On("IncrWindow", "login_fail:ip:10.0.0.1", 15*time.Minute).Return(int64(3), nil)
+	f.cache.On("Set", "login_lock:account:alice@example.com", mock.Anything, 15*time.Minute).Return(nil)
+	f.cache.On("Delete", "login_fail:account:alice@example.com").Return(nil)
+	f.broker.On("PublishToTopic", "UserLockedOut", mock.Anything).Return(nil)
+
+	_, _, err := f.uc.Login(context.Background(), "alice@example.com", "wrong", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+
+	var msg struct {
+		UserID      string    `json:"user_id"`
+		IP          string    `json:"ip"`
+		LockedUntil time.Time `json:"locked_until"`
+	}
+	body := f.broker.Calls[0].Arguments.Get(1).([]byte)
+	assert.NoError(t, json.Unmarshal(body, &msg))
+	assert.Equal(t, "uid", msg.UserID)
+	assert.Equal(t, "10.0.0.1", msg.IP)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), msg.LockedUntil, time.Minute)
+}
+
+func TestLockout_LockedRefusesEvenRightPassword(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	until := time.Now().Add(90 * time.Second)
+	f.cache.On("Get", "login_lock:account:alice@example.com").Return(strconv.FormatInt(until.UnixMilli(), 10), nil)
+
+	_, _, err := f.uc.Login(context.Background(), "Alice@Example.com", "password1", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrAccountLocked)
+	var locked *usecase.LockedError
+	assert.True(t, errors.As(err, &locked))
+	assert.Equal(t, 90, locked.RetryAfterSeconds())
+	f.repo.AssertNotCalled(t, "FindByEmail", mock.Anything)
+}
+
+func TestLockout_LockedIP(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.cache.On("Get", "login_lock:account:alice@example.com").Return("", cache.ErrKeyNotFound)
+	f.cache.On("Get", "login_lock:ip:10.0.0.1").Return(strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10), nil)
+
+	_, _, err := f.uc.Login(context.Background(), "alice@example.com", "password1", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrAccountLocked)
+}
+
+func TestLockout_ExpiredLockIsIgnored(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.cache.On("Get", prefixed("login_lock:")).Return(strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10), nil)
+	f.cache.On("IncrWindow", mock.Anything, mock.Anything).Return(int64(1), nil)
+
+	_, _, err := f.uc.Login(context.Background(), "alice@example.com", "wrong", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+}
+
+func TestLockout_ProgressiveDelay(t *testing.T) {
+	cfg := testLockout
+	cfg.BaseDelay = 20 * time.Millisecond
+	cfg.MaxDelay = 50 * time.Millisecond
+	f := newLockoutFixture(t, cfg)
+	f.unlocked()
+	f.cache.On("IncrWindow", "login_fail:account:alice@example.com", 15*time.Minute).Return(int64(2), nil)
+	f.cache.On("IncrWindow", "login_fail:ip:10.0.0.1", 15*time.Minute).Return(int64(2), nil)
+
+	start := time.Now()
+	_, _, err := f.uc.Login(context.Background(), "alice@example.com", "wrong", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	// a cancelled request does not sit out the delay
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	f.guard.Fail(ctx, "alice@example.com", "uid", "")
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestLockout_SuccessResetsAccountCounter(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.unlocked()
+	f.cache.On("Delete", "login_fail:account:alice@example.com").Return(nil)
+
+	mfa := &MockMFARepo{}
+	mfa.On("FindTOTP", "uid").Return(nil, domain.ErrMFANotEnrolled)
+	kc := &MockKC{}
+	kc.On("ListSessions", "uid", "").Return(knownDevice(lockoutClient), nil)
+	kc.On("GenerateTokens", "uid", lockoutClient).Return("tok", "ref", nil)
+	f.cache.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	f.broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+	uc := usecase.NewLoginUsecase(f.repo, mfa, noPasskeys(), f.guard, kc, f.cache, f.broker, false, time.Minute, 5, noAudit(), discardLogger())
+
+	_, _, err := uc.Login(context.Background(), "alice@example.com", "password1", lockoutClient)
+	assert.NoError(t, err)
+	f.cache.AssertCalled(t, "Delete", "login_fail:account:alice@example.com")
+	f.cache.AssertNotCalled(t, "Delete", "login_fail:ip:10.0.0.1")
+}
+
+func TestLockout_PendingSecondFactorKeepsAccountCounter(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.unlocked()
+	mfa := &MockMFARepo{}
+	mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	f.cache.On("Set", prefixed("mfa_challenge:"), "uid", time.Minute).Return(nil)
+	uc := usecase.NewLoginUsecase(f.repo, mfa, noPasskeys(), f.guard, &MockKC{}, f.cache, f.broker, false, time.Minute, 5, noAudit(), discardLogger())
+
+	// the right password alone does not clear failures while MFA is pending
+	_, _, err := uc.Login(context.Background(), "alice@example.com", "password1", lockoutClient)
+	var challenge *usecase.MFAChallenge
+	assert.True(t, errors.As(err, &challenge))
+	f.cache.AssertNotCalled(t, "Delete", mock.Anything)
+}
+
+func TestLockout_WrongSecondFactorCounts(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.repo.On("FindByID", "uid").Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	mfa := &MockMFARepo{}
+	mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	mfa.On("UseRecoveryCode", "uid", mock.Anything).Return(false, nil)
+	f.cache.On("Get", prefixed("mfa_challenge:")).Return("uid", nil)
+	f.cache.On("Incr", prefixed("mfa_attempts:"), time.Minute).Return(int64(1), nil)
+	f.cache.On("IncrWindow", "login_fail:account:alice@example.com", 15*time.Minute).Return(int64(1), nil)
+	f.cache.On("IncrWindow", "login_fail:ip:10.0.0.1", 15*time.Minute).Return(int64(1), nil)
+	uc := usecase.NewLoginUsecase(f.repo, mfa, noPasskeys(), f.guard, &MockKC{}, f.cache, f.broker, false, time.Minute, 5, noAudit(), discardLogger())
+
+	_, _, err := uc.VerifyMFA(context.Background(), "mfa-token", "not-a-code", lockoutClient)
+	assert.ErrorIs(t, err, domain.ErrInvalidOTP)
+	f.cache.AssertNumberOfCalls(t, "IncrWindow", 2)
+}
+
+func TestLockout_SecondFactorResetsAccountCounter(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.repo.On("FindByID", "uid").Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	mfa := &MockMFARepo{}
+	mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	mfa.On("UseRecoveryCode", "uid", mock.Anything).Return(true, nil)
+	f.cache.On("Get", prefixed("mfa_challenge:")).Return("uid", nil)
+	f.cache.On("Incr", prefixed("mfa_attempts:"), time.Minute).Return(int64(1), nil)
+	f.cache.On("GetDel", prefixed("mfa_challenge:")).Return("uid", nil)
+	f.cache.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	f.cache.On("Delete", "login_fail:account:alice@example.com").Return(nil)
+	f.broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+	kc := &MockKC{}
+	kc.On("ListSessions", "uid", "").Return(knownDevice(lockoutClient), nil)
+	kc.On("GenerateTokens", "uid", lockoutClient).Return("tok", "ref", nil)
+	uc := usecase.NewLoginUsecase(f.repo, mfa, noPasskeys(), f.guard, kc, f.cache, f.broker, false, time.Minute, 5, noAudit(), discardLogger())
+
+	_, _, err := uc.VerifyMFA(context.Background(), "mfa-token", "abcde-fghij", lockoutClient)
+	assert.NoError(t, err)
+	f.cache.AssertCalled(t, "Delete", "login_fail:account:alice@example.com")
+}
+
+func TestLockout_Unlock(t *testing.T) {
+	f := newLockoutFixture(t, testLockout)
+	f.cache.On("Delete", mock.Anything).Return(nil)
+	audit, auditRepo := recordingAudit()
+	guard := usecase.NewLoginGuard(f.cache, f.broker, testLockout, audit, discardLogger())
+
+	assert.NoError(t, guard.Unlock(context.Background(), "lockctl:ops", "Alice@example.com"))
+	assert.NoError(t, guard.UnlockIP(context.Background(), "lockctl:ops", "10.0.0.1"))
+	f.cache.AssertCalled(t, "Delete", "login_lock:account:alice@example.com")
+	f.cache.AssertCalled(t, "Delete", "login_fail:account:alice@example.com")
+	f.cache.AssertCalled(t, "Delete", "login_lock:ip:10.0.0.1")
+
+	// оба снятия блокировки попадают в журнал аудита
+	events := auditEvents(auditRepo)
+	assert.Len(t, events, 2)
+	assert.Equal(t, domain.AuditLockoutUnlock, events[0].Action)
+	assert.Equal(t, "lockctl:ops", events[0].ActorID)
+	assert.Equal(t, "alice@example.com", events[0].Email)
+	assert.Equal(t, "10.0.0.1", events[1].IP)
+}
+
+func TestLockout_DisabledTouchesNoCache(t *testing.T) {
+	f := newLockoutFixture(t, config.LockoutConfig{})
+
+	_, _, err := f.uc.Login(context.Background(), "alice@example.com", "wrong", lockoutClient)
+	assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	assert.Empty(t, f.cache.Calls)
+}
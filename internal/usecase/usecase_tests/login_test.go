@@ -1,6 +1,8 @@
 package usecase_tests
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"github.com/stretchr/testify/mock"
 	"testing"
@@ -12,69 +14,175 @@ import (
 	"github.com/ParkieV/auth-service/internal/usecase"
 )
 
+func newTestUser(t *testing.T, id, email, pwd string, confirmed bool) *domain.User {
+	t.Helper()
+	emailVO, _ := domain.NewEmail(email)
+	user, err := domain.NewUserFromRegistration(id, emailVO, pwd, "code", time.Hour)
+	assert.NoError(t, err)
+	if confirmed {
+		assert.NoError(t, user.Confirm("code", time.Now()))
+	}
+	return user
+}
+
+// newDisabledUser is a confirmed user an admin has since disabled.
+func newDisabledUser(t *testing.T, id, email string) *domain.User {
+	t.Helper()
+	active := newTestUser(t, id, email, "password1", true)
+	user, err := domain.RehydrateUser(id, active.Email(), active.HashForStorage(), "code",
+		active.ExpiresAt(), true, active.CreatedAt(), time.Now())
+	assert.NoError(t, err)
+	return user
+}
+
 func TestLogin_Success(t *testing.T) {
 	repo := &MockUserRepo{}
 	kc := &MockKC{}
 	cache := &MockCache{}
-	uc := usecase.NewLoginUsecase(repo, kc, cache)
+	broker := &MockBroker{}
+	mfa := &MockMFARepo{}
+	uc := usecase.NewLoginUsecase(repo, mfa, noPasskeys(), noLockout(), kc, cache, broker, true, 5*time.Minute, 5, noAudit(), discardLogger())
 
 	emailVO, _ := domain.NewEmail("alice@example.com")
-	user := domain.NewUser("uid", emailVO, "hash", "code", time.Now().Add(time.Hour))
-	user.Confirmed = true
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+	client := domain.ClientInfo{UserAgent: "test", IP: "127.0.0.1", DeviceLabel: "laptop"}
 
 	repo.On("FindByEmail", emailVO).Return(user, nil)
-	kc.On("Authenticate", emailVO.String(), "pass").Return("tok", "ref", nil)
-	cache.On("Set", "ref", "uid", mock.Anything).Return(nil)
+	mfa.On("FindTOTP", "uid").Return(nil, domain.ErrMFANotEnrolled)
+	kc.On("ListSessions", "uid", "").Return(knownDevice(client), nil)
+	kc.On("GenerateTokens", "uid", client).Return("tok", "ref", nil)
+	cache.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
 
-	access, refresh, err := uc.Login("alice@example.com", "pass")
+	access, refresh, err := uc.Login(context.Background(), "alice@example.com", "password1", client)
 	assert.NoError(t, err)
 	assert.Equal(t, "tok", access)
 	assert.Equal(t, "ref", refresh)
+	// устройство уже известно — письма нет
+	broker.AssertNotCalled(t, "PublishToQueue", mock.Anything, mock.Anything)
+}
+
+func TestLogin_NewDeviceAlert(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	cache := &MockCache{}
+	broker := &MockBroker{}
+	mfa := &MockMFARepo{}
+	uc := usecase.NewLoginUsecase(repo, mfa, noPasskeys(), noLockout(), kc, cache, broker, true, 5*time.Minute, 5, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+	client := domain.ClientInfo{UserAgent: "Firefox", IP: "203.0.113.7"}
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+	repo.On("FindByID", "uid").Return(user, nil)
+	mfa.On("FindTOTP", "uid").Return(nil, domain.ErrMFANotEnrolled)
+	// сеанс с другого браузера, но с того же IP — устройство новое
+	kc.On("ListSessions", "uid", "").Return(knownDevice(domain.ClientInfo{UserAgent: "Chrome", IP: "203.0.113.7"}), nil)
+	kc.On("GenerateTokens", "uid", client).Return("tok", "ref", nil)
+	cache.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+	broker.On("PublishToQueue", "email.login_alert", mock.Anything).Return(nil)
+
+	ctx := usecase.WithClient(context.Background(), domain.ClientInfo{Language: "ru"})
+	_, _, err := uc.Login(ctx, "alice@example.com", "password1", client)
+	assert.NoError(t, err)
+
+	var msg struct {
+		Email      string    `json:"email"`
+		IP         string    `json:"ip"`
+		UserAgent  string    `json:"user_agent"`
+		SignedInAt time.Time `json:"signed_in_at"`
+		Language   string    `json:"language"`
+	}
+	for _, c := range broker.Calls {
+		if c.Method == "PublishToQueue" {
+			assert.NoError(t, json.Unmarshal(c.Arguments.Get(1).([]byte), &msg))
+		}
+	}
+	assert.Equal(t, "alice@example.com", msg.Email)
+	assert.Equal(t, "203.0.113.7", msg.IP)
+	assert.Equal(t, "Firefox", msg.UserAgent)
+	assert.Equal(t, "ru", msg.Language)
+	assert.WithinDuration(t, time.Now(), msg.SignedInAt, time.Minute)
+}
+
+func TestLogin_NoAlertWhenSessionsUnknown(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	cache := &MockCache{}
+	broker := &MockBroker{}
+	mfa := &MockMFARepo{}
+	uc := usecase.NewLoginUsecase(repo, mfa, noPasskeys(), noLockout(), kc, cache, broker, true, 5*time.Minute, 5, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	repo.On("FindByEmail", emailVO).Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	mfa.On("FindTOTP", "uid").Return(nil, domain.ErrMFANotEnrolled)
+	// ошибка при чтении сеансов не мешает входу и не шлёт письмо
+	kc.On("ListSessions", "uid", "").Return(nil, errors.New("db down"))
+	kc.On("GenerateTokens", "uid", mock.Anything).Return("tok", "ref", nil)
+	cache.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+
+	_, _, err := uc.Login(context.Background(), "alice@example.com", "password1", domain.ClientInfo{UserAgent: "Firefox"})
+	assert.NoError(t, err)
+	broker.AssertNotCalled(t, "PublishToQueue", mock.Anything, mock.Anything)
 }
 
 func TestLogin_InvalidEmail(t *testing.T) {
-	uc := usecase.NewLoginUsecase(nil, nil, nil)
-	_, _, err := uc.Login("bad-email", "pwd")
+	uc := usecase.NewLoginUsecase(nil, nil, nil, nil, nil, nil, nil, false, time.Minute, 5, noAudit(), discardLogger())
+	_, _, err := uc.Login(context.Background(), "bad-email", "pwd", domain.ClientInfo{})
 	assert.ErrorIs(t, err, domain.ErrInvalidEmail)
 }
 
 func TestLogin_UserNotFound(t *testing.T) {
 	repo := &MockUserRepo{}
-	uc := usecase.NewLoginUsecase(repo, &MockKC{}, &MockCache{})
+	uc := usecase.NewLoginUsecase(repo, &MockMFARepo{}, noPasskeys(), noLockout(), &MockKC{}, &MockCache{}, &MockBroker{}, false, time.Minute, 5, noAudit(), discardLogger())
 
 	emailVO, _ := domain.NewEmail("bob@example.com")
 	repo.On("FindByEmail", emailVO).Return(nil, errors.New("no rows"))
 
-	_, _, err := uc.Login("bob@example.com", "pwd")
+	_, _, err := uc.Login(context.Background(), "bob@example.com", "pwd", domain.ClientInfo{})
 	assert.ErrorIs(t, err, usecase.ErrUserNotFound)
 }
 
 func TestLogin_NotConfirmed(t *testing.T) {
 	repo := &MockUserRepo{}
-	uc := usecase.NewLoginUsecase(repo, &MockKC{}, &MockCache{})
+	uc := usecase.NewLoginUsecase(repo, &MockMFARepo{}, noPasskeys(), noLockout(), &MockKC{}, &MockCache{}, &MockBroker{}, true, time.Minute, 5, noAudit(), discardLogger())
 
 	emailVO, _ := domain.NewEmail("eve@example.com")
-	user := domain.NewUser("uid2", emailVO, "h", "c", time.Now().Add(time.Hour))
-	// user.Confirmed == false
+	user := newTestUser(t, "uid2", "eve@example.com", "password1", false)
 
 	repo.On("FindByEmail", emailVO).Return(user, nil)
 
-	_, _, err := uc.Login("eve@example.com", "pwd")
+	_, _, err := uc.Login(context.Background(), "eve@example.com", "password1", domain.ClientInfo{})
 	assert.ErrorIs(t, err, usecase.ErrNotConfirmed)
 }
 
+func TestLogin_Disabled(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	uc := usecase.NewLoginUsecase(repo, &MockMFARepo{}, noPasskeys(), noLockout(), kc, &MockCache{}, &MockBroker{}, true, time.Minute, 5, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("mallory@example.com")
+	repo.On("FindByEmail", emailVO).Return(newDisabledUser(t, "uid4", "mallory@example.com"), nil)
+
+	_, _, err := uc.Login(context.Background(), "mallory@example.com", "password1", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrAccountDisabled)
+	kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
 func TestLogin_InvalidCredentials(t *testing.T) {
 	repo := &MockUserRepo{}
 	kc := &MockKC{}
-	uc := usecase.NewLoginUsecase(repo, kc, &MockCache{})
+	uc := usecase.NewLoginUsecase(repo, &MockMFARepo{}, noPasskeys(), noLockout(), kc, &MockCache{}, &MockBroker{}, true, time.Minute, 5, noAudit(), discardLogger())
 
 	emailVO, _ := domain.NewEmail("alice@example.com")
-	user := domain.NewUser("uid3", emailVO, "h", "c", time.Now().Add(time.Hour))
-	user.Confirmed = true
+	user := newTestUser(t, "uid3", "alice@example.com", "password1", true)
 
 	repo.On("FindByEmail", emailVO).Return(user, nil)
-	kc.On("Authenticate", emailVO.String(), "wrong").Return("", "", errors.New("denied"))
 
-	_, _, err := uc.Login("alice@example.com", "wrong")
+	_, _, err := uc.Login(context.Background(), "alice@example.com", "wrong-password", domain.ClientInfo{})
 	assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
 }
@@ -0,0 +1,37 @@
+package usecase_tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func TestLogoutAll_Success(t *testing.T) {
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	uc := usecase.NewLogoutUsecase(kc, broker, c, noAudit(), discardLogger())
+
+	kc.On("RevokeAll", "uid").Return(nil)
+	c.On("DeleteUserRefresh", "uid").Return(3, nil)
+	broker.On("PublishToTopic", "UserLoggedOutEverywhere", mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.LogoutAll(context.Background(), "uid"))
+	broker.AssertNumberOfCalls(t, "PublishToTopic", 1)
+}
+
+func TestLogoutAll_RevokeFails(t *testing.T) {
+	kc := &MockKC{}
+	c := &MockCache{}
+	uc := usecase.NewLogoutUsecase(kc, &MockBroker{}, c, noAudit(), discardLogger())
+
+	kc.On("RevokeAll", "uid").Return(errors.New("db down"))
+
+	assert.Error(t, uc.LogoutAll(context.Background(), "uid"))
+	c.AssertNotCalled(t, "DeleteUserRefresh", mock.Anything)
+}
@@ -0,0 +1,250 @@
+package usecase_tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func prefixed(prefix string) any {
+	return mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+func confirmedTOTP(t *testing.T, userID string) *domain.TOTP {
+	t.Helper()
+	totp, err := domain.NewTOTP(userID)
+	assert.NoError(t, err)
+	totp.Confirmed = true
+	return totp
+}
+
+func TestLogin_MFARequired(t *testing.T) {
+	repo := &MockUserRepo{}
+	mfa := &MockMFARepo{}
+	kc := &MockKC{}
+	c := &MockCache{}
+	uc := usecase.NewLoginUsecase(repo, mfa, noPasskeys(), noLockout(), kc, c, &MockBroker{}, false, 5*time.Minute, 5, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	repo.On("FindByEmail", emailVO).Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	c.On("Set", prefixed("mfa_challenge:"), "uid", 5*time.Minute).Return(nil)
+
+	_, _, err := uc.Login(context.Background(), "alice@example.com", "password1", domain.ClientInfo{})
+
+	var challenge *usecase.MFAChallenge
+	assert.True(t, errors.As(err, &challenge))
+	assert.NotEmpty(t, challenge.Token)
+	assert.Equal(t, []string{usecase.MFAMethodTOTP}, challenge.Methods)
+	kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestLogin_PendingEnrollmentDoesNotChallenge(t *testing.T) {
+	repo := &MockUserRepo{}
+	mfa := &MockMFARepo{}
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	uc := usecase.NewLoginUsecase(repo, mfa, noPasskeys(), noLockout(), kc, c, broker, false, time.Minute, 5, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	pending, _ := domain.NewTOTP("uid")
+	repo.On("FindByEmail", emailVO).Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	mfa.On("FindTOTP", "uid").Return(pending, nil)
+	kc.On("ListSessions", "uid", "").Return(knownDevice(domain.ClientInfo{}), nil)
+	kc.On("GenerateTokens", "uid", domain.ClientInfo{}).Return("tok", "ref", nil)
+	c.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+
+	access, _, err := uc.Login(context.Background(), "alice@example.com", "password1", domain.ClientInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, "tok", access)
+}
+
+func newVerifyMFAFixture(t *testing.T) (*usecase.LoginUsecase, *MockMFARepo, *MockKC, *MockCache, *MockBroker) {
+	mfa := &MockMFARepo{}
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	repo := &MockUserRepo{}
+	uc := usecase.NewLoginUsecase(repo, mfa, noPasskeys(), noLockout(), kc, c, broker, false, 5*time.Minute, 3, noAudit(), discardLogger())
+	c.On("Get", prefixed("mfa_challenge:")).Return("uid", nil)
+	repo.On("FindByID", "uid").Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	return uc, mfa, kc, c, broker
+}
+
+func TestVerifyMFA_TOTP(t *testing.T) {
+	uc, mfa, kc, c, broker := newVerifyMFAFixture(t)
+	totp := confirmedTOTP(t, "uid")
+	client := domain.ClientInfo{IP: "127.0.0.1"}
+
+	c.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(1), nil)
+	mfa.On("FindTOTP", "uid").Return(totp, nil)
+	mfa.On("AdvanceTOTPStep", "uid", mock.Anything).Return(true, nil)
+	c.On("GetDel", prefixed("mfa_challenge:")).Return("uid", nil)
+	kc.On("ListSessions", "uid", "").Return(knownDevice(client), nil)
+	kc.On("GenerateTokens", "uid", client).Return("tok", "ref", nil)
+	c.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+
+	access, refresh, err := uc.VerifyMFA(context.Background(), "mfa-token", totp.Code(time.Now()), client)
+	assert.NoError(t, err)
+	assert.Equal(t, "tok", access)
+	assert.Equal(t, "ref", refresh)
+}
+
+func TestVerifyMFA_RecoveryCode(t *testing.T) {
+	uc, mfa, kc, c, broker := newVerifyMFAFixture(t)
+
+	c.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(1), nil)
+	mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	mfa.On("UseRecoveryCode", "uid", domain.HashRecoveryCode("abcde-fghij")).Return(true, nil)
+	c.On("GetDel", prefixed("mfa_challenge:")).Return("uid", nil)
+	kc.On("ListSessions", "uid", "").Return(knownDevice(domain.ClientInfo{}), nil)
+	kc.On("GenerateTokens", "uid", domain.ClientInfo{}).Return("tok", "ref", nil)
+	c.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+
+	_, _, err := uc.VerifyMFA(context.Background(), "mfa-token", "ABCDE-FGHIJ", domain.ClientInfo{})
+	assert.NoError(t, err)
+}
+
+func TestVerifyMFA_WrongCodeKeepsChallenge(t *testing.T) {
+	uc, mfa, kc, c, _ := newVerifyMFAFixture(t)
+
+	c.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(1), nil)
+	mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	mfa.On("UseRecoveryCode", "uid", mock.Anything).Return(false, nil)
+
+	_, _, err := uc.VerifyMFA(context.Background(), "mfa-token", "not-a-code", domain.ClientInfo{})
+	assert.ErrorIs(t, err, domain.ErrInvalidOTP)
+	c.AssertNotCalled(t, "GetDel", mock.Anything)
+	kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestVerifyMFA_ReplayedCode(t *testing.T) {
+	uc, mfa, _, c, _ := newVerifyMFAFixture(t)
+	totp := confirmedTOTP(t, "uid")
+
+	c.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(1), nil)
+	mfa.On("FindTOTP", "uid").Return(totp, nil)
+	mfa.On("AdvanceTOTPStep", "uid", mock.Anything).Return(false, nil)
+
+	_, _, err := uc.VerifyMFA(context.Background(), "mfa-token", totp.Code(time.Now()), domain.ClientInfo{})
+	assert.ErrorIs(t, err, domain.ErrInvalidOTP)
+}
+
+func TestVerifyMFA_PendingEnrollment(t *testing.T) {
+	uc, mfa, kc, c, _ := newVerifyMFAFixture(t)
+	pending, err := domain.NewTOTP("uid")
+	assert.NoError(t, err)
+
+	// неподтверждённый TOTP не принимается, даже с верным кодом
+	c.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(1), nil)
+	mfa.On("FindTOTP", "uid").Return(pending, nil)
+
+	_, _, err = uc.VerifyMFA(context.Background(), "mfa-token", pending.Code(time.Now()), domain.ClientInfo{})
+	assert.ErrorIs(t, err, domain.ErrInvalidOTP)
+	mfa.AssertNotCalled(t, "AdvanceTOTPStep", mock.Anything, mock.Anything)
+	kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestVerifyMFA_AttemptsExhausted(t *testing.T) {
+	uc, mfa, _, c, _ := newVerifyMFAFixture(t)
+
+	c.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(4), nil)
+	c.On("Delete", prefixed("mfa_challenge:")).Return(nil)
+
+	_, _, err := uc.VerifyMFA(context.Background(), "mfa-token", "123456", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidMFAToken)
+	mfa.AssertNotCalled(t, "FindTOTP", mock.Anything)
+}
+
+func TestVerifyMFA_UnknownToken(t *testing.T) {
+	c := &MockCache{}
+	uc := usecase.NewLoginUsecase(&MockUserRepo{}, &MockMFARepo{}, noPasskeys(), noLockout(), &MockKC{}, c, &MockBroker{}, false, time.Minute, 3, noAudit(), discardLogger())
+	c.On("Get", mock.Anything).Return("", cache.ErrKeyNotFound)
+
+	_, _, err := uc.VerifyMFA(context.Background(), "expired", "123456", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidMFAToken)
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	users := &MockUserRepo{}
+	mfa := &MockMFARepo{}
+	uc := usecase.NewMFAUsecase(users, mfa, &MockBroker{}, "Parkie", noAudit(), discardLogger())
+
+	users.On("FindByID", "uid").Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	mfa.On("SavePendingTOTP", mock.Anything).Return(nil)
+
+	res, err := uc.EnrollTOTP(context.Background(), "uid")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.URI, "otpauth://totp/Parkie:alice@example.com?"))
+	assert.Contains(t, res.URI, "secret="+res.Secret)
+	assert.True(t, strings.HasPrefix(res.QRCode, "data:image/png;base64,"))
+}
+
+func TestEnrollTOTP_AlreadyEnabled(t *testing.T) {
+	users := &MockUserRepo{}
+	mfa := &MockMFARepo{}
+	uc := usecase.NewMFAUsecase(users, mfa, &MockBroker{}, "Parkie", noAudit(), discardLogger())
+
+	users.On("FindByID", "uid").Return(newTestUser(t, "uid", "alice@example.com", "password1", true), nil)
+	mfa.On("SavePendingTOTP", mock.Anything).Return(domain.ErrMFAAlreadyEnabled)
+
+	_, err := uc.EnrollTOTP(context.Background(), "uid")
+	assert.ErrorIs(t, err, domain.ErrMFAAlreadyEnabled)
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	mfa := &MockMFARepo{}
+	broker := &MockBroker{}
+	uc := usecase.NewMFAUsecase(&MockUserRepo{}, mfa, broker, "Parkie", noAudit(), discardLogger())
+
+	pending, _ := domain.NewTOTP("uid")
+	mfa.On("FindTOTP", "uid").Return(pending, nil)
+	mfa.On("ConfirmTOTP", "uid", mock.Anything, mock.MatchedBy(func(h []string) bool { return len(h) == 10 })).Return(nil)
+	broker.On("PublishToTopic", "UserMFAEnabled", mock.Anything).Return(nil)
+
+	codes, err := uc.ConfirmTOTP(context.Background(), "uid", pending.Code(time.Now()))
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+}
+
+func TestConfirmTOTP_WrongCode(t *testing.T) {
+	mfa := &MockMFARepo{}
+	uc := usecase.NewMFAUsecase(&MockUserRepo{}, mfa, &MockBroker{}, "Parkie", noAudit(), discardLogger())
+
+	pending, _ := domain.NewTOTP("uid")
+	mfa.On("FindTOTP", "uid").Return(pending, nil)
+	if pending.Code(time.Now()) == "000000" {
+		t.Skip("generated secret happens to produce 000000")
+	}
+
+	_, err := uc.ConfirmTOTP(context.Background(), "uid", "000000")
+	assert.ErrorIs(t, err, domain.ErrInvalidOTP)
+	mfa.AssertNotCalled(t, "ConfirmTOTP", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDisableTOTP_WithRecoveryCode(t *testing.T) {
+	mfa := &MockMFARepo{}
+	broker := &MockBroker{}
+	uc := usecase.NewMFAUsecase(&MockUserRepo{}, mfa, broker, "Parkie", noAudit(), discardLogger())
+
+	mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	mfa.On("UseRecoveryCode", "uid", domain.HashRecoveryCode("abcde-fghij")).Return(true, nil)
+	mfa.On("DeleteTOTP", "uid").Return(nil)
+	broker.On("PublishToTopic", "UserMFADisabled", mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.DisableTOTP(context.Background(), "uid", "abcde-fghij"))
+	mfa.AssertCalled(t, "DeleteTOTP", "uid")
+}
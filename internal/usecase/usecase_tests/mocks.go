@@ -1,21 +1,32 @@
 package usecase_tests
 
 import (
+	"context"
+	"io"
+	"log/slog"
 	"time"
 
 	"github.com/stretchr/testify/mock"
 
+	"github.com/ParkieV/auth-service/internal/config"
 	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"github.com/ParkieV/auth-service/internal/usecase"
 )
 
-// Мок для UserRepository — и Save, и FindByEmail
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// Мок для UserAdminRepository (покрывает и UserMutRepository)
 type MockUserRepo struct{ mock.Mock }
 
-func (m *MockUserRepo) Save(u *domain.User) error {
-	return m.Called(u).Error(0)
+func (m *MockUserRepo) Save(_ context.Context, u *domain.User, events ...db.OutboxMessage) error {
+	return m.Called(u, events).Error(0)
 }
 
-func (m *MockUserRepo) FindByEmail(email domain.Email) (*domain.User, error) {
+func (m *MockUserRepo) FindByEmail(_ context.Context, email domain.Email) (*domain.User, error) {
 	args := m.Called(email)
 	if u := args.Get(0); u != nil {
 		return u.(*domain.User), args.Error(1)
@@ -23,38 +34,341 @@ func (m *MockUserRepo) FindByEmail(email domain.Email) (*domain.User, error) {
 	return nil, args.Error(1)
 }
 
+func (m *MockUserRepo) FindByID(_ context.Context, id string) (*domain.User, error) {
+	args := m.Called(id)
+	if u := args.Get(0); u != nil {
+		return u.(*domain.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUserRepo) UpdatePasswordHash(_ context.Context, userID, newHash string) error {
+	return m.Called(userID, newHash).Error(0)
+}
+
+func (m *MockUserRepo) MarkConfirmed(_ context.Context, userID string, events ...db.OutboxMessage) error {
+	return m.Called(userID, events).Error(0)
+}
+
+func (m *MockUserRepo) UpdateConfirmation(_ context.Context, userID, confirmationID string, expiresAt time.Time, events ...db.OutboxMessage) error {
+	return m.Called(userID, confirmationID, expiresAt, events).Error(0)
+}
+
+// outboxed возвращает сообщения, переданные в последний вызов method
+func outboxed(repo *MockUserRepo, method string) []db.OutboxMessage {
+	var events []db.OutboxMessage
+	for _, c := range repo.Calls {
+		if c.Method == method {
+			events = c.Arguments.Get(len(c.Arguments) - 1).([]db.OutboxMessage)
+		}
+	}
+	return events
+}
+
+func (m *MockUserRepo) ListUsers(_ context.Context, query string, limit, offset int) ([]*domain.User, int, error) {
+	args := m.Called(query, limit, offset)
+	if u := args.Get(0); u != nil {
+		return u.([]*domain.User), args.Int(1), args.Error(2)
+	}
+	return nil, args.Int(1), args.Error(2)
+}
+
+func (m *MockUserRepo) SetDisabled(_ context.Context, userID string, disabled bool) error {
+	return m.Called(userID, disabled).Error(0)
+}
+
+func (m *MockUserRepo) Delete(_ context.Context, userID string) error {
+	return m.Called(userID).Error(0)
+}
+
 // Мок для MessageBroker
 type MockBroker struct{ mock.Mock }
 
-func (m *MockBroker) Publish(queue string, body []byte) error {
+func (m *MockBroker) PublishToQueue(_ context.Context, queue string, body []byte) error {
 	return m.Called(queue, body).Error(0)
 }
 
-// Мок для KeycloakClient
+func (m *MockBroker) PublishToTopic(_ context.Context, topic string, body []byte) error {
+	return m.Called(topic, body).Error(0)
+}
+
+func (m *MockBroker) Close() error {
+	return m.Called().Error(0)
+}
+
+// Мок для AuthClient
 type MockKC struct{ mock.Mock }
 
-func (m *MockKC) Authenticate(email, password string) (string, string, error) {
-	args := m.Called(email, password)
+func (m *MockKC) GenerateTokens(_ context.Context, userID string, client domain.ClientInfo) (string, string, error) {
+	args := m.Called(userID, client)
 	return args.String(0), args.String(1), args.Error(2)
 }
 
-func (m *MockKC) RefreshToken(refreshToken string) (string, string, error) {
-	args := m.Called(refreshToken)
-	return args.String(0), args.String(1), args.Error(2)
+func (m *MockKC) Introspect(_ context.Context, token, hint string) (auth_client.TokenInfo, error) {
+	args := m.Called(token, hint)
+	return args.Get(0).(auth_client.TokenInfo), args.Error(1)
+}
+
+func (m *MockKC) Logout(_ context.Context, refreshToken string) error {
+	return m.Called(refreshToken).Error(0)
+}
+
+func (m *MockKC) RevokeAll(_ context.Context, userID string) error {
+	return m.Called(userID).Error(0)
+}
+
+func (m *MockKC) RevokeOthers(_ context.Context, userID, keepAccessToken string) ([]string, error) {
+	args := m.Called(userID, keepAccessToken)
+	if rts := args.Get(0); rts != nil {
+		return rts.([]string), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockKC) RotateRefresh(_ context.Context, oldRefresh, newRefresh string) (auth_client.Rotation, error) {
+	args := m.Called(oldRefresh, newRefresh)
+	return args.Get(0).(auth_client.Rotation), args.Error(1)
+}
+
+func (m *MockKC) RevokeFamily(_ context.Context, familyID string) ([]string, error) {
+	args := m.Called(familyID)
+	if rts := args.Get(0); rts != nil {
+		return rts.([]string), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockKC) RevokeToken(_ context.Context, token, hint string) (string, []string, error) {
+	args := m.Called(token, hint)
+	if rts := args.Get(1); rts != nil {
+		return args.String(0), rts.([]string), args.Error(2)
+	}
+	return args.String(0), nil, args.Error(2)
+}
+
+func (m *MockKC) ListSessions(_ context.Context, userID, currentAccessToken string) ([]domain.Session, error) {
+	args := m.Called(userID, currentAccessToken)
+	if s := args.Get(0); s != nil {
+		return s.([]domain.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockKC) RevokeSession(_ context.Context, userID, sessionID string) ([]string, error) {
+	args := m.Called(userID, sessionID)
+	if rts := args.Get(0); rts != nil {
+		return rts.([]string), args.Error(1)
+	}
+	return nil, args.Error(1)
 }
 
 // Мок для Cache
 type MockCache struct{ mock.Mock }
 
-func (m *MockCache) Set(key, value string, ttl time.Duration) error {
+func (m *MockCache) Set(_ context.Context, key, value string, ttl time.Duration) error {
 	return m.Called(key, value, ttl).Error(0)
 }
 
-func (m *MockCache) Get(key string) (string, error) {
+func (m *MockCache) Get(_ context.Context, key string) (string, error) {
 	args := m.Called(key)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockCache) Delete(key string) error {
+func (m *MockCache) SwapRefresh(_ context.Context, userID, oldRT, newRT string, ttl time.Duration) (bool, error) {
+	args := m.Called(userID, oldRT, newRT, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockCache) Delete(_ context.Context, key string) error {
 	return m.Called(key).Error(0)
 }
+
+func (m *MockCache) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	args := m.Called(key, ttl)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) IncrWindow(_ context.Context, key string, window time.Duration) (int64, error) {
+	args := m.Called(key, window)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockCache) GetDel(_ context.Context, key string) (string, error) {
+	args := m.Called(key)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockCache) SetRefresh(_ context.Context, userID, refresh string, ttl time.Duration) error {
+	return m.Called(userID, refresh, ttl).Error(0)
+}
+
+func (m *MockCache) DeleteUserRefresh(_ context.Context, userID string) (int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Error(1)
+}
+
+// Мок для MFARepository
+type MockMFARepo struct{ mock.Mock }
+
+func (m *MockMFARepo) FindTOTP(_ context.Context, userID string) (*domain.TOTP, error) {
+	args := m.Called(userID)
+	if t := args.Get(0); t != nil {
+		return t.(*domain.TOTP), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockMFARepo) SavePendingTOTP(_ context.Context, t *domain.TOTP) error {
+	return m.Called(t).Error(0)
+}
+
+func (m *MockMFARepo) ConfirmTOTP(_ context.Context, userID string, step int64, recoveryHashes []string) error {
+	return m.Called(userID, step, recoveryHashes).Error(0)
+}
+
+func (m *MockMFARepo) AdvanceTOTPStep(_ context.Context, userID string, step int64) (bool, error) {
+	args := m.Called(userID, step)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) UseRecoveryCode(_ context.Context, userID, hash string) (bool, error) {
+	args := m.Called(userID, hash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) DeleteTOTP(_ context.Context, userID string) error {
+	return m.Called(userID).Error(0)
+}
+
+// Мок для WebAuthnRepository
+type MockWebAuthnRepo struct{ mock.Mock }
+
+func (m *MockWebAuthnRepo) ListCredentials(_ context.Context, userID string) ([]domain.WebAuthnCredential, error) {
+	args := m.Called(userID)
+	if c := args.Get(0); c != nil {
+		return c.([]domain.WebAuthnCredential), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockWebAuthnRepo) CountCredentials(_ context.Context, userID string) (int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWebAuthnRepo) FindCredential(_ context.Context, id []byte) (*domain.WebAuthnCredential, error) {
+	args := m.Called(id)
+	if c := args.Get(0); c != nil {
+		return c.(*domain.WebAuthnCredential), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockWebAuthnRepo) SaveCredential(_ context.Context, c *domain.WebAuthnCredential) error {
+	return m.Called(c).Error(0)
+}
+
+func (m *MockWebAuthnRepo) TouchCredential(_ context.Context, id []byte, signCount uint32, backupState bool) error {
+	return m.Called(id, signCount, backupState).Error(0)
+}
+
+func (m *MockWebAuthnRepo) DeleteCredential(_ context.Context, userID string, id []byte) error {
+	return m.Called(userID, id).Error(0)
+}
+
+// noPasskeys отвечает, что у пользователя нет WebAuthn-ключей
+func noPasskeys() *MockWebAuthnRepo {
+	m := &MockWebAuthnRepo{}
+	m.On("CountCredentials", mock.Anything).Return(0, nil)
+	return m
+}
+
+// Сторож логина с выключенными счётчиками: кэш не трогает
+func noLockout() *usecase.LoginGuard {
+	return usecase.NewLoginGuard(nil, nil, config.LockoutConfig{}, noAudit(), discardLogger())
+}
+
+// Мок для RoleRepository
+// knownDevice — активные сеансы, среди которых уже есть client, чтобы вход
+// не считался входом с нового устройства
+func knownDevice(client domain.ClientInfo) []domain.Session {
+	return []domain.Session{{ID: "s0", Client: client}}
+}
+
+type MockRoleRepo struct{ mock.Mock }
+
+func (m *MockRoleRepo) ListRoles(_ context.Context) ([]domain.Role, error) {
+	args := m.Called()
+	if r := args.Get(0); r != nil {
+		return r.([]domain.Role), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockRoleRepo) FindRole(_ context.Context, name string) (*domain.Role, error) {
+	args := m.Called(name)
+	if r := args.Get(0); r != nil {
+		return r.(*domain.Role), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockRoleRepo) CreateRole(_ context.Context, r *domain.Role) error {
+	return m.Called(r).Error(0)
+}
+
+func (m *MockRoleRepo) SetRolePermissions(_ context.Context, role string, permissions []string) error {
+	return m.Called(role, permissions).Error(0)
+}
+
+func (m *MockRoleRepo) DeleteRole(_ context.Context, name string) error {
+	return m.Called(name).Error(0)
+}
+
+func (m *MockRoleRepo) ListPermissions(_ context.Context) ([]domain.Permission, error) {
+	args := m.Called()
+	if p := args.Get(0); p != nil {
+		return p.([]domain.Permission), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockRoleRepo) AssignRole(_ context.Context, userID, role string) error {
+	return m.Called(userID, role).Error(0)
+}
+
+func (m *MockRoleRepo) UnassignRole(_ context.Context, userID, role string) error {
+	return m.Called(userID, role).Error(0)
+}
+
+func (m *MockRoleRepo) UserAccess(_ context.Context, userID string) (domain.Access, error) {
+	args := m.Called(userID)
+	return args.Get(0).(domain.Access), args.Error(1)
+}
+
+// Мок для AuditRepository
+type MockAuditRepo struct{ mock.Mock }
+
+func (m *MockAuditRepo) AppendAudit(_ context.Context, e domain.AuditEvent) error {
+	return m.Called(e).Error(0)
+}
+
+func (m *MockAuditRepo) ListAudit(_ context.Context, q domain.AuditQuery) ([]domain.AuditEvent, error) {
+	args := m.Called(q)
+	if e := args.Get(0); e != nil {
+		return e.([]domain.AuditEvent), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// Журнал аудита без хранилища: записи отбрасываются
+func noAudit() *usecase.AuditUsecase {
+	return usecase.NewAuditUsecase(nil, discardLogger())
+}
+
+// recordingAudit пишет журнал в мок, принимающий любые записи
+func recordingAudit() (*usecase.AuditUsecase, *MockAuditRepo) {
+	repo := &MockAuditRepo{}
+	repo.On("AppendAudit", mock.Anything).Return(nil)
+	return usecase.NewAuditUsecase(repo, discardLogger()), repo
+}
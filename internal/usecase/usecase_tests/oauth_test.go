@@ -0,0 +1,156 @@
+package usecase_tests
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+var gatewayClients = []config.OAuthClient{{ID: "gateway", Secret: "s3cret"}}
+
+func TestIsClient(t *testing.T) {
+	uc := usecase.NewOAuthUsecase(&MockKC{}, &MockCache{}, &MockBroker{}, gatewayClients, noAudit(), discardLogger())
+
+	assert.True(t, uc.IsClient("gateway", "s3cret"))
+	assert.False(t, uc.IsClient("gateway", "guess"))
+	// одного client_id недостаточно, чтобы получить отдельный лимит
+	assert.False(t, uc.IsClient("gateway", ""))
+	assert.False(t, uc.IsClient("random-id", ""))
+}
+
+func TestIntrospect_Active(t *testing.T) {
+	kc := &MockKC{}
+	uc := usecase.NewOAuthUsecase(kc, &MockCache{}, &MockBroker{}, gatewayClients, noAudit(), discardLogger())
+
+	want := auth_client.TokenInfo{Active: true, TokenType: auth_client.TokenTypeRefresh, Subject: "uid", JTI: "t1"}
+	kc.On("Introspect", "rt", "refresh_token").Return(want, nil)
+
+	got, err := uc.Introspect(context.Background(), "gateway", "s3cret", "rt", "refresh_token")
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestIntrospect_InactiveIsNotAnError(t *testing.T) {
+	kc := &MockKC{}
+	uc := usecase.NewOAuthUsecase(kc, &MockCache{}, &MockBroker{}, gatewayClients, noAudit(), discardLogger())
+
+	kc.On("Introspect", "junk", "").Return(auth_client.TokenInfo{}, nil)
+
+	got, err := uc.Introspect(context.Background(), "gateway", "s3cret", "junk", "")
+	assert.NoError(t, err)
+	assert.False(t, got.Active)
+}
+
+func TestIntrospect_InvalidClient(t *testing.T) {
+	cases := map[string][2]string{
+		"wrong secret":   {"gateway", "nope"},
+		"unknown client": {"other", "s3cret"},
+		"no credentials": {"", ""},
+	}
+	for name, creds := range cases {
+		t.Run(name, func(t *testing.T) {
+			kc := &MockKC{}
+			uc := usecase.NewOAuthUsecase(kc, &MockCache{}, &MockBroker{}, gatewayClients, noAudit(), discardLogger())
+
+			_, err := uc.Introspect(context.Background(), creds[0], creds[1], "at", "")
+			assert.ErrorIs(t, err, usecase.ErrInvalidClient)
+			kc.AssertNotCalled(t, "Introspect", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestVerify_ReturnsScopeAndRoles(t *testing.T) {
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	uc := usecase.NewVerifyUsecase(kc, broker, discardLogger())
+
+	kc.On("Introspect", "at", "access_token").Return(auth_client.TokenInfo{
+		Active: true, TokenType: auth_client.TokenTypeAccess, Subject: "uid",
+		Scope: []string{"users:read"}, Roles: []string{"support"},
+	}, nil)
+	broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+
+	res, err := uc.Verify(context.Background(), "at")
+	assert.NoError(t, err)
+	assert.Equal(t, &usecase.VerifyResult{UserID: "uid", Scope: []string{"users:read"}, Roles: []string{"support"}, Active: true}, res)
+}
+
+func TestAuthenticate_PublishesNothing(t *testing.T) {
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	uc := usecase.NewVerifyUsecase(kc, broker, discardLogger())
+
+	kc.On("Introspect", "at", "access_token").Return(auth_client.TokenInfo{
+		Active: true, TokenType: auth_client.TokenTypeAccess, Subject: "uid", Roles: []string{"admin"},
+	}, nil)
+
+	// каждый запрос к API не должен выглядеть как новый вход
+	res, err := uc.Authenticate(context.Background(), "at")
+	assert.NoError(t, err)
+	assert.Equal(t, "uid", res.UserID)
+	assert.Equal(t, []string{"admin"}, res.Roles)
+	broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
+
+func TestVerify_RejectsRefreshToken(t *testing.T) {
+	kc := &MockKC{}
+	uc := usecase.NewVerifyUsecase(kc, &MockBroker{}, discardLogger())
+
+	kc.On("Introspect", "rt", "access_token").Return(auth_client.TokenInfo{
+		Active: true, TokenType: auth_client.TokenTypeRefresh, Subject: "uid",
+	}, nil)
+
+	_, err := uc.Verify(context.Background(), "rt")
+	assert.ErrorIs(t, err, usecase.ErrTokenInvalid)
+}
+
+func TestRevoke_RefreshToken(t *testing.T) {
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	audit, auditRepo := recordingAudit()
+	uc := usecase.NewOAuthUsecase(kc, c, broker, gatewayClients, audit, discardLogger())
+
+	kc.On("RevokeToken", "rt", "refresh_token").Return("uid", []string{"rt", "rt0"}, nil)
+	c.On("Delete", mock.Anything).Return(nil)
+	broker.On("PublishToTopic", "TokenRevoked", mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.Revoke(context.Background(), "gateway", "s3cret", "rt", "refresh_token"))
+	c.AssertCalled(t, "Delete", "rt")
+	c.AssertCalled(t, "Delete", "rt0")
+	broker.AssertCalled(t, "PublishToTopic", "TokenRevoked", mock.Anything)
+
+	events := auditEvents(auditRepo)
+	assert.Len(t, events, 1)
+	assert.Equal(t, domain.AuditTokenRevoke, events[0].Action)
+	assert.Equal(t, "uid", events[0].UserID)
+	assert.Equal(t, "client_id=gateway", events[0].Detail)
+}
+
+func TestRevoke_UnknownTokenSucceeds(t *testing.T) {
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	uc := usecase.NewOAuthUsecase(kc, &MockCache{}, broker, gatewayClients, noAudit(), discardLogger())
+
+	kc.On("RevokeToken", "junk", "").Return("", nil, nil)
+
+	// public client: client_id without a secret
+	assert.NoError(t, uc.Revoke(context.Background(), "mobile-app", "", "junk", ""))
+	broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
+
+func TestRevoke_ConfidentialClientMustAuthenticate(t *testing.T) {
+	kc := &MockKC{}
+	uc := usecase.NewOAuthUsecase(kc, &MockCache{}, &MockBroker{}, gatewayClients, noAudit(), discardLogger())
+
+	err := uc.Revoke(context.Background(), "gateway", "", "at", "")
+	assert.ErrorIs(t, err, usecase.ErrInvalidClient)
+	kc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,245 @@
+package usecase_tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+type passwordlessFixture struct {
+	uc     *usecase.PasswordlessUsecase
+	repo   *MockUserRepo
+	mfa    *MockMFARepo
+	kc     *MockKC
+	cache  *MockCache
+	broker *MockBroker
+}
+
+func newPasswordlessFixture(t *testing.T) *passwordlessFixture {
+	f := &passwordlessFixture{
+		repo:   &MockUserRepo{},
+		mfa:    &MockMFARepo{},
+		kc:     &MockKC{},
+		cache:  &MockCache{},
+		broker: &MockBroker{},
+	}
+	login := usecase.NewLoginUsecase(f.repo, f.mfa, noPasskeys(), noLockout(), f.kc, f.cache, f.broker, true, 5*time.Minute, 5, noAudit(), discardLogger())
+	f.uc = usecase.NewPasswordlessUsecase(f.repo, login, f.cache, f.broker, 10*time.Minute, 3, discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+	f.repo.On("FindByEmail", emailVO).Return(user, nil)
+	f.repo.On("FindByID", "uid").Return(user, nil)
+	return f
+}
+
+func (f *passwordlessFixture) expectTokens() {
+	f.mfa.On("FindTOTP", "uid").Return(nil, domain.ErrMFANotEnrolled)
+	f.kc.On("ListSessions", "uid", "").Return(knownDevice(domain.ClientInfo{}), nil)
+	f.kc.On("GenerateTokens", "uid", mock.Anything).Return("tok", "ref", nil)
+	f.cache.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	f.broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+}
+
+func TestRequestEmailLogin_UnknownEmailIsSilent(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	emailVO, _ := domain.NewEmail("ghost@example.com")
+	f.repo.On("FindByEmail", emailVO).Return(nil, errors.New("no rows"))
+
+	assert.NoError(t, f.uc.RequestLogin(context.Background(), "ghost@example.com"))
+	f.broker.AssertNotCalled(t, "PublishToQueue", mock.Anything, mock.Anything)
+}
+
+func TestRequestEmailLogin_SendsLinkAndCode(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("Get", "login_code:uid").Return("", cache.ErrKeyNotFound)
+	f.cache.On("Set", prefixed("login_link:"), "uid", 10*time.Minute).Return(nil)
+	f.cache.On("Set", "login_code:uid", mock.Anything, 10*time.Minute).Return(nil)
+	f.broker.On("PublishToQueue", "email.login", mock.Anything).Return(nil)
+
+	assert.NoError(t, f.uc.RequestLogin(context.Background(), "alice@example.com"))
+	f.cache.AssertNotCalled(t, "Delete", mock.Anything)
+
+	var msg struct {
+		Token string `json:"token"`
+		Code  string `json:"code"`
+	}
+	body := f.broker.Calls[0].Arguments.Get(1).([]byte)
+	assert.NoError(t, json.Unmarshal(body, &msg))
+	assert.True(t, domain.IsTOTPCode(msg.Code), "a six digit code: %q", msg.Code)
+
+	// only hashes reach the cache, and the code entry points at the link
+	linkKey := f.cache.Calls[1].Arguments.String(0)
+	assert.Equal(t, "login_link:"+sha256Hex(msg.Token), linkKey)
+	assert.Equal(t, sha256Hex(msg.Code)+":"+sha256Hex(msg.Token), f.cache.Calls[2].Arguments.String(1))
+}
+
+func TestRequestEmailLogin_RevokesEarlierLink(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("Set", mock.Anything, mock.Anything, 10*time.Minute).Return(nil)
+	f.broker.On("PublishToQueue", "email.login", mock.Anything).Return(nil)
+	f.cache.On("Get", "login_code:uid").Return("", cache.ErrKeyNotFound).Once()
+	assert.NoError(t, f.uc.RequestLogin(context.Background(), "alice@example.com"))
+
+	var first struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(f.broker.Calls[0].Arguments.Get(1).([]byte), &first))
+	earlierLink := "login_link:" + sha256Hex(first.Token)
+
+	// второй запрос находит первый и удаляет его ссылку
+	f.cache.On("Get", "login_code:uid").Return(sha256Hex("111111")+":"+sha256Hex(first.Token), nil).Once()
+	f.cache.On("Delete", earlierLink).Return(nil)
+	assert.NoError(t, f.uc.RequestLogin(context.Background(), "alice@example.com"))
+	f.cache.AssertCalled(t, "Delete", earlierLink)
+
+	f.cache.On("GetDel", earlierLink).Return("", cache.ErrKeyNotFound)
+	_, _, err := f.uc.LoginWithLink(context.Background(), first.Token, domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidLoginCode)
+	f.kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestLoginWithLink_Success(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("GetDel", "login_link:"+sha256Hex("link-token")).Return("uid", nil)
+	f.cache.On("Delete", "login_code:uid").Return(nil)
+	f.expectTokens()
+
+	access, refresh, err := f.uc.LoginWithLink(context.Background(), "link-token", domain.ClientInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, "tok", access)
+	assert.Equal(t, "ref", refresh)
+	f.cache.AssertCalled(t, "Delete", "login_code:uid")
+}
+
+func TestLoginWithLink_DisabledAccount(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.repo.ExpectedCalls = nil
+	f.repo.On("FindByID", "uid").Return(newDisabledUser(t, "uid", "alice@example.com"), nil)
+	f.cache.On("GetDel", mock.Anything).Return("uid", nil)
+	f.cache.On("Delete", "login_code:uid").Return(nil)
+
+	_, _, err := f.uc.LoginWithLink(context.Background(), "link-token", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrAccountDisabled)
+	f.kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestLoginWithLink_UsedOrExpired(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("GetDel", mock.Anything).Return("", cache.ErrKeyNotFound)
+
+	_, _, err := f.uc.LoginWithLink(context.Background(), "link-token", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidLoginCode)
+	f.kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestLoginWithLink_MFAStillRequired(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("GetDel", mock.Anything).Return("uid", nil)
+	f.cache.On("Delete", "login_code:uid").Return(nil)
+	f.mfa.On("FindTOTP", "uid").Return(confirmedTOTP(t, "uid"), nil)
+	f.cache.On("Set", prefixed("mfa_challenge:"), "uid", 5*time.Minute).Return(nil)
+
+	_, _, err := f.uc.LoginWithLink(context.Background(), "link-token", domain.ClientInfo{})
+	var challenge *usecase.MFAChallenge
+	assert.True(t, errors.As(err, &challenge))
+	f.kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestLoginWithCode_Success(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	stored := sha256Hex("123456") + ":" + "linkhash"
+	f.cache.On("Get", "login_code:uid").Return(stored, nil)
+	f.cache.On("IncrWindow", "login_code_attempts:uid", 10*time.Minute).Return(int64(1), nil)
+	f.cache.On("GetDel", "login_code:uid").Return(stored, nil)
+	f.cache.On("Delete", mock.Anything).Return(nil)
+	f.expectTokens()
+
+	access, _, err := f.uc.LoginWithCode(context.Background(), "alice@example.com", " 123456 ", domain.ClientInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, "tok", access)
+	f.cache.AssertCalled(t, "Delete", "login_link:linkhash")
+	f.cache.AssertCalled(t, "Delete", "login_code_attempts:uid")
+}
+
+func TestLoginWithCode_WrongCodeKeepsRequest(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("Get", "login_code:uid").Return(sha256Hex("123456")+":linkhash", nil)
+	f.cache.On("IncrWindow", "login_code_attempts:uid", 10*time.Minute).Return(int64(1), nil)
+
+	_, _, err := f.uc.LoginWithCode(context.Background(), "alice@example.com", "654321", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidLoginCode)
+	f.cache.AssertNotCalled(t, "GetDel", mock.Anything)
+	f.cache.AssertNotCalled(t, "Delete", mock.Anything)
+}
+
+func TestLoginWithCode_AttemptsExhausted(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("Get", "login_code:uid").Return(sha256Hex("123456")+":linkhash", nil)
+	f.cache.On("IncrWindow", "login_code_attempts:uid", 10*time.Minute).Return(int64(4), nil)
+	f.cache.On("Delete", mock.Anything).Return(nil)
+
+	// even the right code is refused once the request is burnt
+	_, _, err := f.uc.LoginWithCode(context.Background(), "alice@example.com", "123456", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidLoginCode)
+	f.cache.AssertCalled(t, "Delete", "login_code:uid")
+	f.cache.AssertCalled(t, "Delete", "login_link:linkhash")
+	f.cache.AssertNotCalled(t, "Delete", "login_code_attempts:uid")
+	f.kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestLoginWithCode_NewRequestKeepsBudget(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("Set", mock.Anything, mock.Anything, 10*time.Minute).Return(nil)
+	f.broker.On("PublishToQueue", "email.login", mock.Anything).Return(nil)
+	f.cache.On("Delete", mock.Anything).Return(nil)
+
+	// три неверных попытки, затем новый запрос кода
+	f.cache.On("Get", "login_code:uid").Return(sha256Hex("111111")+":linkhash", nil).Times(4)
+	f.cache.On("IncrWindow", "login_code_attempts:uid", 10*time.Minute).Return(int64(1), nil).Once()
+	f.cache.On("IncrWindow", "login_code_attempts:uid", 10*time.Minute).Return(int64(2), nil).Once()
+	f.cache.On("IncrWindow", "login_code_attempts:uid", 10*time.Minute).Return(int64(3), nil).Once()
+	for _, guess := range []string{"000001", "000002", "000003"} {
+		_, _, err := f.uc.LoginWithCode(context.Background(), "alice@example.com", guess, domain.ClientInfo{})
+		assert.ErrorIs(t, err, usecase.ErrInvalidLoginCode)
+	}
+	assert.NoError(t, f.uc.RequestLogin(context.Background(), "alice@example.com"))
+	f.cache.AssertNotCalled(t, "Delete", "login_code_attempts:uid")
+
+	var msg struct {
+		Code string `json:"code"`
+	}
+	assert.NoError(t, json.Unmarshal(f.broker.Calls[0].Arguments.Get(1).([]byte), &msg))
+
+	// счётчик не сброшен, поэтому даже верный новый код отклоняется
+	f.cache.On("Get", "login_code:uid").Return(sha256Hex(msg.Code)+":newlink", nil).Once()
+	f.cache.On("IncrWindow", "login_code_attempts:uid", 10*time.Minute).Return(int64(4), nil).Once()
+	_, _, err := f.uc.LoginWithCode(context.Background(), "alice@example.com", msg.Code, domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidLoginCode)
+	f.kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestLoginWithCode_NoPendingRequest(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	f.cache.On("Get", "login_code:uid").Return("", cache.ErrKeyNotFound)
+
+	_, _, err := f.uc.LoginWithCode(context.Background(), "alice@example.com", "123456", domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidLoginCode)
+	f.cache.AssertNotCalled(t, "IncrWindow", mock.Anything, mock.Anything)
+}
@@ -1,50 +1,75 @@
 package usecase_tests
 
 import (
+	"context"
 	"errors"
+	"github.com/stretchr/testify/mock"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
 	"github.com/ParkieV/auth-service/internal/usecase"
 )
 
 func TestRefresh_Success(t *testing.T) {
 	kc := &MockKC{}
-	cache := &MockCache{}
+	c := &MockCache{}
+	broker := &MockBroker{}
 	ttl := 72 * time.Hour
-	uc := usecase.NewRefreshUsecase(kc, cache, ttl)
+	uc := usecase.NewRefreshUsecase(kc, broker, c, ttl, noAudit(), discardLogger())
 
-	cache.On("Get", "old-refresh").Return("user-123", nil)
-	kc.On("RefreshToken", "old-refresh").Return("new-access", "new-refresh", nil)
-	cache.On("Set", "new-refresh", "user-123", ttl).Return(nil)
-	cache.On("Delete", "old-refresh").Return(nil)
+	kc.On("RotateRefresh", "old-refresh", mock.Anything).
+		Return(auth_client.Rotation{UserID: "user-123", FamilyID: "fam", AccessToken: "new-access"}, nil)
+	c.On("SwapRefresh", "user-123", "old-refresh", mock.Anything, ttl).Return(true, nil)
+	broker.On("PublishToTopic", "UserTokensRefreshed", mock.Anything).Return(nil)
 
-	access, refresh, err := uc.Refresh("old-refresh")
+	access, refresh, err := uc.Refresh(context.Background(), "old-refresh")
 	assert.NoError(t, err)
 	assert.Equal(t, "new-access", access)
-	assert.Equal(t, "new-refresh", refresh)
+	assert.NotEmpty(t, refresh)
+	assert.NotEqual(t, "old-refresh", refresh)
+	kc.AssertCalled(t, "RotateRefresh", "old-refresh", refresh)
 }
 
 func TestRefresh_InvalidToken(t *testing.T) {
-	cache := &MockCache{}
-	uc := usecase.NewRefreshUsecase(&MockKC{}, cache, time.Hour)
+	kc := &MockKC{}
+	uc := usecase.NewRefreshUsecase(kc, &MockBroker{}, &MockCache{}, time.Hour, noAudit(), discardLogger())
 
-	cache.On("Get", "bad-token").Return("", errors.New("not found"))
+	kc.On("RotateRefresh", "bad-token", mock.Anything).
+		Return(auth_client.Rotation{}, auth_client.ErrRefreshTokenNotFound)
 
-	_, _, err := uc.Refresh("bad-token")
+	_, _, err := uc.Refresh(context.Background(), "bad-token")
 	assert.ErrorIs(t, err, usecase.ErrInvalidRefreshToken)
 }
 
 func TestRefresh_KeycloakError(t *testing.T) {
 	kc := &MockKC{}
-	cache := &MockCache{}
-	uc := usecase.NewRefreshUsecase(kc, cache, time.Hour)
+	uc := usecase.NewRefreshUsecase(kc, &MockBroker{}, &MockCache{}, time.Hour, noAudit(), discardLogger())
 
-	cache.On("Get", "refresh").Return("user-1", nil)
-	kc.On("RefreshToken", "refresh").Return("", "", errors.New("kc down"))
+	kc.On("RotateRefresh", "refresh", mock.Anything).
+		Return(auth_client.Rotation{}, errors.New("kc down"))
 
-	_, _, err := uc.Refresh("refresh")
+	_, _, err := uc.Refresh(context.Background(), "refresh")
 	assert.ErrorIs(t, err, usecase.ErrRefreshFailed)
 }
+
+func TestRefresh_ReuseRevokesFamily(t *testing.T) {
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	uc := usecase.NewRefreshUsecase(kc, broker, c, time.Hour, noAudit(), discardLogger())
+
+	kc.On("RotateRefresh", "stolen", mock.Anything).
+		Return(auth_client.Rotation{UserID: "user-1", FamilyID: "fam-1"}, auth_client.ErrRefreshTokenReused)
+	kc.On("RevokeFamily", "fam-1").Return([]string{"stolen", "live"}, nil)
+	c.On("Delete", "stolen").Return(nil)
+	c.On("Delete", "live").Return(nil)
+	broker.On("PublishToTopic", "RefreshTokenReuseDetected", mock.Anything).Return(nil)
+
+	_, _, err := uc.Refresh(context.Background(), "stolen")
+	assert.ErrorIs(t, err, usecase.ErrInvalidRefreshToken)
+	c.AssertCalled(t, "Delete", "live")
+	broker.AssertCalled(t, "PublishToTopic", "RefreshTokenReuseDetected", mock.Anything)
+}
@@ -1,6 +1,8 @@
 package usecase_tests
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"github.com/stretchr/testify/mock"
 	"testing"
@@ -9,50 +11,70 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
 	"github.com/ParkieV/auth-service/internal/usecase"
 )
 
 func TestRegister_Success(t *testing.T) {
 	repo := &MockUserRepo{}
-	broker := &MockBroker{}
-	uc := usecase.NewRegisterUsecase(repo, broker, 24*time.Hour)
+	uc := usecase.NewRegisterUsecase(repo, &MockKC{}, 24*time.Hour, noAudit(), discardLogger())
 
-	repo.On("Save", mock.AnythingOfType("*domain.User")).Return(nil)
-	broker.On("PublishToQueue", "email.confirm", mock.Anything).Return(nil)
+	repo.On("Save", mock.AnythingOfType("*domain.User"), mock.Anything).Return(nil)
 
-	id, err := uc.Register("alice@example.com", "hashpwd")
+	ctx := usecase.WithClient(context.Background(), domain.ClientInfo{Language: "ru-RU,ru;q=0.9"})
+	id, err := uc.Register(ctx, "alice@example.com", "hashpwd1")
 	assert.NoError(t, err)
 	assert.NotEmpty(t, id)
 
-	repo.AssertCalled(t, "Save", mock.Anything)
-	broker.AssertCalled(t, "PublishToQueue", "email.confirm", mock.Anything)
+	// письмо и событие уходят через outbox вместе с пользователем
+	events := outboxed(repo, "Save")
+	assert.Len(t, events, 2)
+	assert.Equal(t, db.OutboxQueue, events[0].Kind)
+	assert.Equal(t, "email.confirm", events[0].Destination)
+	assert.Equal(t, db.OutboxTopic, events[1].Kind)
+	assert.Equal(t, "UserRegistered", events[1].Destination)
+	for _, e := range events {
+		assert.Equal(t, id, e.AggregateID)
+	}
+
+	user := repo.Calls[0].Arguments.Get(0).(*domain.User)
+	var msg struct {
+		UserID   string `json:"user_id"`
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Language string `json:"language"`
+	}
+	assert.NoError(t, json.Unmarshal(events[0].Payload, &msg))
+	assert.Equal(t, id, msg.UserID)
+	assert.Equal(t, "alice@example.com", msg.Email)
+	assert.Equal(t, user.ConfirmationID(), msg.Code)
+	// письмо локализуется по языку запроса
+	assert.Equal(t, "ru-RU,ru;q=0.9", msg.Language)
 }
 
 func TestRegister_InvalidEmail(t *testing.T) {
-	uc := usecase.NewRegisterUsecase(nil, nil, time.Hour)
-	_, err := uc.Register("not-an-email", "pwd")
+	uc := usecase.NewRegisterUsecase(nil, nil, time.Hour, noAudit(), discardLogger())
+	_, err := uc.Register(context.Background(), "not-an-email", "pwd")
 	assert.ErrorIs(t, err, domain.ErrInvalidEmail)
 }
 
 func TestRegister_RepoError(t *testing.T) {
 	repo := &MockUserRepo{}
-	broker := &MockBroker{}
-	uc := usecase.NewRegisterUsecase(repo, broker, time.Hour)
+	uc := usecase.NewRegisterUsecase(repo, &MockKC{}, time.Hour, noAudit(), discardLogger())
 
-	repo.On("Save", mock.Anything).Return(errors.New("db failure"))
+	repo.On("Save", mock.Anything, mock.Anything).Return(errors.New("db failure"))
 
-	_, err := uc.Register("bob@example.com", "pwd")
+	_, err := uc.Register(context.Background(), "bob@example.com", "password1")
 	assert.EqualError(t, err, "db failure")
 }
 
-func TestRegister_BrokerError(t *testing.T) {
+func TestRegister_DuplicateEmail(t *testing.T) {
 	repo := &MockUserRepo{}
-	broker := &MockBroker{}
-	uc := usecase.NewRegisterUsecase(repo, broker, time.Hour)
+	uc := usecase.NewRegisterUsecase(repo, &MockKC{}, time.Hour, noAudit(), discardLogger())
 
-	repo.On("Save", mock.Anything).Return(nil)
-	broker.On("PublishToQueue", "email.confirm", mock.Anything).Return(errors.New("mq down"))
+	// транзакция откатывается целиком, outbox-сообщения не сохраняются
+	repo.On("Save", mock.Anything, mock.Anything).Return(db.ErrDuplicateKey)
 
-	_, err := uc.Register("eve@example.com", "pwd")
-	assert.EqualError(t, err, "mq down")
+	_, err := uc.Register(context.Background(), "eve@example.com", "password1")
+	assert.ErrorIs(t, err, usecase.ErrEmailExists)
 }
@@ -0,0 +1,85 @@
+package usecase_tests
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func TestResend_RotatesCode(t *testing.T) {
+	repo := &MockUserRepo{}
+	cache := &MockCache{}
+	uc := usecase.NewResendConfirmationUsecase(repo, cache, 24*time.Hour, 3, time.Hour, discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", false)
+	oldExpiry := user.ExpiresAt()
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+	cache.On("Incr", "confirm_resend:alice@example.com", time.Hour).Return(int64(1), nil)
+	repo.On("UpdateConfirmation", "uid", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.Resend(context.Background(), "alice@example.com"))
+	assert.NotEqual(t, "code", user.ConfirmationID())
+	assert.True(t, user.ExpiresAt().After(oldExpiry))
+	repo.AssertCalled(t, "UpdateConfirmation", "uid", user.ConfirmationID(), user.ExpiresAt(), mock.Anything)
+
+	events := outboxed(repo, "UpdateConfirmation")
+	assert.Len(t, events, 1)
+	assert.Equal(t, "email.confirm", events[0].Destination)
+	assert.Contains(t, string(events[0].Payload), user.ConfirmationID())
+}
+
+func TestResend_Throttled(t *testing.T) {
+	repo := &MockUserRepo{}
+	cache := &MockCache{}
+	uc := usecase.NewResendConfirmationUsecase(repo, cache, time.Hour, 3, time.Hour, discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", false)
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+	cache.On("Incr", "confirm_resend:alice@example.com", time.Hour).Return(int64(4), nil)
+
+	err := uc.Resend(context.Background(), "alice@example.com")
+	assert.ErrorIs(t, err, usecase.ErrTooManyRequests)
+	assert.Equal(t, "code", user.ConfirmationID())
+	// лимит проверяется до поиска пользователя
+	repo.AssertNotCalled(t, "FindByEmail", mock.Anything)
+}
+
+func TestResend_AlreadyConfirmed(t *testing.T) {
+	repo := &MockUserRepo{}
+	cache := &MockCache{}
+	uc := usecase.NewResendConfirmationUsecase(repo, cache, time.Hour, 3, time.Hour, discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+	cache.On("Incr", "confirm_resend:alice@example.com", time.Hour).Return(int64(1), nil)
+
+	// ответ не должен выдавать, что адрес уже подтверждён
+	assert.NoError(t, uc.Resend(context.Background(), "alice@example.com"))
+	repo.AssertNotCalled(t, "UpdateConfirmation", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestResend_UnknownEmail(t *testing.T) {
+	repo := &MockUserRepo{}
+	cache := &MockCache{}
+	uc := usecase.NewResendConfirmationUsecase(repo, cache, time.Hour, 3, time.Hour, discardLogger())
+
+	emailVO, _ := domain.NewEmail("ghost@example.com")
+	repo.On("FindByEmail", emailVO).Return(nil, domain.ErrUserNotFound)
+	cache.On("Incr", "confirm_resend:ghost@example.com", time.Hour).Return(int64(1), nil)
+
+	// как и для сброса пароля, неизвестный адрес не отличается от известного
+	assert.NoError(t, uc.Resend(context.Background(), "ghost@example.com"))
+	repo.AssertNotCalled(t, "UpdateConfirmation", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
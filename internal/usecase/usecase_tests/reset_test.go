@@ -0,0 +1,109 @@
+package usecase_tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func TestRequestReset_UnknownEmailIsSilent(t *testing.T) {
+	repo := &MockUserRepo{}
+	broker := &MockBroker{}
+	uc := usecase.NewPasswordResetUsecase(repo, &MockKC{}, broker, &MockCache{}, time.Hour, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("ghost@example.com")
+	repo.On("FindByEmail", emailVO).Return(nil, errors.New("no rows"))
+
+	assert.NoError(t, uc.RequestReset(context.Background(), "ghost@example.com"))
+	broker.AssertNotCalled(t, "PublishToQueue", mock.Anything, mock.Anything)
+}
+
+func TestRequestReset_StoresHashedToken(t *testing.T) {
+	repo := &MockUserRepo{}
+	broker := &MockBroker{}
+	c := &MockCache{}
+	uc := usecase.NewPasswordResetUsecase(repo, &MockKC{}, broker, c, time.Hour, noAudit(), discardLogger())
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	user := newTestUser(t, "uid", "alice@example.com", "password1", true)
+
+	repo.On("FindByEmail", emailVO).Return(user, nil)
+	c.On("Set", mock.Anything, "uid", time.Hour).Return(nil)
+	broker.On("PublishToQueue", "email.password_reset", mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.RequestReset(context.Background(), "alice@example.com"))
+
+	var msg struct {
+		Token string `json:"token"`
+	}
+	body := broker.Calls[0].Arguments.Get(1).([]byte)
+	assert.NoError(t, json.Unmarshal(body, &msg))
+	assert.NotEmpty(t, msg.Token)
+
+	key := c.Calls[0].Arguments.String(0)
+	assert.NotContains(t, key, msg.Token)
+}
+
+func TestResetPassword_Success(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	c := &MockCache{}
+	uc := usecase.NewPasswordResetUsecase(repo, kc, broker, c, time.Hour, noAudit(), discardLogger())
+
+	c.On("GetDel", mock.Anything).Return("uid", nil)
+	repo.On("UpdatePasswordHash", "uid", mock.Anything).Return(nil)
+	kc.On("RevokeAll", "uid").Return(nil)
+	c.On("DeleteUserRefresh", "uid").Return(2, nil)
+	broker.On("PublishToTopic", "UserPasswordReset", mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.ResetPassword(context.Background(), "token", "new-password"))
+	kc.AssertCalled(t, "RevokeAll", "uid")
+	c.AssertCalled(t, "DeleteUserRefresh", "uid")
+}
+
+func TestResetPassword_RevokeFails(t *testing.T) {
+	repo := &MockUserRepo{}
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	c := &MockCache{}
+	uc := usecase.NewPasswordResetUsecase(repo, kc, broker, c, time.Hour, noAudit(), discardLogger())
+
+	c.On("GetDel", mock.Anything).Return("uid", nil)
+	repo.On("UpdatePasswordHash", "uid", mock.Anything).Return(nil)
+	kc.On("RevokeAll", "uid").Return(errors.New("db down"))
+
+	// украденный refresh-токен остался бы жив, поэтому сброс не считается успешным
+	assert.Error(t, uc.ResetPassword(context.Background(), "token", "new-password"))
+	broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
+
+func TestResetPassword_InvalidToken(t *testing.T) {
+	repo := &MockUserRepo{}
+	c := &MockCache{}
+	uc := usecase.NewPasswordResetUsecase(repo, &MockKC{}, &MockBroker{}, c, time.Hour, noAudit(), discardLogger())
+
+	c.On("GetDel", mock.Anything).Return("", cache.ErrKeyNotFound)
+
+	err := uc.ResetPassword(context.Background(), "used-token", "new-password")
+	assert.ErrorIs(t, err, usecase.ErrInvalidResetToken)
+	repo.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything)
+}
+
+func TestResetPassword_WeakPassword(t *testing.T) {
+	c := &MockCache{}
+	uc := usecase.NewPasswordResetUsecase(&MockUserRepo{}, &MockKC{}, &MockBroker{}, c, time.Hour, noAudit(), discardLogger())
+
+	err := uc.ResetPassword(context.Background(), "token", "short")
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+	c.AssertNotCalled(t, "GetDel", mock.Anything)
+}
@@ -0,0 +1,50 @@
+package usecase_tests
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+func TestSessions_List(t *testing.T) {
+	kc := &MockKC{}
+	uc := usecase.NewSessionsUsecase(kc, &MockCache{}, &MockBroker{}, noAudit(), discardLogger())
+
+	want := []domain.Session{{ID: "s1", UserID: "uid", Current: true}, {ID: "s2", UserID: "uid"}}
+	kc.On("ListSessions", "uid", "at").Return(want, nil)
+
+	got, err := uc.List(context.Background(), "uid", "at")
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestSessions_Revoke(t *testing.T) {
+	kc := &MockKC{}
+	c := &MockCache{}
+	broker := &MockBroker{}
+	uc := usecase.NewSessionsUsecase(kc, c, broker, noAudit(), discardLogger())
+
+	kc.On("RevokeSession", "uid", "s1").Return([]string{"rt1"}, nil)
+	c.On("Delete", "rt1").Return(nil)
+	broker.On("PublishToTopic", "SessionRevoked", mock.Anything).Return(nil)
+
+	assert.NoError(t, uc.Revoke(context.Background(), "uid", "s1"))
+	c.AssertCalled(t, "Delete", "rt1")
+}
+
+func TestSessions_RevokeForeignSession(t *testing.T) {
+	kc := &MockKC{}
+	broker := &MockBroker{}
+	uc := usecase.NewSessionsUsecase(kc, &MockCache{}, broker, noAudit(), discardLogger())
+
+	kc.On("RevokeSession", "uid", "other").Return(nil, domain.ErrSessionNotFound)
+
+	err := uc.Revoke(context.Background(), "uid", "other")
+	assert.ErrorIs(t, err, domain.ErrSessionNotFound)
+	broker.AssertNotCalled(t, "PublishToTopic", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,270 @@
+package usecase_tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/descope/virtualwebauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/usecase"
+)
+
+var testRP = virtualwebauthn.RelyingParty{ID: "localhost", Name: "ParkieV", Origin: "http://localhost:3000"}
+
+type webauthnFixture struct {
+	uc     *usecase.WebAuthnUsecase
+	login  *usecase.LoginUsecase
+	users  *MockUserRepo
+	mfa    *MockMFARepo
+	creds  *MockWebAuthnRepo
+	kc     *MockKC
+	cache  *MockCache
+	broker *MockBroker
+	user   *domain.User
+	// stored holds what the usecase wrote to the cache, keyed by prefix
+	stored map[string]string
+}
+
+func newWebAuthnFixture(t *testing.T) *webauthnFixture {
+	t.Helper()
+	f := &webauthnFixture{
+		users:  &MockUserRepo{},
+		mfa:    &MockMFARepo{},
+		creds:  &MockWebAuthnRepo{},
+		kc:     &MockKC{},
+		cache:  &MockCache{},
+		broker: &MockBroker{},
+		user:   newTestUser(t, "uid", "alice@example.com", "password1", true),
+		stored: map[string]string{},
+	}
+	f.login = usecase.NewLoginUsecase(f.users, f.mfa, f.creds, noLockout(), f.kc, f.cache, f.broker, true, 5*time.Minute, 3, noAudit(), discardLogger())
+
+	var err error
+	f.uc, err = usecase.NewWebAuthnUsecase(f.users, f.creds, f.login, f.cache, f.broker, config.WebAuthnConfig{
+		RPID:          testRP.ID,
+		RPDisplayName: testRP.Name,
+		RPOrigins:     []string{testRP.Origin},
+		Timeout:       5 * time.Minute,
+	}, noAudit(), discardLogger())
+	require.NoError(t, err)
+
+	f.users.On("FindByID", "uid").Return(f.user, nil)
+	for _, prefix := range []string{"webauthn_register:", "webauthn_login:", "webauthn_mfa:"} {
+		f.cache.On("Set", prefixed(prefix), mock.Anything, 5*time.Minute).Return(nil).
+			Run(func(args mock.Arguments) { f.stored[prefix] = args.String(1) })
+	}
+	return f
+}
+
+// take answers the next GetDel for prefix with whatever was stored there.
+func (f *webauthnFixture) take(prefix string) {
+	f.cache.On("GetDel", prefixed(prefix)).Return(f.stored[prefix], nil).Once()
+}
+
+func (f *webauthnFixture) expectTokens() {
+	f.kc.On("ListSessions", "uid", "").Return(knownDevice(domain.ClientInfo{}), nil)
+	f.kc.On("GenerateTokens", "uid", mock.Anything).Return("tok", "ref", nil)
+	f.cache.On("SetRefresh", "uid", "ref", mock.Anything).Return(nil)
+	f.broker.On("PublishToTopic", "UserLoggedIn", mock.Anything).Return(nil)
+}
+
+// register runs a full registration ceremony with a software authenticator
+// and returns the credential as it would have been stored.
+func (f *webauthnFixture) register(t *testing.T, auth *virtualwebauthn.Authenticator) (virtualwebauthn.Credential, *domain.WebAuthnCredential) {
+	t.Helper()
+	f.creds.On("ListCredentials", "uid").Return([]domain.WebAuthnCredential(nil), nil).Twice()
+
+	options, err := f.uc.BeginRegistration(context.Background(), "uid")
+	require.NoError(t, err)
+	parsed, err := virtualwebauthn.ParseAttestationOptions(string(options))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("uid"), []byte(parsed.UserID))
+
+	cred := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+	response := virtualwebauthn.CreateAttestationResponse(testRP, *auth, cred, *parsed)
+	auth.AddCredential(cred)
+
+	var saved *domain.WebAuthnCredential
+	f.creds.On("SaveCredential", mock.Anything).Return(nil).Once().
+		Run(func(args mock.Arguments) { saved = args.Get(0).(*domain.WebAuthnCredential) })
+	f.broker.On("PublishToTopic", "WebAuthnCredentialAdded", mock.Anything).Return(nil).Once()
+	f.take("webauthn_register:")
+
+	stored, err := f.uc.FinishRegistration(context.Background(), "uid", " YubiKey ", []byte(response))
+	require.NoError(t, err)
+	assert.Same(t, saved, stored)
+	assert.Equal(t, cred.ID, stored.ID)
+	assert.Equal(t, "YubiKey", stored.Name)
+	assert.Equal(t, auth.Aaguid[:], stored.AAGUID)
+	return cred, stored
+}
+
+func TestWebAuthn_RegisterAndPasskeyLogin(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	auth := virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{UserHandle: []byte("uid")})
+	cred, stored := f.register(t, &auth)
+
+	session, options, err := f.uc.BeginLogin(context.Background())
+	require.NoError(t, err)
+	assert.NotEmpty(t, session)
+	parsed, err := virtualwebauthn.ParseAssertionOptions(string(options))
+	require.NoError(t, err)
+	assert.Empty(t, parsed.AllowCredentials, "passkey login lets the authenticator pick the account")
+
+	cred.Counter = 1
+	response := virtualwebauthn.CreateAssertionResponse(testRP, auth, cred, *parsed)
+
+	f.take("webauthn_login:")
+	f.creds.On("FindCredential", cred.ID).Return(stored, nil)
+	f.creds.On("ListCredentials", "uid").Return([]domain.WebAuthnCredential{*stored}, nil)
+	f.creds.On("TouchCredential", cred.ID, uint32(1), false).Return(nil)
+	f.expectTokens()
+
+	access, refresh, err := f.uc.FinishLogin(context.Background(), session, []byte(response), domain.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "tok", access)
+	assert.Equal(t, "ref", refresh)
+	f.creds.AssertExpectations(t)
+}
+
+func TestWebAuthn_PasskeyLoginRequiresUserVerification(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	auth := virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{UserHandle: []byte("uid")})
+	cred, stored := f.register(t, &auth)
+
+	session, options, err := f.uc.BeginLogin(context.Background())
+	require.NoError(t, err)
+	parsed, err := virtualwebauthn.ParseAssertionOptions(string(options))
+	require.NoError(t, err)
+
+	auth.Options.UserNotVerified = true
+	response := virtualwebauthn.CreateAssertionResponse(testRP, auth, cred, *parsed)
+
+	f.take("webauthn_login:")
+	f.creds.On("FindCredential", cred.ID).Return(stored, nil)
+	f.creds.On("ListCredentials", "uid").Return([]domain.WebAuthnCredential{*stored}, nil)
+
+	_, _, err = f.uc.FinishLogin(context.Background(), session, []byte(response), domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrWebAuthnFailed)
+	f.kc.AssertNotCalled(t, "GenerateTokens", mock.Anything, mock.Anything)
+}
+
+func TestWebAuthn_ClonedAuthenticatorRejected(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	auth := virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{UserHandle: []byte("uid")})
+	cred, stored := f.register(t, &auth)
+	stored.SignCount = 10
+
+	session, options, err := f.uc.BeginLogin(context.Background())
+	require.NoError(t, err)
+	parsed, err := virtualwebauthn.ParseAssertionOptions(string(options))
+	require.NoError(t, err)
+
+	cred.Counter = 3
+	response := virtualwebauthn.CreateAssertionResponse(testRP, auth, cred, *parsed)
+
+	f.take("webauthn_login:")
+	f.creds.On("FindCredential", cred.ID).Return(stored, nil)
+	f.creds.On("ListCredentials", "uid").Return([]domain.WebAuthnCredential{*stored}, nil)
+
+	_, _, err = f.uc.FinishLogin(context.Background(), session, []byte(response), domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrWebAuthnFailed)
+	f.creds.AssertNotCalled(t, "TouchCredential", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebAuthn_LoginSessionIsSingleUse(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	f.cache.On("GetDel", prefixed("webauthn_login:")).Return("", cache.ErrKeyNotFound)
+
+	_, _, err := f.uc.FinishLogin(context.Background(), "used", []byte(`{}`), domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrInvalidWebAuthnSession)
+}
+
+func TestWebAuthn_SecondFactor(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	auth := virtualwebauthn.NewAuthenticator()
+	cred, stored := f.register(t, &auth)
+
+	emailVO, _ := domain.NewEmail("alice@example.com")
+	f.users.On("FindByEmail", emailVO).Return(f.user, nil)
+	f.mfa.On("FindTOTP", "uid").Return(nil, domain.ErrMFANotEnrolled)
+	f.creds.On("CountCredentials", "uid").Return(1, nil)
+	f.cache.On("Set", prefixed("mfa_challenge:"), "uid", 5*time.Minute).Return(nil)
+
+	_, _, err := f.login.Login(context.Background(), "alice@example.com", "password1", domain.ClientInfo{})
+	var challenge *usecase.MFAChallenge
+	require.True(t, errors.As(err, &challenge))
+	assert.Equal(t, []string{usecase.MFAMethodWebAuthn}, challenge.Methods)
+
+	f.cache.On("Get", prefixed("mfa_challenge:")).Return("uid", nil)
+	f.creds.On("ListCredentials", "uid").Return([]domain.WebAuthnCredential{*stored}, nil)
+
+	options, err := f.uc.BeginMFA(context.Background(), challenge.Token)
+	require.NoError(t, err)
+	parsed, err := virtualwebauthn.ParseAssertionOptions(string(options))
+	require.NoError(t, err)
+	assert.Len(t, parsed.AllowCredentials, 1)
+
+	response := virtualwebauthn.CreateAssertionResponse(testRP, auth, cred, *parsed)
+
+	f.cache.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(1), nil)
+	f.take("webauthn_mfa:")
+	f.creds.On("TouchCredential", cred.ID, uint32(0), false).Return(nil)
+	f.cache.On("GetDel", prefixed("mfa_challenge:")).Return("uid", nil)
+	f.expectTokens()
+
+	access, _, err := f.uc.VerifyMFA(context.Background(), challenge.Token, []byte(response), domain.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "tok", access)
+}
+
+func TestWebAuthn_SecondFactorWrongCredential(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	auth := virtualwebauthn.NewAuthenticator()
+	_, stored := f.register(t, &auth)
+
+	f.cache.On("Get", prefixed("mfa_challenge:")).Return("uid", nil)
+	f.creds.On("ListCredentials", "uid").Return([]domain.WebAuthnCredential{*stored}, nil)
+	options, err := f.uc.BeginMFA(context.Background(), "mfa-token")
+	require.NoError(t, err)
+	parsed, err := virtualwebauthn.ParseAssertionOptions(string(options))
+	require.NoError(t, err)
+
+	// an authenticator holding some other key answers the challenge
+	other := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+	response := virtualwebauthn.CreateAssertionResponse(testRP, auth, other, *parsed)
+
+	f.cache.On("Incr", prefixed("mfa_attempts:"), 5*time.Minute).Return(int64(1), nil)
+	f.take("webauthn_mfa:")
+
+	_, _, err = f.uc.VerifyMFA(context.Background(), "mfa-token", []byte(response), domain.ClientInfo{})
+	assert.ErrorIs(t, err, usecase.ErrWebAuthnFailed)
+	f.cache.AssertNotCalled(t, "GetDel", prefixed("mfa_challenge:"))
+}
+
+func TestWebAuthn_DeleteCredential(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	id := []byte{1, 2, 3}
+	cred := &domain.WebAuthnCredential{ID: id}
+
+	f.creds.On("DeleteCredential", "uid", id).Return(nil)
+	f.broker.On("PublishToTopic", "WebAuthnCredentialRemoved", mock.MatchedBy(func(body []byte) bool {
+		var msg struct {
+			CredentialID string `json:"credential_id"`
+		}
+		return json.Unmarshal(body, &msg) == nil && msg.CredentialID == cred.EncodedID()
+	})).Return(nil)
+
+	assert.NoError(t, f.uc.DeleteCredential(context.Background(), "uid", cred.EncodedID()))
+	assert.ErrorIs(t, f.uc.DeleteCredential(context.Background(), "uid", "not base64!"), domain.ErrCredentialNotFound)
+	f.broker.AssertExpectations(t)
+}
@@ -26,27 +26,22 @@ func NewVerifyUsecase(ac auth_client.AuthClient, broker broker.MessageBroker, lo
 type VerifyResult struct {
 	UserID string
 	Scope  []string
+	Roles  []string
 	Active bool
 }
 
+// Verify checks token for a resource server and publishes UserLoggedIn.
 func (uc *VerifyUsecase) Verify(ctx context.Context, token string) (*VerifyResult, error) {
-	active, uid, err := uc.ac.VerifyAccess(ctx, token)
+	res, err := uc.Authenticate(ctx, token)
 	if err != nil {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		uc.log.Error("verify access failed", "err", err)
 		return nil, err
 	}
-	if !active {
-		return nil, ErrTokenInvalid
-	}
 
 	msg := struct {
 		UserID string `json:"user_id"`
 		Active bool   `json:"active"`
 	}{
-		UserID: uid,
+		UserID: res.UserID,
 		Active: true,
 	}
 
@@ -62,8 +57,29 @@ func (uc *VerifyUsecase) Verify(ctx context.Context, token string) (*VerifyResul
 		uc.log.Error("publish confirm email failed", "err", err)
 	}
 
+	return res, nil
+}
+
+// Authenticate checks the bearer token of a request to this service. Unlike
+// Verify it publishes nothing, as it runs on every authenticated call.
+func (uc *VerifyUsecase) Authenticate(ctx context.Context, token string) (*VerifyResult, error) {
+	info, err := uc.ac.Introspect(ctx, token, auth_client.TokenTypeAccess)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("verify access failed", "err", err)
+		return nil, err
+	}
+	// a live refresh token must not pass as a bearer token
+	if !info.Active || info.TokenType != auth_client.TokenTypeAccess {
+		return nil, ErrTokenInvalid
+	}
+
 	return &VerifyResult{
-		UserID: uid,
+		UserID: info.Subject,
+		Scope:  info.Scope,
+		Roles:  info.Roles,
 		Active: true,
 	}, nil
 }
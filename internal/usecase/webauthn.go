@@ -0,0 +1,449 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/infrastructure/broker"
+	"github.com/ParkieV/auth-service/internal/infrastructure/cache"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/ParkieV/auth-service/internal/domain"
+)
+
+const MFAMethodWebAuthn = "webauthn"
+
+var (
+	ErrInvalidWebAuthnSession = errors.New("invalid or expired webauthn session")
+	ErrWebAuthnFailed         = errors.New("webauthn verification failed")
+)
+
+const (
+	webauthnRegisterPrefix = "webauthn_register:"
+	webauthnLoginPrefix    = "webauthn_login:"
+	webauthnMFAPrefix      = "webauthn_mfa:"
+)
+
+// WebAuthnUsecase runs the relying party side of the WebAuthn ceremonies.
+// Options handed to the browser and the responses coming back are kept as
+// raw JSON so the transports never depend on the protocol types.
+type WebAuthnUsecase struct {
+	users  db.UserRepository
+	creds  db.WebAuthnRepository
+	login  *LoginUsecase
+	wa     *webauthn.WebAuthn
+	cache  cache.Cache
+	broker broker.MessageBroker
+	ttl    time.Duration
+	audit  *AuditUsecase
+	log    *slog.Logger
+}
+
+func NewWebAuthnUsecase(users db.UserRepository, creds db.WebAuthnRepository, login *LoginUsecase, cache cache.Cache, broker broker.MessageBroker, cfg config.WebAuthnConfig, audit *AuditUsecase, log *slog.Logger) (*WebAuthnUsecase, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.Timeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.Timeout},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnUsecase{users: users, creds: creds, login: login, wa: wa, cache: cache, broker: broker, ttl: cfg.Timeout, audit: audit, log: log}, nil
+}
+
+// BeginRegistration returns the PublicKeyCredentialCreationOptions for
+// navigator.credentials.create. Credentials the user already has are
+// excluded so the same authenticator is not registered twice.
+func (uc *WebAuthnUsecase) BeginRegistration(ctx context.Context, userID string) (json.RawMessage, error) {
+	user, err := uc.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := uc.wa.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		uc.log.Error("begin webauthn registration failed", "user_id", userID, "err", err)
+		return nil, err
+	}
+	if err := uc.saveSession(ctx, webauthnRegisterPrefix+userID, session); err != nil {
+		return nil, err
+	}
+	return json.Marshal(creation)
+}
+
+// FinishRegistration verifies the attestation produced for the options of
+// the last BeginRegistration call and stores the new credential.
+func (uc *WebAuthnUsecase) FinishRegistration(ctx context.Context, userID, name string, response []byte) (*domain.WebAuthnCredential, error) {
+	session, err := uc.takeSession(ctx, webauthnRegisterPrefix+userID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, uc.failed("parse attestation", userID, err)
+	}
+	user, err := uc.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := uc.wa.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, uc.failed("verify attestation", userID, err)
+	}
+
+	c := &domain.WebAuthnCredential{
+		ID:              cred.ID,
+		UserID:          userID,
+		Name:            strings.TrimSpace(name),
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+	for _, t := range cred.Transport {
+		c.Transports = append(c.Transports, string(t))
+	}
+	if err := uc.creds.SaveCredential(ctx, c); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, domain.ErrCredentialExists) {
+			uc.log.Error("save webauthn credential failed", "user_id", userID, "err", err)
+		}
+		return nil, err
+	}
+
+	uc.audit.Success(ctx, domain.AuditPasskeyAdd, userID)
+	uc.publish(ctx, "WebAuthnCredentialAdded", userID, c.ID)
+	return c, nil
+}
+
+func (uc *WebAuthnUsecase) ListCredentials(ctx context.Context, userID string) ([]domain.WebAuthnCredential, error) {
+	creds, err := uc.creds.ListCredentials(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("list webauthn credentials failed", "user_id", userID, "err", err)
+		return nil, err
+	}
+	return creds, nil
+}
+
+// DeleteCredential removes one of the user's credentials. id is the
+// base64url credential id as reported by ListCredentials and the browser.
+func (uc *WebAuthnUsecase) DeleteCredential(ctx context.Context, userID, id string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(id, "="))
+	if err != nil {
+		return domain.ErrCredentialNotFound
+	}
+	if err := uc.creds.DeleteCredential(ctx, userID, raw); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !errors.Is(err, domain.ErrCredentialNotFound) {
+			uc.log.Error("delete webauthn credential failed", "user_id", userID, "err", err)
+		}
+		return err
+	}
+
+	uc.audit.Success(ctx, domain.AuditPasskeyRemove, userID)
+	uc.publish(ctx, "WebAuthnCredentialRemoved", userID, raw)
+	return nil
+}
+
+// BeginLogin starts a passwordless login with a discoverable credential.
+// The returned session token identifies the ceremony in FinishLogin.
+func (uc *WebAuthnUsecase) BeginLogin(ctx context.Context) (string, json.RawMessage, error) {
+	// the passkey replaces both the password and the second factor, so the
+	// authenticator has to verify the user itself
+	assertion, session, err := uc.wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		uc.log.Error("begin webauthn login failed", "err", err)
+		return "", nil, err
+	}
+	token, err := generateToken()
+	if err != nil {
+		uc.log.Error("generate webauthn session failed", "err", err)
+		return "", nil, err
+	}
+	if err := uc.saveSession(ctx, webauthnLoginPrefix+hashToken(token), session); err != nil {
+		return "", nil, err
+	}
+	options, err := json.Marshal(assertion)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, options, nil
+}
+
+// FinishLogin verifies the assertion for a BeginLogin session and issues
+// tokens for the user owning the credential.
+func (uc *WebAuthnUsecase) FinishLogin(ctx context.Context, sessionToken string, response []byte, client domain.ClientInfo) (string, string, error) {
+	session, err := uc.takeSession(ctx, webauthnLoginPrefix+hashToken(strings.TrimSpace(sessionToken)))
+	if err != nil {
+		return "", "", err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return "", "", uc.failed("parse assertion", "", err)
+	}
+
+	var user *webauthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		c, err := uc.creds.FindCredential(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if c.UserID != string(userHandle) {
+			return nil, domain.ErrCredentialNotFound
+		}
+		user, err = uc.loadUser(ctx, c.UserID)
+		return user, err
+	}
+	cred, err := uc.wa.ValidateDiscoverableLogin(handler, *session, parsed)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		if user != nil {
+			uc.login.fail(ctx, user.ID(), "", client, ErrWebAuthnFailed)
+		}
+		return "", "", uc.failed("verify assertion", "", err)
+	}
+	if err := uc.used(ctx, user.ID(), cred); err != nil {
+		return "", "", err
+	}
+	if err := uc.login.admit(user.User); err != nil {
+		uc.login.fail(ctx, user.ID(), "", client, err)
+		return "", "", err
+	}
+
+	return uc.login.issue(ctx, user.ID(), client)
+}
+
+// BeginMFA returns assertion options for a login that stopped at an
+// MFAChallenge, restricted to the credentials of the challenged user.
+func (uc *WebAuthnUsecase) BeginMFA(ctx context.Context, mfaToken string) (json.RawMessage, error) {
+	hash := hashToken(strings.TrimSpace(mfaToken))
+	userID, err := uc.cache.Get(ctx, mfaChallengePrefix+hash)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, cache.ErrKeyNotFound):
+			return nil, ErrInvalidMFAToken
+		default:
+			uc.log.Error("cache get failed", "err", err)
+			return nil, err
+		}
+	}
+	user, err := uc.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.creds) == 0 {
+		return nil, domain.ErrMFANotEnrolled
+	}
+
+	assertion, session, err := uc.wa.BeginLogin(user)
+	if err != nil {
+		uc.log.Error("begin webauthn assertion failed", "user_id", userID, "err", err)
+		return nil, err
+	}
+	if err := uc.saveSession(ctx, webauthnMFAPrefix+hash, session); err != nil {
+		return nil, err
+	}
+	return json.Marshal(assertion)
+}
+
+// VerifyMFA completes an MFAChallenge with an assertion for the options of
+// the last BeginMFA call. Failed assertions count towards the same attempt
+// limit and account lockout as wrong one-time codes.
+func (uc *WebAuthnUsecase) VerifyMFA(ctx context.Context, mfaToken string, response []byte, client domain.ClientInfo) (string, string, error) {
+	hash := hashToken(strings.TrimSpace(mfaToken))
+	userID, err := uc.login.attempt(ctx, hash)
+	if err != nil {
+		return "", "", err
+	}
+	session, err := uc.takeSession(ctx, webauthnMFAPrefix+hash)
+	if err != nil {
+		return "", "", err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return "", "", uc.failed("parse assertion", userID, err)
+	}
+	user, err := uc.loadUser(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	cred, err := uc.wa.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		uc.login.secondFactorFailed(ctx, user.User, client, ErrWebAuthnFailed)
+		return "", "", uc.failed("verify assertion", userID, err)
+	}
+	if err := uc.used(ctx, userID, cred); err != nil {
+		return "", "", err
+	}
+
+	return uc.login.complete(ctx, hash, user.User, client)
+}
+
+// used rejects assertions from a cloned authenticator and records the new
+// signature counter.
+func (uc *WebAuthnUsecase) used(ctx context.Context, userID string, cred *webauthn.Credential) error {
+	if cred.Authenticator.CloneWarning {
+		uc.log.Warn("webauthn signature counter went backwards", "user_id", userID,
+			"credential_id", base64.RawURLEncoding.EncodeToString(cred.ID))
+		return ErrWebAuthnFailed
+	}
+	if err := uc.creds.TouchCredential(ctx, cred.ID, cred.Authenticator.SignCount, cred.Flags.BackupState); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("update webauthn credential failed", "user_id", userID, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (uc *WebAuthnUsecase) loadUser(ctx context.Context, userID string) (*webauthnUser, error) {
+	user, err := uc.users.FindByID(ctx, userID)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		uc.log.Error("find user failed", "user_id", userID, "err", err)
+		return nil, ErrUserNotFound
+	}
+	creds, err := uc.creds.ListCredentials(ctx, userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		uc.log.Error("list webauthn credentials failed", "user_id", userID, "err", err)
+		return nil, err
+	}
+	return &webauthnUser{User: user, creds: creds}, nil
+}
+
+func (uc *WebAuthnUsecase) saveSession(ctx context.Context, key string, session *webauthn.SessionData) error {
+	body, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := uc.cache.Set(ctx, key, string(body), uc.ttl); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		uc.log.Error("store webauthn session failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+// takeSession loads and removes a ceremony: every challenge is good for a
+// single response, successful or not.
+func (uc *WebAuthnUsecase) takeSession(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	body, err := uc.cache.GetDel(ctx, key)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, cache.ErrKeyNotFound):
+			return nil, ErrInvalidWebAuthnSession
+		default:
+			uc.log.Error("cache getdel failed", "err", err)
+			return nil, err
+		}
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(body), &session); err != nil {
+		uc.log.Error("decode webauthn session failed", "err", err)
+		return nil, ErrInvalidWebAuthnSession
+	}
+	return &session, nil
+}
+
+// failed logs why the library rejected a response and hides the details
+// from the caller.
+func (uc *WebAuthnUsecase) failed(step, userID string, err error) error {
+	var perr *protocol.Error
+	if errors.As(err, &perr) {
+		uc.log.Info("webauthn "+step+" failed", "user_id", userID, "type", perr.Type, "details", perr.Details, "info", perr.DevInfo)
+	} else {
+		uc.log.Info("webauthn "+step+" failed", "user_id", userID, "err", err)
+	}
+	return ErrWebAuthnFailed
+}
+
+func (uc *WebAuthnUsecase) publish(ctx context.Context, topic, userID string, credentialID []byte) {
+	msg := struct {
+		UserID       string `json:"user_id"`
+		CredentialID string `json:"credential_id"`
+	}{
+		UserID:       userID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credentialID),
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		uc.log.Error("marshal webauthn payload failed", "err", err)
+	}
+	if err := uc.broker.PublishToTopic(ctx, topic, body); err != nil && ctx.Err() == nil {
+		uc.log.Error("publish webauthn event failed", "topic", topic, "err", err)
+	}
+}
+
+// webauthnUser adapts a domain.User to webauthn.User. The user handle is
+// the user ID, which is what FinishLogin gets back from the authenticator.
+type webauthnUser struct {
+	*domain.User
+	creds []domain.WebAuthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return []byte(u.ID()) }
+func (u *webauthnUser) WebAuthnName() string        { return u.Email().String() }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.Email().String() }
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	out := make([]webauthn.Credential, 0, len(u.creds))
+	for _, c := range u.creds {
+		cred := webauthn.Credential{
+			ID:              c.ID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+		for _, t := range c.Transports {
+			cred.Transport = append(cred.Transport, protocol.AuthenticatorTransport(t))
+		}
+		out = append(out, cred)
+	}
+	return out
+}
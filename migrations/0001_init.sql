@@ -0,0 +1,22 @@
+-- Base schema as used by db.Postgres and auth_client.TokenRepository.
+
+CREATE TABLE IF NOT EXISTS users (
+    id              TEXT PRIMARY KEY,
+    email           TEXT        NOT NULL UNIQUE,
+    password_hash   TEXT        NOT NULL,
+    confirmation_id TEXT        NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    confirmed       BOOLEAN     NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+    id            UUID PRIMARY KEY,
+    user_id       TEXT        NOT NULL,
+    access_token  TEXT        NOT NULL,
+    refresh_token TEXT        NOT NULL UNIQUE,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    revoked_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
+CREATE INDEX IF NOT EXISTS tokens_access_token_idx ON tokens (access_token);
@@ -0,0 +1,13 @@
+-- Every refresh rotation inserts a child row; all rows descending from one
+-- login share family_id, so reuse of a consumed token revokes the whole chain.
+
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS family_id   UUID,
+    ADD COLUMN IF NOT EXISTS parent_id   UUID REFERENCES tokens (id),
+    ADD COLUMN IF NOT EXISTS consumed_at TIMESTAMPTZ;
+
+UPDATE tokens SET family_id = id WHERE family_id IS NULL;
+
+ALTER TABLE tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
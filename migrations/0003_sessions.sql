@@ -0,0 +1,18 @@
+-- One row per login; id equals tokens.family_id of the refresh chain.
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id                UUID PRIMARY KEY,
+    user_id           TEXT        NOT NULL,
+    user_agent        TEXT        NOT NULL DEFAULT '',
+    ip                TEXT        NOT NULL DEFAULT '',
+    device_label      TEXT        NOT NULL DEFAULT '',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_refreshed_at TIMESTAMPTZ,
+    revoked_at        TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+INSERT INTO sessions (id, user_id)
+SELECT DISTINCT family_id, user_id FROM tokens
+ON CONFLICT (id) DO NOTHING;
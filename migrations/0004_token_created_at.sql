@@ -0,0 +1,4 @@
+-- Issue time of a refresh token, reported as iat by token introspection.
+
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
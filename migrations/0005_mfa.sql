@@ -0,0 +1,17 @@
+-- TOTP second factor. secret holds nonce || AES-GCM ciphertext; an
+-- enrollment is pending until confirmed_at is set by a first valid code.
+
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id      TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret       BYTEA       NOT NULL,
+    last_step    BIGINT      NOT NULL DEFAULT 0,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    confirmed_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id   TEXT        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT        NOT NULL,
+    used_at   TIMESTAMPTZ,
+    PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,20 @@
+-- WebAuthn credentials (passkeys and security keys). id is the credential
+-- id chosen by the authenticator; transports is a comma-separated list of
+-- hints such as "internal,hybrid".
+
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id               BYTEA PRIMARY KEY,
+    user_id          TEXT        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name             TEXT        NOT NULL DEFAULT '',
+    public_key       BYTEA       NOT NULL,
+    attestation_type TEXT        NOT NULL DEFAULT '',
+    aaguid           BYTEA,
+    sign_count       BIGINT      NOT NULL DEFAULT 0,
+    transports       TEXT        NOT NULL DEFAULT '',
+    backup_eligible  BOOLEAN     NOT NULL DEFAULT false,
+    backup_state     BOOLEAN     NOT NULL DEFAULT false,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
@@ -0,0 +1,44 @@
+-- Role-based access control. Roles bundle permissions; users hold roles.
+-- Both are copied into access tokens when they are issued, so a change
+-- reaches downstream services with the next refresh.
+
+CREATE TABLE IF NOT EXISTS roles (
+    name        TEXT PRIMARY KEY,
+    description TEXT        NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role       TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id    TEXT        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role       TEXT        NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role_idx ON user_roles (role);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read',  'List and inspect user accounts'),
+    ('users:write', 'Change, lock and delete user accounts'),
+    ('roles:read',  'List roles and their permissions'),
+    ('roles:write', 'Create roles and grant them to users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access to the administration API')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions
+ON CONFLICT DO NOTHING;
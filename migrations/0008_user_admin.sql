@@ -0,0 +1,8 @@
+-- Account state managed through the admin API. A disabled account keeps
+-- its data but cannot sign in until it is enabled again.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (created_at, id);
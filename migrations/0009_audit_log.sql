@@ -0,0 +1,30 @@
+-- Durable record of security-relevant actions. Rows are only ever
+-- inserted: the trigger below rejects updates and deletes, and user_id is
+-- not a foreign key so the history of a deleted account is kept.
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor_id    TEXT,
+    user_id     TEXT,
+    email       TEXT,
+    action      TEXT        NOT NULL,
+    outcome     TEXT        NOT NULL CHECK (outcome IN ('success', 'failure')),
+    detail      TEXT        NOT NULL DEFAULT '',
+    ip          TEXT        NOT NULL DEFAULT '',
+    user_agent  TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_idx ON audit_log (user_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS audit_log_occurred_at_idx ON audit_log (occurred_at DESC);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,20 @@
+-- Transactional outbox. Messages are inserted in the same transaction as
+-- the state change they announce and published by the relay afterwards,
+-- so a broker outage delays them instead of losing them. Messages sharing
+-- an aggregate_id are published in id order.
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    aggregate_id    TEXT        NOT NULL,
+    kind            TEXT        NOT NULL CHECK (kind IN ('queue', 'topic')),
+    destination     TEXT        NOT NULL,
+    payload         BYTEA       NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until    TIMESTAMPTZ,
+    last_error      TEXT        NOT NULL DEFAULT '',
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (aggregate_id, id) WHERE delivered_at IS NULL;
@@ -0,0 +1,4 @@
+-- Delivered messages are purged by the relay once they are older than the
+-- configured retention.
+
+CREATE INDEX IF NOT EXISTS outbox_delivered_idx ON outbox (delivered_at) WHERE delivered_at IS NOT NULL;
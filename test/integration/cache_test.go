@@ -1,6 +1,8 @@
 package integration
 
 import (
+	"context"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -10,18 +12,39 @@ import (
 )
 
 func TestSetGetDelete(t *testing.T) {
-	rdb := cache.NewRedisCache(RedisConfig)
+	ctx := context.Background()
+	rdb := cache.NewRedisCache(RedisConfig, slog.Default())
 
 	// Set
-	require.NoError(t, rdb.Set("foo", "bar", 5*time.Second))
+	require.NoError(t, rdb.Set(ctx, "foo", "bar", 5*time.Second))
 
 	// Get
-	val, err := rdb.Get("foo")
+	val, err := rdb.Get(ctx, "foo")
 	require.NoError(t, err)
 	require.Equal(t, "bar", val)
 
 	// Delete
-	require.NoError(t, rdb.Delete("foo"))
-	_, err = rdb.Get("foo")
+	require.NoError(t, rdb.Delete(ctx, "foo"))
+	_, err = rdb.Get(ctx, "foo")
 	require.Error(t, err)
 }
+
+func TestDeleteUserRefresh(t *testing.T) {
+	ctx := context.Background()
+	rdb := cache.NewRedisCache(RedisConfig, slog.Default())
+
+	require.NoError(t, rdb.SetRefresh(ctx, "user-1", "rt-a", time.Minute))
+	require.NoError(t, rdb.SetRefresh(ctx, "user-1", "rt-b", time.Minute))
+	ok, err := rdb.SwapRefresh(ctx, "user-1", "rt-b", "rt-c", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	n, err := rdb.DeleteUserRefresh(ctx, "user-1")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	for _, rt := range []string{"rt-a", "rt-b", "rt-c"} {
+		_, err = rdb.Get(ctx, rt)
+		require.ErrorIs(t, err, cache.ErrKeyNotFound)
+	}
+}
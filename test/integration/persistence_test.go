@@ -1,6 +1,8 @@
 package integration
 
 import (
+	"context"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -11,36 +13,36 @@ import (
 )
 
 func TestSaveAndFindByEmail(t *testing.T) {
-	pg, err := db.NewPostgres(PGConfig)
-	require.NoError(t, err)
-
-	// создаём таблицу вручную
-	_, err = pg.DB().Exec(`
-CREATE TABLE IF NOT EXISTS users (
-  id TEXT PRIMARY KEY,
-  email TEXT NOT NULL UNIQUE,
-  password_hash TEXT NOT NULL,
-  confirmation_id TEXT NOT NULL,
-  expires_at TIMESTAMP NOT NULL,
-  confirmed BOOLEAN NOT NULL
-);
-`)
+	pg, err := db.NewPostgres(PGConfig, slog.Default())
 	require.NoError(t, err)
 
 	em, err := domain.NewEmail("intg@test.com")
 	require.NoError(t, err)
-	user := domain.NewUser("test-id", em, "hashpwd", "code123", time.Now().Add(24*time.Hour))
-	user.Confirmed = false
+	user, err := domain.NewUserFromRegistration("test-id", em, "hashpwd1", "code123", 24*time.Hour)
+	require.NoError(t, err)
 
 	// сохраняем и читаем
-	require.NoError(t, pg.Save(user))
+	ctx := context.Background()
+	require.NoError(t, pg.Save(ctx, user, db.QueueMessage(user.ID(), "email.confirm", []byte(`{}`))))
 
-	got, err := pg.FindByEmail(em)
+	// событие записано в outbox в той же транзакции
+	var queued int
+	require.NoError(t, pg.DB().QueryRowContext(ctx,
+		`SELECT count(*) FROM outbox WHERE aggregate_id = $1 AND destination = 'email.confirm'`, user.ID()).Scan(&queued))
+	require.Equal(t, 1, queued)
+
+	got, err := pg.FindByEmail(ctx, em)
 	require.NoError(t, err)
 
-	require.Equal(t, user.ID, got.ID)
-	require.Equal(t, user.Email.String(), got.Email.String())
-	require.Equal(t, user.PasswordHash, got.PasswordHash)
-	require.Equal(t, user.ConfirmationID, got.ConfirmationID)
-	require.Equal(t, user.Confirmed, got.Confirmed)
+	require.Equal(t, user.ID(), got.ID())
+	require.Equal(t, user.Email().String(), got.Email().String())
+	require.Equal(t, user.HashForStorage(), got.HashForStorage())
+	require.Equal(t, user.ConfirmationID(), got.ConfirmationID())
+	require.Equal(t, user.IsConfirmed(), got.IsConfirmed())
+
+	// подтверждение email
+	require.NoError(t, pg.MarkConfirmed(ctx, user.ID()))
+	got, err = pg.FindByEmail(ctx, em)
+	require.NoError(t, err)
+	require.True(t, got.IsConfirmed())
 }
@@ -0,0 +1,58 @@
+package integration
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ParkieV/auth-service/internal/config"
+	"github.com/ParkieV/auth-service/internal/domain"
+	"github.com/ParkieV/auth-service/internal/infrastructure/auth_client"
+	"github.com/ParkieV/auth-service/internal/infrastructure/db"
+)
+
+func TestRevokeOthersEndsSessions(t *testing.T) {
+	ctx := context.Background()
+	pg, err := db.NewPostgres(PGConfig, slog.Default())
+	require.NoError(t, err)
+	tokens, err := auth_client.NewDBTokenRepository(PGConfig, config.JWTConfig{
+		HMACSecret: base64.StdEncoding.EncodeToString([]byte("integration-test-secret-32-bytes")),
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+		ClientID:   "auth-service",
+	}, db.NewRoleStore(pg.DB()), slog.Default())
+	require.NoError(t, err)
+
+	userID := uuid.NewString()
+	keepAccess, _, err := tokens.GenerateTokens(ctx, userID, domain.ClientInfo{DeviceLabel: "laptop"})
+	require.NoError(t, err)
+	_, phoneRefresh, err := tokens.GenerateTokens(ctx, userID, domain.ClientInfo{DeviceLabel: "phone"})
+	require.NoError(t, err)
+	_, tabletRefresh, err := tokens.GenerateTokens(ctx, userID, domain.ClientInfo{DeviceLabel: "tablet"})
+	require.NoError(t, err)
+
+	sessions, err := tokens.ListSessions(ctx, userID, keepAccess)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+
+	revoked, err := tokens.RevokeOthers(ctx, userID, keepAccess)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{phoneRefresh, tabletRefresh}, revoked)
+
+	// "выйти на других устройствах" не должно оставлять их в списке
+	sessions, err = tokens.ListSessions(ctx, userID, keepAccess)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, "laptop", sessions[0].Client.DeviceLabel)
+	require.True(t, sessions[0].Current)
+
+	var revokedSessions int
+	require.NoError(t, pg.DB().QueryRowContext(ctx,
+		`SELECT count(*) FROM sessions WHERE user_id = $1 AND revoked_at IS NOT NULL`, userID).Scan(&revokedSessions))
+	require.Equal(t, 2, revokedSessions)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	tc "github.com/testcontainers/testcontainers-go"
@@ -40,7 +41,13 @@ func TestMain(m *testing.M) {
 		RedisConfig = config.RedisConfig{Addr: fmt.Sprintf("%s:%s", host, port.Port()), DB: 0}
 	}
 
-	// Запускаем Postgres
+	// Запускаем Postgres со схемой из migrations/, как в docker-compose
+	migrations, err := migrationFiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list migrations: %v\n", err)
+		RedisCont.Terminate(ctx)
+		os.Exit(1)
+	}
 	preq := tc.ContainerRequest{
 		Image:        "postgres:15",
 		ExposedPorts: []string{"5432/tcp"},
@@ -49,7 +56,12 @@ func TestMain(m *testing.M) {
 			"POSTGRES_PASSWORD": "secret",
 			"POSTGRES_DB":       "authdb",
 		},
-		WaitingFor: wait.ForListeningPort("5432/tcp"),
+		Files: migrations,
+		// сервер перезапускается после init-скриптов, поэтому ждём второе сообщение
+		WaitingFor: wait.ForAll(
+			wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+			wait.ForListeningPort("5432/tcp"),
+		),
 	}
 	pcont, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{ContainerRequest: preq, Started: true})
 	if err != nil {
@@ -77,3 +89,24 @@ func TestMain(m *testing.M) {
 	PGCont.Terminate(ctx)
 	os.Exit(code)
 }
+
+// migrationFiles copies migrations/*.sql into the entrypoint directory of
+// the postgres image, which runs them in name order on first start.
+func migrationFiles() ([]tc.ContainerFile, error) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no migrations found")
+	}
+	files := make([]tc.ContainerFile, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, tc.ContainerFile{
+			HostFilePath:      p,
+			ContainerFilePath: "/docker-entrypoint-initdb.d/" + filepath.Base(p),
+			FileMode:          0o644,
+		})
+	}
+	return files, nil
+}